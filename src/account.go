@@ -18,6 +18,9 @@ const (
 	SexMale   = byte('m')
 )
 
+// Seeking is SexFemale, SexMale or SeekingAny, zero means opposite sex.
+const SeekingAny = byte('a')
+
 type Premium struct {
 	Start  uint32
 	Finish uint32
@@ -46,6 +49,7 @@ type Account struct {
 	Email       string
 	Premium     *Premium // optional
 	Interests   []Interest
+	Seeking     byte // optional
 }
 
 type Like struct {
@@ -76,6 +80,7 @@ type RawAccount struct {
 	Premium     *Premium // optional
 	Interests   []string
 	Likes       []RawLike
+	Seeking     byte // optional
 }
 
 var rawAccountsPool = sync.Pool{
@@ -110,6 +115,7 @@ func (account *RawAccount) Reset() {
 	account.Premium = nil
 	account.Interests = account.Interests[:0]
 	account.Likes = account.Likes[:0]
+	account.Seeking = 0
 }
 
 func (account *RawAccount) Release() {
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type CooccurrenceSort uint8
+
+const (
+	CooccurrenceSortLift CooccurrenceSort = iota
+	CooccurrenceSortJaccard
+	CooccurrenceSortCount
+)
+
+type CooccurrenceFilter struct {
+	Interest Interest
+	Country  Country
+	City     City
+	Sex      byte
+}
+
+// Cooccurrence is a query for interests that occur together with one
+// interest or with every interest among filtered accounts.
+type Cooccurrence struct {
+	parser *Parser
+	dicts  *Dicts
+
+	expectEmpty bool
+	limit       int
+	sort        CooccurrenceSort
+	Filter      CooccurrenceFilter
+}
+
+var cooccurrencePool = sync.Pool{
+	New: func() interface{} {
+		return &Cooccurrence{}
+	},
+}
+
+func BorrowCooccurrence(parser *Parser, dicts *Dicts) *Cooccurrence {
+	c := cooccurrencePool.Get().(*Cooccurrence)
+	c.Reset()
+	c.parser = parser
+	c.dicts = dicts
+	return c
+}
+
+func NewCooccurrence(parser *Parser, dicts *Dicts) *Cooccurrence {
+	return &Cooccurrence{
+		parser: parser,
+		dicts:  dicts,
+	}
+}
+
+func (cooccurrence *Cooccurrence) Release() {
+	cooccurrencePool.Put(cooccurrence)
+}
+
+func (cooccurrence *Cooccurrence) Reset() {
+	cooccurrence.expectEmpty = false
+	cooccurrence.limit = 0
+	cooccurrence.sort = CooccurrenceSortLift
+	cooccurrence.Filter.Interest = 0
+	cooccurrence.Filter.Country = 0
+	cooccurrence.Filter.City = 0
+	cooccurrence.Filter.Sex = 0
+}
+
+func (cooccurrence *Cooccurrence) ExpectEmpty() bool {
+	return cooccurrence.expectEmpty
+}
+
+func (cooccurrence *Cooccurrence) Limit() int {
+	return cooccurrence.limit
+}
+
+func (cooccurrence *Cooccurrence) Sort() CooccurrenceSort {
+	return cooccurrence.sort
+}
+
+func (cooccurrence *Cooccurrence) Parse(query string) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for param, paramValues := range values {
+		if len(paramValues) != 1 || paramValues[0] == "" {
+			return errors.New("Invalid cooccurrence param value")
+		}
+
+		err := cooccurrence.ParseParam(param, paramValues[0])
+		if err != nil {
+			return err
+		}
+	}
+	if cooccurrence.limit == 0 {
+		return errors.New("Limit should be specified")
+	}
+	return nil
+}
+
+func (cooccurrence *Cooccurrence) ParseParam(param string, value string) error {
+	switch param {
+	case "interest":
+		interest, err := cooccurrence.dicts.GetInterest(value)
+		if err != nil {
+			cooccurrence.expectEmpty = true
+			return nil
+		}
+		cooccurrence.Filter.Interest = interest
+	case "country":
+		country, err := cooccurrence.dicts.GetCountry(value)
+		if err != nil {
+			cooccurrence.expectEmpty = true
+			return nil
+		}
+		cooccurrence.Filter.Country = country
+	case "city":
+		city, err := cooccurrence.dicts.GetCity(value)
+		if err != nil {
+			cooccurrence.expectEmpty = true
+			return nil
+		}
+		cooccurrence.Filter.City = city
+	case "sex":
+		sex, err := cooccurrence.parser.ParseSex(value)
+		if err != nil {
+			return err
+		}
+		cooccurrence.Filter.Sex = sex
+	case "sort":
+		switch value {
+		case "lift":
+			cooccurrence.sort = CooccurrenceSortLift
+		case "jaccard":
+			cooccurrence.sort = CooccurrenceSortJaccard
+		case "count":
+			cooccurrence.sort = CooccurrenceSortCount
+		default:
+			return errors.New("Invalid sort value")
+		}
+	case "limit":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid limit value")
+		}
+		cooccurrence.limit = int(ui64)
+	case "query_id":
+		// skip
+	default:
+		return errors.New("Unknown cooccurrence param")
+	}
+
+	return nil
+}
@@ -27,6 +27,9 @@ type Dicts struct {
 	cityCountry   map[City]Country
 	interests     map[string]Interest
 	interestStrs  map[Interest]string
+	fnameKeys     dictLikeKeys
+	snameKeys     dictLikeKeys
+	cityKeys      dictLikeKeys
 	rwLock        sync.RWMutex
 }
 
@@ -44,6 +47,9 @@ func NewDicts() *Dicts {
 		cityCountry:   make(map[City]Country),
 		interests:     make(map[string]Interest),
 		interestStrs:  make(map[Interest]string),
+		fnameKeys:     make(dictLikeKeys),
+		snameKeys:     make(dictLikeKeys),
+		cityKeys:      make(dictLikeKeys),
 	}
 }
 
@@ -58,6 +64,7 @@ func (dicts *Dicts) AddFname(fnameStr string) Fname {
 	fname = Fname(len(dicts.fnames) + 1)
 	dicts.fnames[fnameStr] = fname
 	dicts.fnameStrs[fname] = fnameStr
+	dicts.fnameKeys.add(fnameStr, int(fname))
 	dicts.rwLock.Unlock()
 
 	return fname
@@ -99,6 +106,7 @@ func (dicts *Dicts) AddSname(snameStr string) Sname {
 	sname = Sname(len(dicts.snames) + 1)
 	dicts.snames[snameStr] = sname
 	dicts.snameStrs[sname] = snameStr
+	dicts.snameKeys.add(snameStr, int(sname))
 	dicts.rwLock.Unlock()
 
 	return sname
@@ -181,6 +189,7 @@ func (dicts *Dicts) AddCity(country Country, cityStr string) City {
 	city = City(len(dicts.cities) + 1)
 	dicts.cities[cityStr] = city
 	dicts.cityStrs[city] = cityStr
+	dicts.cityKeys.add(cityStr, int(city))
 	if country != 0 {
 		dicts.countryCities[country] = append(dicts.countryCities[country], city)
 		dicts.cityCountry[city] = country
@@ -279,3 +288,10 @@ func (dicts *Dicts) GetInterestString(interest Interest) (string, error) {
 func (dicts *Dicts) GetInterests() map[string]Interest {
 	return dicts.interests
 }
+
+func (dicts *Dicts) CountInterests() int {
+	dicts.rwLock.RLock()
+	count := len(dicts.interests)
+	dicts.rwLock.RUnlock()
+	return count
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Like lookups match dict values by normalized key: case folded,
+// ё unified with е and Cyrillic transliterated to Latin, so that
+// "Юлия", "юлиа" and "Julia" share the same key "iulia".
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latinReplacer folds different romanizations of the same sounds.
+var latinReplacer = strings.NewReplacer(
+	"'", "",
+	"x", "ks",
+	"kh", "h",
+	"ph", "f",
+	"ck", "k",
+	"q", "k",
+	"w", "v",
+	"ts", "c",
+	"ye", "e",
+	"j", "i",
+	"y", "i",
+)
+
+func NormalizeName(name string) string {
+	var sb bytes.Buffer
+	sb.Grow(len(name) * 2)
+	for _, r := range strings.ToLower(name) {
+		if latin, ok := cyrillicToLatin[r]; ok {
+			sb.WriteString(latin)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	key := latinReplacer.Replace(sb.String())
+
+	// collapse doubled letters, e.g. "iuliia" and "iulia"
+	sb.Reset()
+	var prev rune
+	for _, r := range key {
+		if r != prev {
+			sb.WriteRune(r)
+		}
+		prev = r
+	}
+	return sb.String()
+}
+
+type dictLikeKeys map[string][]int
+
+func (keys dictLikeKeys) add(name string, value int) {
+	key := NormalizeName(name)
+	keys[key] = append(keys[key], value)
+}
+
+func (keys dictLikeKeys) find(name string, fuzzy bool) []int {
+	key := NormalizeName(name)
+	values := make([]int, 0, len(keys[key]))
+	values = append(values, keys[key]...)
+	if !fuzzy {
+		return values
+	}
+	for otherKey, otherValues := range keys {
+		if otherKey != key && editDistanceOne(otherKey, key) {
+			values = append(values, otherValues...)
+		}
+	}
+	return values
+}
+
+// editDistanceOne reports whether a turns into b by single
+// insertion, deletion or substitution of a rune.
+func editDistanceOne(a, b string) bool {
+	la, lb := utf8.RuneCountInString(a), utf8.RuneCountInString(b)
+	if la < lb {
+		a, b = b, a
+		la, lb = lb, la
+	}
+	if la-lb > 1 {
+		return false
+	}
+	ra, rb := []rune(a), []rune(b)
+	i := 0
+	for i < lb && ra[i] == rb[i] {
+		i++
+	}
+	if i == la {
+		return true
+	}
+	if la == lb {
+		// substitution
+		return string(ra[i+1:]) == string(rb[i+1:])
+	}
+	// deletion from the longer one
+	return string(ra[i+1:]) == string(rb[i:])
+}
+
+func (dicts *Dicts) LikeFname(fnameStr string, fuzzy bool) []Fname {
+	dicts.rwLock.RLock()
+	values := dicts.fnameKeys.find(fnameStr, fuzzy)
+	dicts.rwLock.RUnlock()
+	fnames := make([]Fname, len(values))
+	for i, value := range values {
+		fnames[i] = Fname(value)
+	}
+	return fnames
+}
+
+func (dicts *Dicts) LikeSname(snameStr string, fuzzy bool) []Sname {
+	dicts.rwLock.RLock()
+	values := dicts.snameKeys.find(snameStr, fuzzy)
+	dicts.rwLock.RUnlock()
+	snames := make([]Sname, len(values))
+	for i, value := range values {
+		snames[i] = Sname(value)
+	}
+	return snames
+}
+
+func (dicts *Dicts) LikeCity(cityStr string, fuzzy bool) []City {
+	dicts.rwLock.RLock()
+	values := dicts.cityKeys.find(cityStr, fuzzy)
+	dicts.rwLock.RUnlock()
+	cities := make([]City, len(values))
+	for i, value := range values {
+		cities[i] = City(value)
+	}
+	return cities
+}
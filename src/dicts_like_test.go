@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Юлия", "iulia"},
+		{"юлиа", "iulia"},
+		{"Julia", "iulia"},
+		{"Iuliia", "iulia"},
+		{"Ёлкино", "elkino"},
+		{"Елкино", "elkino"},
+		{"Александр", "aleksandr"},
+		{"Alexandr", "aleksandr"},
+		{"Хабаровск", "habarovsk"},
+		{"Khabarovsk", "habarovsk"},
+		{"Цветаева", "cvetaeva"},
+		{"Tsvetaeva", "cvetaeva"},
+		{"Анна", "ana"},
+		{"Мария", "maria"},
+		{"Пётр", "petr"},
+		{"Phillip", "filip"},
+		{"Д'Артаньян", "dartanian"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeName(test.name); got != test.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEditDistanceOne(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", true},
+		{"", "a", true},
+		{"a", "", true},
+		{"abc", "abc", true},
+		{"abc", "abd", true},
+		{"abc", "xbc", true},
+		{"abcd", "abxd", true},
+		{"abc", "ab", true},
+		{"ab", "abc", true},
+		{"abc", "bc", true},
+		{"abc", "axbc", true},
+		{"abc", "acb", false},
+		{"abc", "a", false},
+		{"abcd", "axcx", false},
+		{"abc", "abcde", false},
+		{"мария", "мариа", true},
+		{"мария", "мари", true},
+		{"мария", "мрия", true},
+		{"мария", "марина", false},
+	}
+
+	for _, test := range tests {
+		if got := editDistanceOne(test.a, test.b); got != test.want {
+			t.Errorf("editDistanceOne(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestFilterLike(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"fname_like": {"Maria"}}, IDS{3}},
+		{url.Values{"fname_like": {"мариа"}}, IDS{3}},
+		{url.Values{"fname_like": {"Petr"}}, IDS{4}},
+		{url.Values{"fname_like": {"Ivn"}}, IDS{}},
+		{url.Values{"fname_like": {"Ivn"}, "fuzzy": {"1"}}, IDS{1}},
+		{url.Values{"sname_like": {"Ivanov"}}, IDS{1}},
+		{url.Values{"sname_like": {"Petrova"}, "sex_eq": {"f"}}, IDS{2}},
+		{url.Values{"city_like": {"Moskva"}}, IDS{6, 2, 1}},
+		{url.Values{"city_like": {"Moskwa"}, "sex_eq": {"m"}}, IDS{6, 1}},
+		{url.Values{"city_like": {"Berlin"}}, IDS{3}},
+		{url.Values{"city_like": {"Bern"}}, IDS{}},
+		{url.Values{"city_like": {"Berln"}, "fuzzy": {"1"}}, IDS{3}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"net/url"
 	"strconv"
 	"strings"
@@ -20,6 +21,18 @@ type Filter struct {
 	noFilter    bool
 	expectEmpty bool
 	limit       int
+	count       bool
+	params      int
+	explain     bool
+	fuzzy       bool
+	sample      int
+	seed        int64
+	seedSet     bool
+	plan        FilterPlan
+
+	// birth bounds of age params, resolved by store on each query
+	ageBirthGte int64
+	ageBirthLte int64
 
 	sex       bool
 	email     bool
@@ -33,29 +46,45 @@ type Filter struct {
 	interests bool
 	likes     bool
 	premium   bool
+	query     bool
 
 	SexEq             byte
+	SexNeq            byte
 	EmailDomain       string
 	EmailLt           string
 	EmailGt           string
 	StatusEq          byte
 	StatusNeq         byte
+	StatusAny         []byte
 	FnameEq           Fname
 	FnameAny          []Fname
+	FnameNany         []Fname
+	FnameLike         string
+	FnameLikeAny      []Fname
 	FnameNull         bool
 	FnameNullSet      bool
 	SnameEq           Sname
 	SnameStarts       string
+	SnameLike         string
+	SnameLikeAny      []Sname
 	SnameNull         bool
 	SnameNullSet      bool
 	PhoneCode         uint16
+	PhoneCodeNany     []uint16
+	PhoneEq           string
+	PhoneStarts       string
 	PhoneNull         bool
 	PhoneNullSet      bool
 	CountryEq         Country
+	CountryAny        []Country
+	CountryNany       []Country
 	CountryNull       bool
 	CountryNullSet    bool
 	CityEq            City
 	CityAny           []City
+	CityNany          []City
+	CityLike          string
+	CityLikeAny       []City
 	CityNull          bool
 	CityNullSet       bool
 	BirthLt           int64
@@ -63,12 +92,27 @@ type Filter struct {
 	BirthYear         Year
 	BirthYearGte      int64
 	BirthYearLte      int64
+	AgeMin            uint16
+	AgeMinSet         bool
+	AgeMax            uint16
+	AgeMaxSet         bool
 	InterestsContains []Interest
 	InterestsAny      []Interest
+	InterestsNone     []Interest
 	LikesContains     []uint32
+	LikesAny          []uint32
+	LikesCountGt      uint32 // distinct accounts liked by account
+	LikesCountGtSet   bool
+	LikesCountLt      uint32
+	LikesCountLtSet   bool
+	LikedCountGt      uint32 // distinct accounts which liked account
+	LikedCountGtSet   bool
+	LikedCountLt      uint32
+	LikedCountLtSet   bool
 	PremiumNow        bool
 	PremiumNull       bool
 	PremiumNullSet    bool
+	Query             *QueryNode
 }
 
 var filtersPool = sync.Pool{
@@ -120,6 +164,14 @@ func (filter *Filter) Reset() {
 	filter.noFilter = true
 	filter.expectEmpty = false
 	filter.limit = 0
+	filter.count = false
+	filter.params = 0
+	filter.explain = false
+	filter.fuzzy = false
+	filter.sample = 0
+	filter.seed = 0
+	filter.seedSet = false
+	filter.plan.Reset()
 
 	filter.sex = false
 	filter.email = false
@@ -133,29 +185,45 @@ func (filter *Filter) Reset() {
 	filter.interests = false
 	filter.likes = false
 	filter.premium = false
+	filter.query = false
 
 	filter.SexEq = 0
+	filter.SexNeq = 0
 	filter.EmailDomain = ""
 	filter.EmailLt = ""
 	filter.EmailGt = ""
 	filter.StatusEq = 0
 	filter.StatusNeq = 0
+	filter.StatusAny = filter.StatusAny[:0]
 	filter.FnameEq = 0
 	filter.FnameAny = filter.FnameAny[:0]
+	filter.FnameNany = filter.FnameNany[:0]
+	filter.FnameLike = ""
+	filter.FnameLikeAny = filter.FnameLikeAny[:0]
 	filter.FnameNull = false
 	filter.FnameNullSet = false
 	filter.SnameEq = 0
 	filter.SnameStarts = ""
+	filter.SnameLike = ""
+	filter.SnameLikeAny = filter.SnameLikeAny[:0]
 	filter.SnameNull = false
 	filter.SnameNullSet = false
 	filter.PhoneCode = 0
+	filter.PhoneCodeNany = filter.PhoneCodeNany[:0]
+	filter.PhoneEq = ""
+	filter.PhoneStarts = ""
 	filter.PhoneNull = false
 	filter.PhoneNullSet = false
 	filter.CountryEq = 0
+	filter.CountryAny = filter.CountryAny[:0]
+	filter.CountryNany = filter.CountryNany[:0]
 	filter.CountryNull = false
 	filter.CountryNullSet = false
 	filter.CityEq = 0
 	filter.CityAny = filter.CityAny[:0]
+	filter.CityNany = filter.CityNany[:0]
+	filter.CityLike = ""
+	filter.CityLikeAny = filter.CityLikeAny[:0]
 	filter.CityNull = false
 	filter.CityNullSet = false
 	filter.BirthLt = 0
@@ -163,12 +231,29 @@ func (filter *Filter) Reset() {
 	filter.BirthYear = 0
 	filter.BirthYearGte = 0
 	filter.BirthYearLte = 0
+	filter.AgeMin = 0
+	filter.AgeMinSet = false
+	filter.AgeMax = 0
+	filter.AgeMaxSet = false
+	filter.ageBirthGte = 0
+	filter.ageBirthLte = 0
 	filter.InterestsContains = filter.InterestsContains[:0]
 	filter.InterestsAny = filter.InterestsAny[:0]
+	filter.InterestsNone = filter.InterestsNone[:0]
 	filter.LikesContains = filter.LikesContains[:0]
+	filter.LikesAny = filter.LikesAny[:0]
+	filter.LikesCountGt = 0
+	filter.LikesCountGtSet = false
+	filter.LikesCountLt = 0
+	filter.LikesCountLtSet = false
+	filter.LikedCountGt = 0
+	filter.LikedCountGtSet = false
+	filter.LikedCountLt = 0
+	filter.LikedCountLtSet = false
 	filter.PremiumNow = false
 	filter.PremiumNull = false
 	filter.PremiumNullSet = false
+	filter.Query = nil
 }
 
 func (filter *Filter) ExpectEmpty() bool {
@@ -183,6 +268,30 @@ func (filter *Filter) Limit() int {
 	return filter.limit
 }
 
+func (filter *Filter) Count() bool {
+	return filter.count
+}
+
+func (filter *Filter) Sample() int {
+	return filter.sample
+}
+
+// Seed returns sampling seed, random one when it is not specified.
+func (filter *Filter) Seed() int64 {
+	if !filter.seedSet {
+		return time.Now().UnixNano()
+	}
+	return filter.seed
+}
+
+func (filter *Filter) Explain() bool {
+	return filter.explain
+}
+
+func (filter *Filter) Plan() *FilterPlan {
+	return &filter.plan
+}
+
 func (filter *Filter) Parse(query string) error {
 	values, err := url.ParseQuery(query)
 	if err != nil {
@@ -198,12 +307,42 @@ func (filter *Filter) Parse(query string) error {
 		if err != nil {
 			return errors.Wrap(err, "Invalid filter param")
 		}
+		if param != "limit" && param != "count" && param != "explain" && param != "fuzzy" &&
+			param != "sample" && param != "seed" && param != "query_id" {
+			filter.params++
+		}
 	}
 
-	if filter.limit == 0 {
+	if filter.sample != 0 {
+		filter.limit = filter.sample
+	}
+	if filter.seedSet && filter.sample == 0 {
+		return errors.New("Seed requires sample")
+	}
+	if filter.limit == 0 && !filter.count {
 		return errors.New("Limit should be specified")
 	}
 
+	// like params are resolved after all params to know fuzzy flag
+	if filter.FnameLike != "" {
+		filter.FnameLikeAny = append(filter.FnameLikeAny, filter.dicts.LikeFname(filter.FnameLike, filter.fuzzy)...)
+		if len(filter.FnameLikeAny) == 0 {
+			filter.expectEmpty = true
+		}
+	}
+	if filter.SnameLike != "" {
+		filter.SnameLikeAny = append(filter.SnameLikeAny, filter.dicts.LikeSname(filter.SnameLike, filter.fuzzy)...)
+		if len(filter.SnameLikeAny) == 0 {
+			filter.expectEmpty = true
+		}
+	}
+	if filter.CityLike != "" {
+		filter.CityLikeAny = append(filter.CityLikeAny, filter.dicts.LikeCity(filter.CityLike, filter.fuzzy)...)
+		if len(filter.CityLikeAny) == 0 {
+			filter.expectEmpty = true
+		}
+	}
+
 	filter.noFilter = !filter.sex &&
 		!filter.email &&
 		!filter.status &&
@@ -215,11 +354,18 @@ func (filter *Filter) Parse(query string) error {
 		!filter.birth &&
 		!filter.interests &&
 		!filter.likes &&
-		!filter.premium
+		!filter.premium &&
+		!filter.query
 
 	if filter.StatusEq != 0 && filter.StatusNeq != 0 && filter.StatusEq == filter.StatusNeq {
 		filter.expectEmpty = true
 	}
+	if filter.SexEq != 0 && filter.SexNeq != 0 && filter.SexEq == filter.SexNeq {
+		filter.expectEmpty = true
+	}
+	if filter.AgeMinSet && filter.AgeMaxSet && filter.AgeMin > filter.AgeMax {
+		filter.expectEmpty = true
+	}
 
 	if filter.CountryEq != 0 {
 		if filter.CityEq != 0 {
@@ -251,6 +397,26 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		filter.SexEq = sex
 		filter.sex = true
+	case "sex_neq":
+		sex, err := filter.parser.ParseSex(value)
+		if err != nil {
+			return err
+		}
+		filter.SexNeq = sex
+		filter.sex = true
+	case "sex_nany":
+		for _, sexStr := range strings.Split(value, ",") {
+			sex, err := filter.parser.ParseSex(sexStr)
+			if err != nil {
+				return err
+			}
+			if filter.SexNeq != 0 && filter.SexNeq != sex {
+				// both sexes are excluded
+				filter.expectEmpty = true
+			}
+			filter.SexNeq = sex
+		}
+		filter.sex = true
 	case "email_domain":
 		filter.EmailDomain = value
 		filter.email = true
@@ -274,6 +440,18 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		filter.StatusNeq = status
 		filter.status = true
+	case "status_any":
+		for _, statusStr := range strings.Split(value, ",") {
+			status, err := filter.parser.ParseStatus(statusStr)
+			if err != nil {
+				return err
+			}
+			if bytes.IndexByte(filter.StatusAny, status) != -1 {
+				continue
+			}
+			filter.StatusAny = append(filter.StatusAny, status)
+		}
+		filter.status = true
 	case "fname_eq":
 		fname, err := filter.dicts.GetFname(value)
 		if err != nil {
@@ -286,7 +464,7 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		fnameAny := make([]Fname, 0)
 		for _, fnameStr := range strings.Split(value, ",") {
 			fname, err := filter.dicts.GetFname(fnameStr)
-			if err != nil {
+			if err != nil || containsFname(fnameAny, fname) {
 				continue
 			}
 			fnameAny = append(fnameAny, fname)
@@ -297,6 +475,18 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		filter.FnameAny = fnameAny
 		filter.fname = true
+	case "fname_neq", "fname_nany":
+		for _, fnameStr := range strings.Split(value, ",") {
+			fname, err := filter.dicts.GetFname(fnameStr)
+			if err != nil || containsFname(filter.FnameNany, fname) {
+				continue
+			}
+			filter.FnameNany = append(filter.FnameNany, fname)
+		}
+		filter.fname = true
+	case "fname_like":
+		filter.FnameLike = value
+		filter.fname = true
 	case "fname_null":
 		filter.FnameNull = value == "1"
 		filter.FnameNullSet = true
@@ -312,6 +502,9 @@ func (filter *Filter) ParseParam(param string, value string) error {
 	case "sname_starts":
 		filter.SnameStarts = value
 		filter.sname = true
+	case "sname_like":
+		filter.SnameLike = value
+		filter.sname = true
 	case "sname_null":
 		filter.SnameNull = value == "1"
 		filter.SnameNullSet = true
@@ -323,6 +516,24 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		filter.PhoneCode = uint16(ui64)
 		filter.phone = true
+	case "phone_code_neq", "phone_code_nany":
+		for _, phoneCodeStr := range strings.Split(value, ",") {
+			ui64, err := strconv.ParseUint(phoneCodeStr, 10, 16)
+			if err != nil {
+				return err
+			}
+			if containsPhoneCode(filter.PhoneCodeNany, uint16(ui64)) {
+				continue
+			}
+			filter.PhoneCodeNany = append(filter.PhoneCodeNany, uint16(ui64))
+		}
+		filter.phone = true
+	case "phone_eq":
+		filter.PhoneEq = value
+		filter.phone = true
+	case "phone_starts":
+		filter.PhoneStarts = value
+		filter.phone = true
 	case "phone_null":
 		filter.PhoneNull = value == "1"
 		filter.PhoneNullSet = true
@@ -335,6 +546,28 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		filter.CountryEq = country
 		filter.country = true
+	case "country_any":
+		for _, countryStr := range strings.Split(value, ",") {
+			country, err := filter.dicts.GetCountry(countryStr)
+			if err != nil || containsCountry(filter.CountryAny, country) {
+				continue
+			}
+			filter.CountryAny = append(filter.CountryAny, country)
+		}
+		if len(filter.CountryAny) == 0 {
+			filter.expectEmpty = true
+			return nil
+		}
+		filter.country = true
+	case "country_neq", "country_nany":
+		for _, countryStr := range strings.Split(value, ",") {
+			country, err := filter.dicts.GetCountry(countryStr)
+			if err != nil || containsCountry(filter.CountryNany, country) {
+				continue
+			}
+			filter.CountryNany = append(filter.CountryNany, country)
+		}
+		filter.country = true
 	case "country_null":
 		filter.CountryNull = value == "1"
 		filter.CountryNullSet = true
@@ -354,7 +587,7 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		}
 		for _, cityStr := range cityStrs {
 			city, err := filter.dicts.GetCity(cityStr)
-			if err != nil {
+			if err != nil || containsCity(filter.CityAny, city) {
 				continue
 			}
 			filter.CityAny = append(filter.CityAny, city)
@@ -364,6 +597,18 @@ func (filter *Filter) ParseParam(param string, value string) error {
 			return nil
 		}
 		filter.city = true
+	case "city_neq", "city_nany":
+		for _, cityStr := range strings.Split(value, ",") {
+			city, err := filter.dicts.GetCity(cityStr)
+			if err != nil || containsCity(filter.CityNany, city) {
+				continue
+			}
+			filter.CityNany = append(filter.CityNany, city)
+		}
+		filter.city = true
+	case "city_like":
+		filter.CityLike = value
+		filter.city = true
 	case "city_null":
 		filter.CityNull = value == "1"
 		filter.CityNullSet = true
@@ -393,6 +638,43 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		birthYearGte, birthYearLte := YearToTimestamp(filter.BirthYear)
 		filter.BirthYearGte = birthYearGte
 		filter.BirthYearLte = birthYearLte
+	case "age_gt":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return err
+		}
+		filter.setAgeMin(uint16(ui64) + 1)
+		filter.birth = true
+	case "age_lt":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return err
+		}
+		if ui64 == 0 {
+			filter.expectEmpty = true
+			return nil
+		}
+		filter.setAgeMax(uint16(ui64) - 1)
+		filter.birth = true
+	case "age_between":
+		ages := strings.Split(value, ",")
+		if len(ages) != 2 {
+			return errors.New("Age between expects two values")
+		}
+		ageMin, err := strconv.ParseUint(ages[0], 10, 8)
+		if err != nil {
+			return err
+		}
+		ageMax, err := strconv.ParseUint(ages[1], 10, 8)
+		if err != nil {
+			return err
+		}
+		if ageMin > ageMax {
+			return errors.New("Invalid age range")
+		}
+		filter.setAgeMin(uint16(ageMin))
+		filter.setAgeMax(uint16(ageMax))
+		filter.birth = true
 	case "interests_contains":
 		interestsContainsStr := strings.Split(value, ",")
 		for _, interestStr := range interestsContainsStr {
@@ -421,6 +703,15 @@ func (filter *Filter) ParseParam(param string, value string) error {
 			return nil
 		}
 		filter.interests = true
+	case "interests_none":
+		for _, interestStr := range strings.Split(value, ",") {
+			interest, err := filter.dicts.GetInterest(interestStr)
+			if err != nil {
+				continue
+			}
+			filter.InterestsNone = append(filter.InterestsNone, interest)
+		}
+		filter.interests = true
 	case "likes_contains":
 		likes := strings.Split(value, ",")
 		for _, like := range likes {
@@ -431,6 +722,50 @@ func (filter *Filter) ParseParam(param string, value string) error {
 			filter.LikesContains = append(filter.LikesContains, uint32(ui64))
 		}
 		filter.likes = true
+	case "likes_any":
+		likes := strings.Split(value, ",")
+		for _, like := range likes {
+			ui64, err := strconv.ParseUint(like, 10, 32)
+			if err != nil {
+				return err
+			}
+			filter.LikesAny = append(filter.LikesAny, uint32(ui64))
+		}
+		filter.likes = true
+	// likes_count_* filter by accounts liked by account and liked_count_* by
+	// accounts which liked account, repeated likes of the same pair count once
+	case "likes_count_gt":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		filter.LikesCountGt = uint32(ui64)
+		filter.LikesCountGtSet = true
+		filter.likes = true
+	case "likes_count_lt":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		filter.LikesCountLt = uint32(ui64)
+		filter.LikesCountLtSet = true
+		filter.likes = true
+	case "liked_count_gt":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		filter.LikedCountGt = uint32(ui64)
+		filter.LikedCountGtSet = true
+		filter.likes = true
+	case "liked_count_lt":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		filter.LikedCountLt = uint32(ui64)
+		filter.LikedCountLtSet = true
+		filter.likes = true
 	case "premium_now":
 		filter.PremiumNow = true
 		filter.premium = true
@@ -438,12 +773,39 @@ func (filter *Filter) ParseParam(param string, value string) error {
 		filter.PremiumNull = value == "1"
 		filter.PremiumNullSet = true
 		filter.premium = true
+	case "q":
+		query, err := ParseQuery(filter.parser, filter.dicts, value)
+		if err != nil {
+			return err
+		}
+		filter.Query = query
+		filter.query = true
+		query.Walk(filter.markQueryField)
 	case "limit":
 		ui64, err := strconv.ParseUint(value, 10, 8)
 		if err != nil {
 			return errors.New("Invalid limit value")
 		}
 		filter.limit = int(ui64)
+	case "count":
+		filter.count = value == "1"
+	case "explain":
+		filter.explain = value == "1"
+	case "fuzzy":
+		filter.fuzzy = value == "1"
+	case "sample":
+		ui64, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || ui64 == 0 {
+			return errors.New("Invalid sample value")
+		}
+		filter.sample = int(ui64)
+	case "seed":
+		i64, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("Invalid seed value")
+		}
+		filter.seed = i64
+		filter.seedSet = true
 	case "query_id":
 		// filter.queryID = value
 	default:
@@ -453,6 +815,92 @@ func (filter *Filter) ParseParam(param string, value string) error {
 	return nil
 }
 
+func (filter *Filter) setAgeMin(age uint16) {
+	if !filter.AgeMinSet || age > filter.AgeMin {
+		filter.AgeMin = age
+		filter.AgeMinSet = true
+	}
+}
+
+func (filter *Filter) setAgeMax(age uint16) {
+	if !filter.AgeMaxSet || age < filter.AgeMax {
+		filter.AgeMax = age
+		filter.AgeMaxSet = true
+	}
+}
+
+func (filter *Filter) Age() bool {
+	return filter.AgeMinSet || filter.AgeMaxSet
+}
+
+func (filter *Filter) markQueryField(node *QueryNode) {
+	if node.Op != QueryPred {
+		return
+	}
+	switch node.Field {
+	case QuerySex:
+		filter.sex = true
+	case QueryStatus:
+		filter.status = true
+	case QueryFname:
+		filter.fname = true
+	case QuerySname:
+		filter.sname = true
+	case QueryPhoneCode:
+		filter.phone = true
+	case QueryCountry:
+		filter.country = true
+	case QueryCity:
+		filter.city = true
+	case QueryBirth, QueryBirthYear:
+		filter.birth = true
+	case QueryInterests:
+		filter.interests = true
+	case QueryLikes:
+		filter.likes = true
+	case QueryPremium:
+		filter.premium = true
+	case QueryEmailDomain:
+		filter.email = true
+	}
+}
+
+func containsFname(fnames []Fname, fname Fname) bool {
+	for _, f := range fnames {
+		if f == fname {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCountry(countries []Country, country Country) bool {
+	for _, c := range countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCity(cities []City, city City) bool {
+	for _, c := range cities {
+		if c == city {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPhoneCode(phoneCodes []uint16, phoneCode uint16) bool {
+	for _, c := range phoneCodes {
+		if c == phoneCode {
+			return true
+		}
+	}
+	return false
+}
+
 func YearToTimestamp(year Year) (gte, lte int64) {
 	gte = time.Date(int(year), 1, 1, 0, 0, 0, 0, time.UTC).Unix()
 	lte = time.Date(int(year)+1, 1, 1, 0, 0, 0, 0, time.UTC).Unix() - 1
@@ -460,6 +908,32 @@ func YearToTimestamp(year Year) (gte, lte int64) {
 	return
 }
 
+const secondsInYear = 365.2425 * 24 * 60 * 60
+
+// AgeAt returns full years passed from birth till now, birthday is
+// compared by month, day and time of day, so leap years do not shift it.
+func AgeAt(birth int64, now uint32) int {
+	b := time.Unix(birth, 0).UTC()
+	n := time.Unix(int64(now), 0).UTC()
+	age := n.Year() - b.Year()
+	if n.Month() != b.Month() {
+		if n.Month() < b.Month() {
+			age--
+		}
+		return age
+	}
+	if n.Day() != b.Day() {
+		if n.Day() < b.Day() {
+			age--
+		}
+		return age
+	}
+	if n.Hour()*3600+n.Minute()*60+n.Second() < b.Hour()*3600+b.Minute()*60+b.Second() {
+		age--
+	}
+	return age
+}
+
 func parseTimestamp(timestamp string) (int64, error) {
 	ts, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
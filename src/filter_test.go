@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testRepeatedLikes likes account 1 twice.
+const testRepeatedLikes = `,
+{"id": 7, "email": "oleg@mail.ru", "sex": "m", "birth": 631152000, "joined": 1420070400, "status": "свободны", "likes": [{"id": 1, "ts": 1500000000}, {"id": 4, "ts": 1500000000}, {"id": 1, "ts": 1510000000}]}
+`
+
+func TestFilterLikes(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testRepeatedLikes)
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"likes_any": {"2,5"}}, IDS{6, 3, 1}},
+		{url.Values{"likes_any": {"4,6"}}, IDS{7}},
+		{url.Values{"likes_contains": {"1,2"}}, IDS{3}},
+		{url.Values{"likes_count_gt": {"1"}}, IDS{7, 6, 3, 1}},
+		{url.Values{"likes_count_lt": {"1"}}, IDS{5}},
+		// repeated likes of account 7 count once
+		{url.Values{"likes_count_gt": {"1"}, "likes_count_lt": {"3"}}, IDS{7, 6, 3, 1}},
+		{url.Values{"liked_count_gt": {"3"}, "liked_count_lt": {"5"}}, IDS{1}},
+		{url.Values{"liked_count_lt": {"1"}}, IDS{7, 6}},
+		{url.Values{"liked_count_gt": {"1"}, "sex_eq": {"f"}}, IDS{3, 2}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+}
+
+func TestFilterLikesAdded(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testRepeatedLikes)
+	store.index.RunWorker()
+
+	// the second like of the same pair is not counted
+	for i := 0; i < 2; i++ {
+		likes := &Likes{likes: []Like{{Liker: 5, Likee: 1, Ts: 1540000000}}}
+		err := store.AddLikes(likes, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.index.worker.Wait()
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"liked_count_gt": {"4"}}, IDS{1}},
+		{url.Values{"liked_count_gt": {"5"}}, IDS{}},
+		{url.Values{"likes_count_gt": {"0"}, "likes_count_lt": {"2"}}, IDS{5, 4, 2}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+}
+
+func TestFilterNegative(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"sex_neq": {"m"}}, IDS{5, 3, 2}},
+		{url.Values{"sex_nany": {"f"}}, IDS{6, 4, 1}},
+		{url.Values{"sex_nany": {"m,f"}}, IDS{}},
+		{url.Values{"status_neq": {"свободны"}}, IDS{6, 4, 3}},
+		{url.Values{"status_any": {"заняты,всё сложно"}}, IDS{6, 4, 3}},
+		// accounts without value are not excluded
+		{url.Values{"fname_neq": {"Иван"}}, IDS{6, 5, 4, 3, 2}},
+		{url.Values{"fname_nany": {"Иван,Анна,Unknown"}}, IDS{6, 5, 4, 3}},
+		{url.Values{"phone_code_nany": {"912"}}, IDS{6, 5, 4, 3, 2}},
+		{url.Values{"phone_code_nany": {"912,903"}}, IDS{6, 5, 4, 2}},
+		{url.Values{"country_nany": {"Росмаль,Испания"}}, IDS{4, 3}},
+		{url.Values{"city_neq": {"Москва"}}, IDS{5, 4, 3}},
+		{url.Values{"sex_neq": {"m"}, "city_nany": {"Москва,Мадрид"}}, IDS{3}},
+		{url.Values{"interests_none": {"Спорт,Кино"}}, IDS{5}},
+		{url.Values{"interests_none": {"Unknown"}}, IDS{6, 5, 4, 3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+}
+
+func TestAgeAt(t *testing.T) {
+	tests := []struct {
+		birth time.Time
+		now   time.Time
+		want  int
+	}{
+		{time.Date(1990, 6, 15, 12, 0, 0, 0, time.UTC), time.Date(2018, 6, 15, 11, 59, 59, 0, time.UTC), 27},
+		{time.Date(1990, 6, 15, 12, 0, 0, 0, time.UTC), time.Date(2018, 6, 15, 12, 0, 0, 0, time.UTC), 28},
+		{time.Date(1990, 6, 15, 0, 0, 0, 0, time.UTC), time.Date(2018, 6, 14, 23, 0, 0, 0, time.UTC), 27},
+		{time.Date(1990, 6, 15, 0, 0, 0, 0, time.UTC), time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC), 28},
+		{time.Date(1990, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), 28},
+		// born on leap day is one year older since March 1
+		{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2018, 2, 28, 23, 59, 59, 0, time.UTC), 17},
+		{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), 18},
+		{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), 19},
+		{time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), 20},
+		// born on March 1 of leap year is not older on February 29
+		{time.Date(2000, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), 19},
+		{time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, 12, 16, 0, 0, 0, 0, time.UTC), 58},
+	}
+
+	for _, test := range tests {
+		if got := AgeAt(test.birth.Unix(), uint32(test.now.Unix())); got != test.want {
+			t.Errorf("AgeAt(%s, %s) = %d, want %d", test.birth, test.now, got, test.want)
+		}
+	}
+}
+
+// testBirthdays are born on 2000-12-16 before and after testNow time.
+const testBirthdays = `,
+{"id": 8, "email": "before@mail.ru", "sex": "m", "birth": 976924800, "joined": 1420070400, "status": "свободны"},
+{"id": 9, "email": "after@mail.ru", "sex": "m", "birth": 977007600, "joined": 1420070400, "status": "свободны"}
+`
+
+func TestFilterAge(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testBirthdays)
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"age_gt": {"27"}}, IDS{4, 1}},
+		{url.Values{"age_lt": {"19"}}, IDS{9, 8, 6, 3}},
+		{url.Values{"age_lt": {"18"}}, IDS{9}},
+		{url.Values{"age_between": {"18,18"}}, IDS{8, 6, 3}},
+		{url.Values{"age_between": {"22,28"}}, IDS{5, 2, 1}},
+		{url.Values{"age_between": {"18,22"}, "sex_eq": {"f"}}, IDS{5, 3}},
+		{url.Values{"age_lt": {"0"}}, IDS{}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+
+	for _, query := range []string{"age_between=30,20&limit=1", "age_between=20&limit=1", "age_gt=x&limit=1", "age_lt=300&limit=1"} {
+		filter := NewFilter(parser, dicts)
+		filter.Reset()
+		if err := filter.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+// testSamePhone has the same phone as account 1.
+const testSamePhone = `,
+{"id": 10, "email": "same@mail.ru", "phone": "8(912)1234567", "sex": "f", "birth": 631152000, "joined": 1420070400, "status": "свободны"}
+`
+
+func TestFilterPhone(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testSamePhone)
+
+	tests := []struct {
+		params url.Values
+		want   IDS
+	}{
+		{url.Values{"phone_eq": {"8(912)1234567"}}, IDS{10, 1}},
+		{url.Values{"phone_eq": {"8(912)1234567"}, "sex_eq": {"m"}}, IDS{1}},
+		{url.Values{"phone_eq": {"8(912)0000000"}}, IDS{}},
+		{url.Values{"phone_starts": {"8(912)"}}, IDS{10, 1}},
+		{url.Values{"phone_starts": {"8(9"}}, IDS{10, 3, 1}},
+		{url.Values{"phone_starts": {"8(9"}, "phone_code": {"903"}}, IDS{3}},
+		{url.Values{"phone_null": {"1"}}, IDS{6, 5, 4, 2}},
+		{url.Values{"phone_null": {"0"}}, IDS{10, 3, 1}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), got, test.want)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/base64"
+	"math/bits"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"unsafe"
 
 	"github.com/pkg/errors"
 )
@@ -13,6 +16,7 @@ import (
 type (
 	GroupKey  byte
 	GroupHash uint64
+	GroupAgg  byte
 )
 
 const (
@@ -28,7 +32,8 @@ const (
 
 const (
 	GroupSexMask       GroupHash = 255
-	GroupStatusMask    GroupHash = 255 << 8
+	GroupStatusMask    GroupHash = 15 << 8
+	GroupLikesMask     GroupHash = 15 << 12 // likes bucket, scan only
 	GroupCityMask      GroupHash = (256*256 - 1) << 16
 	GroupCountryMask   GroupHash = 255 << 32
 	GroupInterestsMask GroupHash = 255 << 40
@@ -36,6 +41,19 @@ const (
 	GroupBirthMask     GroupHash = 255 << 56
 )
 
+const (
+	GroupAggAvgAge GroupAgg = 1 << iota
+	GroupAggMinAge
+	GroupAggMaxAge
+	GroupAggPremiumShare
+	GroupAggAvgInterests
+	GroupAggAvgLikes
+)
+
+// Min and max cannot be kept on Sub and likes received change on
+// every like, so these are computed by scan only.
+const GroupAggScanOnly = GroupAggMinAge | GroupAggMaxAge | GroupAggAvgLikes
+
 // https://github.com/MailRuChamps/hlcupdocs/issues/119#issuecomment-450162555
 type GroupFilter struct {
 	Sex           byte
@@ -60,8 +78,11 @@ type Group struct {
 	expectEmpty bool
 	noFilter    bool
 	limit       int
+	offset      int
+	paged       bool // offset or cursor is given
 	orderAsc    bool
 	orderDesc   bool
+	sortKey     bool
 
 	// Filter
 	Filter     GroupFilter
@@ -71,6 +92,7 @@ type Group struct {
 	Keys      []GroupKey
 	KeysMask  GroupHash
 	GroupHash GroupHash
+	Agg       GroupAgg
 }
 
 var groupsPool = sync.Pool{
@@ -104,8 +126,11 @@ func (group *Group) Reset() {
 	group.expectEmpty = false
 	group.noFilter = true
 	group.limit = 0
+	group.offset = 0
+	group.paged = false
 	group.orderAsc = false
 	group.orderDesc = false
+	group.sortKey = false
 	group.Filter.Sex = 0
 	group.Filter.Status = 0
 	group.Filter.Country = 0
@@ -122,6 +147,7 @@ func (group *Group) Reset() {
 	group.Keys = group.Keys[:0]
 	group.KeysMask = 0
 	group.GroupHash = 0
+	group.Agg = 0
 }
 
 func (group *Group) ExpectEmpty() bool {
@@ -144,6 +170,21 @@ func (group *Group) Limit() int {
 	return group.limit
 }
 
+func (group *Group) Offset() int {
+	return group.offset
+}
+
+// Paged reports whether offset or cursor is given, only such requests
+// get cursor of the next page.
+func (group *Group) Paged() bool {
+	return group.paged
+}
+
+// SortKey reports whether groups are ordered by keys instead of count.
+func (group *Group) SortKey() bool {
+	return group.sortKey
+}
+
 func (group *Group) Parse(query string) error {
 	values, err := url.ParseQuery(query)
 	if err != nil {
@@ -170,9 +211,18 @@ func (group *Group) Parse(query string) error {
 	}
 
 	if !group.orderAsc && !group.orderDesc {
-		return errors.New("Order should be specified")
+		if !group.sortKey {
+			return errors.New("Order should be specified")
+		}
+		group.orderAsc = true
 	}
 
+	group.updateNoFilter()
+
+	return nil
+}
+
+func (group *Group) updateNoFilter() {
 	group.noFilter = group.Filter.Sex == 0 &&
 		group.Filter.Status == 0 &&
 		group.Filter.Country == 0 &&
@@ -181,8 +231,28 @@ func (group *Group) Parse(query string) error {
 		group.Filter.Interests == 0 &&
 		group.Filter.Likes == 0 &&
 		group.Filter.JoinedYear == 0
+}
 
-	return nil
+func ParseGroupKey(key string) (GroupKey, GroupHash, error) {
+	switch key {
+	case "sex":
+		return GroupSex, GroupSexMask, nil
+	case "status":
+		return GroupStatus, GroupStatusMask, nil
+	case "interests":
+		return GroupInterests, GroupInterestsMask, nil
+	case "country":
+		return GroupCountry, GroupCountryMask, nil
+	case "city":
+		return GroupCity, GroupCityMask, nil
+	case "birth":
+		return GroupBirth, GroupBirthMask, nil
+	case "joined":
+		return GroupJoined, GroupJoinedMask, nil
+	case "likes_bucket":
+		return GroupLikes, GroupLikesMask, nil
+	}
+	return 0, 0, errors.New("Unknown group key " + key)
 }
 
 func (group *Group) HasKey(hash GroupHash) bool {
@@ -195,24 +265,30 @@ func (group *Group) ParseParam(param string, value string) error {
 	switch param {
 	case "keys":
 		for _, key := range strings.Split(value, ",") {
-			switch key {
-			case "sex":
-				group.Keys = append(group.Keys, GroupSex)
-				group.KeysMask |= GroupSexMask
-			case "status":
-				group.Keys = append(group.Keys, GroupStatus)
-				group.KeysMask |= GroupStatusMask
-			case "interests":
-				group.Keys = append(group.Keys, GroupInterests)
-				group.KeysMask |= GroupInterestsMask
-			case "country":
-				group.Keys = append(group.Keys, GroupCountry)
-				group.KeysMask |= GroupCountryMask
-			case "city":
-				group.Keys = append(group.Keys, GroupCity)
-				group.KeysMask |= GroupCityMask
+			groupKey, mask, err := ParseGroupKey(key)
+			if err != nil {
+				return err
+			}
+			group.Keys = append(group.Keys, groupKey)
+			group.KeysMask |= mask
+		}
+	case "agg":
+		for _, agg := range strings.Split(value, ",") {
+			switch agg {
+			case "avg_age":
+				group.Agg |= GroupAggAvgAge
+			case "min_age":
+				group.Agg |= GroupAggMinAge
+			case "max_age":
+				group.Agg |= GroupAggMaxAge
+			case "premium_share":
+				group.Agg |= GroupAggPremiumShare
+			case "avg_interests":
+				group.Agg |= GroupAggAvgInterests
+			case "avg_likes":
+				group.Agg |= GroupAggAvgLikes
 			default:
-				return errors.New("Unknown group key " + key)
+				return errors.New("Unknown group agg " + agg)
 			}
 		}
 	case "sex":
@@ -306,6 +382,29 @@ func (group *Group) ParseParam(param string, value string) error {
 			return errors.New("Invalid limit value")
 		}
 		group.limit = int(ui64)
+	case "offset":
+		ui64, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			return errors.New("Invalid offset value")
+		}
+		group.offset = int(ui64)
+		group.paged = true
+	case "cursor":
+		offset, err := DecodeGroupCursor(value)
+		if err != nil {
+			return err
+		}
+		group.offset = offset
+		group.paged = true
+	case "sort":
+		switch value {
+		case "count":
+			group.sortKey = false
+		case "key":
+			group.sortKey = true
+		default:
+			return errors.New("Invalid sort value")
+		}
 	case "query_id":
 		// group.queryID = value
 	default:
@@ -315,6 +414,85 @@ func (group *Group) ParseParam(param string, value string) error {
 	return nil
 }
 
+// Cursor is just the offset of the next page encoded for clients, so
+// groups changed between requests may shift pages.
+func EncodeGroupCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o" + strconv.Itoa(offset)))
+}
+
+func DecodeGroupCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < 2 || b[0] != 'o' {
+		return 0, errors.New("Invalid cursor value")
+	}
+	ui64, err := strconv.ParseUint(string(b[1:]), 10, 31)
+	if err != nil {
+		return 0, errors.New("Invalid cursor value")
+	}
+	return int(ui64), nil
+}
+
+// isKeyLess compares entries by decoded values of keys in order they
+// were requested, nulls go first.
+func (group *Group) isKeyLess(a, b *GroupEntry) bool {
+	for _, key := range group.Keys {
+		if comp := group.compareKey(key, a, b); comp != 0 {
+			return comp < 0
+		}
+	}
+	return a.Count < b.Count
+}
+
+func (group *Group) compareKey(key GroupKey, a, b *GroupEntry) int {
+	switch key {
+	case GroupSex:
+		return compareInts(int(a.GetSex()), int(b.GetSex()))
+	case GroupStatus:
+		return strings.Compare(statusString(a.GetStatus()), statusString(b.GetStatus()))
+	case GroupInterests:
+		interestA, _ := group.dicts.GetInterestString(a.GetInterest())
+		interestB, _ := group.dicts.GetInterestString(b.GetInterest())
+		return strings.Compare(interestA, interestB)
+	case GroupCountry:
+		countryA, _ := group.dicts.GetCountryString(a.GetCountry())
+		countryB, _ := group.dicts.GetCountryString(b.GetCountry())
+		return strings.Compare(countryA, countryB)
+	case GroupCity:
+		cityA, _ := group.dicts.GetCityString(a.GetCity())
+		cityB, _ := group.dicts.GetCityString(b.GetCity())
+		return strings.Compare(cityA, cityB)
+	case GroupBirth:
+		return compareInts(int(a.GetBirth()), int(b.GetBirth()))
+	case GroupJoined:
+		return compareInts(int(a.GetJoined()), int(b.GetJoined()))
+	case GroupLikes:
+		return compareInts(int(a.GetLikesBucket()), int(b.GetLikesBucket()))
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func statusString(status byte) string {
+	switch status {
+	case StatusSingle:
+		return StatusSingleString
+	case StatusRelationship:
+		return StatusRelationshipString
+	case StatusComplicated:
+		return StatusComplicatedString
+	}
+	return ""
+}
+
 type GroupEntry struct {
 	// Sex      byte     // 2
 	// Status   byte     // 3
@@ -327,6 +505,49 @@ type GroupEntry struct {
 	Count uint32
 }
 
+// GroupStats keeps sums of accounts in group entry for agg functions.
+type GroupStats struct {
+	BirthSum  int64
+	BirthMin  int64
+	BirthMax  int64
+	Premium   uint32
+	Interests uint32
+	Likes     uint32
+}
+
+func CreateStatsFromAccount(account *Account, premium bool) GroupStats {
+	stats := GroupStats{
+		BirthSum:  account.Birth,
+		BirthMin:  account.Birth,
+		BirthMax:  account.Birth,
+		Interests: uint32(len(account.Interests)),
+	}
+	if premium {
+		stats.Premium = 1
+	}
+	return stats
+}
+
+func (stats *GroupStats) Add(sample *GroupStats) {
+	stats.BirthSum += sample.BirthSum
+	if sample.BirthMin < stats.BirthMin {
+		stats.BirthMin = sample.BirthMin
+	}
+	if sample.BirthMax > stats.BirthMax {
+		stats.BirthMax = sample.BirthMax
+	}
+	stats.Premium += sample.Premium
+	stats.Interests += sample.Interests
+	stats.Likes += sample.Likes
+}
+
+func (stats *GroupStats) Sub(sample *GroupStats) {
+	stats.BirthSum -= sample.BirthSum
+	stats.Premium -= sample.Premium
+	stats.Interests -= sample.Interests
+	stats.Likes -= sample.Likes
+}
+
 // func NewGroupEntry(hash GroupHash) *GroupEntry {
 // 	return &GroupEntry{Hash: hash, Count: 1}
 // }
@@ -345,7 +566,7 @@ func (entry *GroupEntry) SetSex(sex byte) {
 }
 
 func (entry *GroupEntry) GetStatus() byte {
-	return byte(entry.Hash >> 8)
+	return byte((entry.Hash & GroupStatusMask) >> 8)
 }
 
 func (entry *GroupEntry) SetStatus(status byte) {
@@ -392,6 +613,14 @@ func (entry *GroupEntry) SetBirth(birth Year) {
 	entry.Hash = entry.Hash&(^GroupBirthMask) | GroupHash(byte(birth-1949))<<56
 }
 
+func (entry *GroupEntry) GetLikesBucket() byte {
+	return byte((entry.Hash & GroupLikesMask) >> 12)
+}
+
+func (entry *GroupEntry) SetLikesBucket(bucket byte) {
+	entry.Hash = entry.Hash&(^GroupLikesMask) | GroupHash(bucket&15)<<12
+}
+
 func (entry *GroupEntry) GetHash() GroupHash {
 	return entry.Hash
 }
@@ -400,6 +629,7 @@ type Aggregation struct {
 	dicts     *Dicts
 	groupMask GroupHash
 	entries   []GroupEntry
+	stats     map[GroupHash]*GroupStats // by entry hash, only for agg samples
 	rwLock    sync.RWMutex
 }
 
@@ -434,15 +664,18 @@ func (ag *Aggregation) Release() {
 func (ag *Aggregation) Reset() {
 	ag.groupMask = 0
 	ag.entries = ag.entries[:0]
+	ag.stats = nil
 }
 
-func (ag *Aggregation) Append(hash GroupHash) {
+// Append, Add and Sub accumulate stats sample when it is not nil.
+func (ag *Aggregation) Append(hash GroupHash, sample *GroupStats) {
 	ag.rwLock.Lock()
 	// ag.rwLock.RLock()
 	for i := range ag.entries {
 		if ag.entries[i].Hash == hash&ag.groupMask {
 			// ag.rwLock.RUnlock()
 			ag.entries[i].Count++
+			ag.addStats(hash&ag.groupMask, sample)
 			ag.rwLock.Unlock()
 			return
 		}
@@ -450,10 +683,11 @@ func (ag *Aggregation) Append(hash GroupHash) {
 	// ag.rwLock.RUnlock()
 	// ag.rwLock.Lock()
 	ag.entries = append(ag.entries, GroupEntry{Hash: hash & ag.groupMask, Count: 1})
+	ag.addStats(hash&ag.groupMask, sample)
 	ag.rwLock.Unlock()
 }
 
-func (ag *Aggregation) Add(hash GroupHash) {
+func (ag *Aggregation) Add(hash GroupHash, sample *GroupStats) {
 	// ag.rwLock.RLock()
 	ag.rwLock.Lock()
 	index := 0
@@ -463,6 +697,7 @@ func (ag *Aggregation) Add(hash GroupHash) {
 		if entry.Hash == hash&ag.groupMask {
 			// ag.rwLock.RUnlock()
 			entry.Count++
+			ag.addStats(entry.Hash, sample)
 			founded = true
 			index = i
 			break
@@ -476,6 +711,7 @@ func (ag *Aggregation) Add(hash GroupHash) {
 		copy(ag.entries[1:], ag.entries[:])
 		ag.entries[0].Hash = hash & ag.groupMask
 		ag.entries[0].Count = 1
+		ag.addStats(ag.entries[0].Hash, sample)
 		// ag.rwLock.Unlock()
 	}
 	// ag.rwLock.RLock()
@@ -492,7 +728,7 @@ func (ag *Aggregation) Add(hash GroupHash) {
 	ag.rwLock.Unlock()
 }
 
-func (ag *Aggregation) Sub(hash GroupHash) {
+func (ag *Aggregation) Sub(hash GroupHash, sample *GroupStats) {
 	// ag.rwLock.RLock()
 	ag.rwLock.Lock()
 	index := 0
@@ -500,7 +736,11 @@ func (ag *Aggregation) Sub(hash GroupHash) {
 		if ag.entries[i].Hash == hash&ag.groupMask {
 			// ag.rwLock.RUnlock()
 			ag.entries[i].Count--
+			if stats, ok := ag.stats[ag.entries[i].Hash]; ok && sample != nil {
+				stats.Sub(sample)
+			}
 			if ag.entries[i].Count == 0 {
+				delete(ag.stats, ag.entries[i].Hash)
 				// ag.rwLock.Lock()
 				ag.entries = append(ag.entries[:i], ag.entries[i+1:]...)
 				ag.rwLock.Unlock()
@@ -524,6 +764,33 @@ func (ag *Aggregation) Sub(hash GroupHash) {
 	ag.rwLock.Unlock()
 }
 
+// addStats accumulates sample of entry, should be called under lock.
+func (ag *Aggregation) addStats(hash GroupHash, sample *GroupStats) {
+	if sample == nil {
+		return
+	}
+	if stats, ok := ag.stats[hash]; ok {
+		stats.Add(sample)
+		return
+	}
+	if ag.stats == nil {
+		ag.stats = make(map[GroupHash]*GroupStats)
+	}
+	stats := *sample
+	ag.stats[hash] = &stats
+}
+
+// Stats returns copy of stats of entry, nil when samples were not given.
+func (ag *Aggregation) Stats(hash GroupHash) *GroupStats {
+	ag.rwLock.RLock()
+	defer ag.rwLock.RUnlock()
+	if stats, ok := ag.stats[hash]; ok {
+		copied := *stats
+		return &copied
+	}
+	return nil
+}
+
 func (ag *Aggregation) Update() {
 	ag.rwLock.Lock()
 	sort.Sort(ag)
@@ -534,6 +801,15 @@ func (ag *Aggregation) Get() []GroupEntry {
 	return ag.entries
 }
 
+// Memory returns approximate size of aggregation in bytes.
+func (ag *Aggregation) Memory() int {
+	ag.rwLock.RLock()
+	size := int(unsafe.Sizeof(*ag)) + cap(ag.entries)*int(unsafe.Sizeof(GroupEntry{}))
+	size += len(ag.stats) * int(unsafe.Sizeof(GroupHash(0))+unsafe.Sizeof(GroupStats{}))
+	ag.rwLock.RUnlock()
+	return size
+}
+
 func (ag *Aggregation) Len() int { return len(ag.entries) }
 func (ag *Aggregation) Swap(i, j int) {
 	ag.entries[i], ag.entries[j] = ag.entries[j], ag.entries[i]
@@ -611,6 +887,27 @@ func (ag *Aggregation) isGroupLess(a, b *GroupEntry) bool {
 			return false
 		}
 	}
+	if ag.groupMask&GroupBirthMask > 0 {
+		if a.GetBirth() < b.GetBirth() {
+			return true
+		} else if a.GetBirth() > b.GetBirth() {
+			return false
+		}
+	}
+	if ag.groupMask&GroupJoinedMask > 0 {
+		if a.GetJoined() < b.GetJoined() {
+			return true
+		} else if a.GetJoined() > b.GetJoined() {
+			return false
+		}
+	}
+	if ag.groupMask&GroupLikesMask > 0 {
+		if a.GetLikesBucket() < b.GetLikesBucket() {
+			return true
+		} else if a.GetLikesBucket() > b.GetLikesBucket() {
+			return false
+		}
+	}
 	return false
 }
 
@@ -635,7 +932,7 @@ func (hash *GroupHash) SetSex(sex byte) {
 }
 
 func (hash *GroupHash) GetStatus() byte {
-	return byte(*hash >> 8)
+	return byte((*hash & GroupStatusMask) >> 8)
 }
 
 func (hash *GroupHash) SetStatus(status byte) {
@@ -681,3 +978,29 @@ func (hash *GroupHash) GetBirth() Year {
 func (hash *GroupHash) SetBirth(birth Year) {
 	*hash = *hash&(^GroupBirthMask) | GroupHash(byte(birth-1949))<<56
 }
+
+func (hash *GroupHash) GetLikesBucket() byte {
+	return byte((*hash & GroupLikesMask) >> 12)
+}
+
+func (hash *GroupHash) SetLikesBucket(bucket byte) {
+	*hash = *hash&(^GroupLikesMask) | GroupHash(bucket&15)<<12
+}
+
+// LikesBucket returns bucket of likes count, bucket n > 0 holds
+// counts from 2^(n-1) to 2^n-1, the last one holds all larger.
+func LikesBucket(count uint32) byte {
+	bucket := bits.Len32(count)
+	if bucket > 15 {
+		bucket = 15
+	}
+	return byte(bucket)
+}
+
+// LikesBucketMin returns the least likes count in bucket.
+func LikesBucketMin(bucket byte) uint32 {
+	if bucket == 0 {
+		return 0
+	}
+	return 1 << (bucket - 1)
+}
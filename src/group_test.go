@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// groupJSON runs group by query and returns response body.
+func groupJSON(t *testing.T, store *Store, parser *Parser, dicts *Dicts, query string) string {
+	group := BorrowGroup(parser, dicts)
+	defer group.Release()
+	err := group.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	groups := BorrowGroupsBuffer()
+	defer groups.Release()
+	store.Group(group, groups)
+
+	var buffer bytes.Buffer
+	parser.EncodeGroupEntries(groups, &buffer)
+	return buffer.String()
+}
+
+func TestGroupYears(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"keys=birth&order=1&limit=10", `{"groups":[{"birth":1980,"count":1},{"birth":1990,"count":1},{"birth":1991,"count":1},{"birth":1996,"count":1},{"birth":2000,"count":2}]}`},
+		{"keys=joined&order=-1&limit=3", `{"groups":[{"joined":2015,"count":2},{"joined":2018,"count":1},{"joined":2017,"count":1}]}`},
+		{"keys=joined,sex&order=1&limit=10", `{"groups":[{"sex":"f","joined":2015,"count":1},{"sex":"f","joined":2016,"count":1},{"sex":"f","joined":2017,"count":1},{"sex":"m","joined":2012,"count":1},{"sex":"m","joined":2015,"count":1},{"sex":"m","joined":2018,"count":1}]}`},
+		{"keys=birth&country=Росмаль&order=-1&limit=10", `{"groups":[{"birth":2000,"count":1},{"birth":1991,"count":1},{"birth":1990,"count":1}]}`},
+		{"keys=country&birth=2000&order=1&limit=10", `{"groups":[{"country":"Германия","count":1},{"country":"Росмаль","count":1}]}`},
+		{"keys=sex&joined=2015&order=1&limit=10", `{"groups":[{"sex":"f","count":1},{"sex":"m","count":1}]}`},
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"keys=birth&birth=x&order=1&limit=1", "keys=joined&joined=x&order=1&limit=1", "keys=year&order=1&limit=1"} {
+		group := BorrowGroup(parser, dicts)
+		if err := group.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		group.Release()
+	}
+}
+
+func TestGroupAgg(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+	statsStore, statsParser, statsDicts := newTestStore(t, testAccounts, func(store *Store) {
+		store.SetGroupStats(true)
+	})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"keys=sex&agg=avg_age,min_age,max_age,premium_share,avg_interests,avg_likes&order=1&limit=10", `{"groups":[{"sex":"f","count":3,"avg_age":23.29,"min_age":18,"max_age":27,"premium_share":0,"avg_interests":1,"avg_likes":1.67},{"sex":"m","count":3,"avg_age":28.91,"min_age":18,"max_age":38,"premium_share":0.33,"avg_interests":2.33,"avg_likes":1}]}`},
+		{"keys=country&agg=avg_likes,premium_share&order=-1&limit=10", `{"groups":[{"country":"Росмаль","count":3,"premium_share":0.33,"avg_likes":1.67},{"country":"Испания","count":1,"premium_share":0,"avg_likes":1},{"country":"Германия","count":1,"premium_share":0,"avg_likes":2},{"count":1,"premium_share":0,"avg_likes":0}]}`},
+		{"keys=interests&agg=min_age,max_age&order=1&limit=10", `{"groups":[{"interests":"Книги","count":2,"min_age":18,"max_age":38},{"interests":"Музыка","count":2,"min_age":27,"max_age":38},{"interests":"Кино","count":3,"min_age":18,"max_age":28},{"interests":"Спорт","count":3,"min_age":27,"max_age":38}]}`},
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+		// sums kept in precomputed indexes give the same values
+		if got := groupJSON(t, statsStore, statsParser, statsDicts, test.query); got != test.want {
+			t.Errorf("%s with group stats:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"keys=sex&agg=age_avg&order=1&limit=1", "keys=sex&agg=&order=1&limit=1"} {
+		group := BorrowGroup(parser, dicts)
+		if err := group.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		group.Release()
+	}
+}
+
+func TestLikesBucket(t *testing.T) {
+	tests := []struct {
+		count  uint32
+		bucket byte
+		min    uint32
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{2, 2, 2},
+		{3, 2, 2},
+		{4, 3, 4},
+		{1023, 10, 512},
+		{1024, 11, 1024},
+		{1 << 20, 15, 1 << 14},
+	}
+
+	for _, test := range tests {
+		bucket := LikesBucket(test.count)
+		if bucket != test.bucket {
+			t.Errorf("LikesBucket(%d) = %d, want %d", test.count, bucket, test.bucket)
+		}
+		if min := LikesBucketMin(bucket); min != test.min {
+			t.Errorf("LikesBucketMin(%d) = %d, want %d", bucket, min, test.min)
+		}
+	}
+}
+
+func TestGroupLikesBucket(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testRepeatedLikes)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// bucket is shown by the least likes count in it, account 1 is liked 4 times
+		{"keys=likes_bucket&order=1&limit=10", `{"groups":[{"likes_bucket":4,"count":1},{"likes_bucket":0,"count":2},{"likes_bucket":1,"count":2},{"likes_bucket":2,"count":2}]}`},
+		{"keys=likes_bucket,sex&order=-1&limit=10", `{"groups":[{"sex":"m","likes_bucket":0,"count":2},{"sex":"f","likes_bucket":2,"count":2},{"sex":"m","likes_bucket":4,"count":1},{"sex":"m","likes_bucket":1,"count":1},{"sex":"f","likes_bucket":1,"count":1}]}`},
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestGroupCursor(t *testing.T) {
+	tests := []struct {
+		cursor string
+		offset int
+		err    bool
+	}{
+		{"bzE", 1, false},
+		{"bzI", 2, false},
+		{"bzEwMA", 100, false},
+		{"", 0, true},
+		{"x", 0, true},
+		{"bw", 0, true},
+		{"bzE=", 0, true},
+		{"cDE", 0, true},
+		{"b3g", 0, true},
+		{"by0x", 0, true},
+	}
+
+	for _, test := range tests {
+		offset, err := DecodeGroupCursor(test.cursor)
+		if test.err != (err != nil) {
+			t.Errorf("DecodeGroupCursor(%q) error %v", test.cursor, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if offset != test.offset {
+			t.Errorf("DecodeGroupCursor(%q) = %d, want %d", test.cursor, offset, test.offset)
+		}
+		if cursor := EncodeGroupCursor(offset); cursor != test.cursor {
+			t.Errorf("EncodeGroupCursor(%d) = %s, want %s", offset, cursor, test.cursor)
+		}
+	}
+}
+
+func TestGroupPages(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// next page is given only when offset or cursor is
+		{"keys=status&order=1&limit=2", `{"groups":[{"status":"всё сложно","count":1},{"status":"заняты","count":2}]}`},
+		{"keys=status&order=1&limit=2&offset=0", `{"groups":[{"status":"всё сложно","count":1},{"status":"заняты","count":2}],"next":"bzI"}`},
+		{"keys=status&order=1&limit=2&offset=1", `{"groups":[{"status":"заняты","count":2},{"status":"свободны","count":3}]}`},
+		{"keys=status&cursor=bzE&order=1&limit=1", `{"groups":[{"status":"заняты","count":2}],"next":"bzI"}`},
+		{"keys=status&cursor=bzI&order=1&limit=1", `{"groups":[{"status":"свободны","count":3}]}`},
+		{"keys=status&offset=5&order=1&limit=1", `{"groups":[]}`},
+		{"keys=city,status&order=-1&limit=3&offset=0", `{"groups":[{"status":"свободны","city":"Москва","count":2},{"status":"заняты","city":"Москва","count":1},{"status":"свободны","city":"Мадрид","count":1}],"next":"bzM"}`},
+		// sorted by keys instead of count
+		{"keys=status&order=-1&limit=2&sort=key", `{"groups":[{"status":"свободны","count":3},{"status":"заняты","count":2}]}`},
+		{"keys=interests&order=-1&limit=2&offset=0&sort=key", `{"groups":[{"interests":"Спорт","count":3},{"interests":"Музыка","count":2}],"next":"bzI"}`},
+		{"keys=interests&order=-1&limit=2&cursor=bzI&sort=key", `{"groups":[{"interests":"Книги","count":2},{"interests":"Кино","count":3}]}`},
+		{"keys=country&order=1&limit=10&sort=key", `{"groups":[{"count":1},{"country":"Германия","count":1},{"country":"Испания","count":1},{"country":"Росмаль","count":3}]}`},
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"keys=status&cursor=x&order=1&limit=1", "keys=status&offset=-1&order=1&limit=1", "keys=status&sort=value&order=1&limit=1"} {
+		group := BorrowGroup(parser, dicts)
+		if err := group.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		group.Release()
+	}
+}
@@ -11,6 +11,7 @@ type Index struct {
 	ID                   *IndexReverseID
 	Likee                *IndexLikee
 	Liker                *IndexLiker
+	Block                *IndexBlock
 	Interest             *IndexInterest
 	City                 *IndexCity
 	BirthYear            *IndexYear
@@ -18,7 +19,9 @@ type Index struct {
 	Country              *IndexCountry
 	Fname                *IndexFname
 	PhoneCode            *IndexPhoneCode
+	Phone                *IndexPhone
 	Group                *IndexGroup
+	GroupLikes           *IndexGroupLikes
 	Sex                  *IndexSex
 	Status               *IndexStatus
 	InterestPremium      *IndexInterestPremium
@@ -34,6 +37,7 @@ func NewIndex(store *Store, dicts *Dicts) *Index {
 		ID:                   NewIndexReverseID(storePreallocCount),
 		Likee:                NewIndexLikee(),
 		Liker:                NewIndexLiker(),
+		Block:                NewIndexBlock(),
 		Interest:             NewIndexInterest(),
 		City:                 NewIndexCity(),
 		BirthYear:            NewIndexYear(),
@@ -41,7 +45,9 @@ func NewIndex(store *Store, dicts *Dicts) *Index {
 		Country:              NewIndexCountry(),
 		Fname:                NewIndexFname(),
 		PhoneCode:            NewIndexPhoneCode(),
+		Phone:                NewIndexPhone(),
 		Group:                NewIndexGroup(dicts),
+		GroupLikes:           NewIndexGroupLikes(dicts),
 		Sex:                  NewIndexSex(),
 		Status:               NewIndexStatus(),
 		InterestPremium:      NewIndexInterestPremium(),
@@ -68,6 +74,7 @@ func (index *Index) Append(account *Account) {
 	index.City.Append(account.City, account.ID)
 	if account.Phone != nil {
 		index.PhoneCode.Append(account.PhoneCode, account.ID)
+		index.Phone.Append(*account.Phone, account.ID)
 	} else {
 		index.PhoneCode.Append(0, account.ID)
 	}
@@ -90,12 +97,13 @@ func (index *Index) AppendInterests(account *Account, premium bool, interests ..
 			}
 		}
 	}
-	index.Group.AppendHash(CreateHashFromAccount(account), account.Interests...)
+	stats := CreateStatsFromAccount(account, premium)
+	index.Group.AppendHash(CreateHashFromAccount(account), &stats, account.Interests...)
 }
 
 func (index *Index) AppendLike(liker ID, likee ID, ts uint32) {
 	index.Liker.Append(liker, likee, ts)
-	index.Likee.Add(likee, liker)
+	index.Likee.Append(likee, liker, ts)
 }
 
 // func (index *Index) NewBatch() *IndexBatch {
@@ -130,6 +138,7 @@ func (batch *IndexBatch) Add(account *Account) {
 	batch.AddJoined(account.ID, timestampToYear(int64(account.Joined)))
 	if account.Phone != nil {
 		batch.AddPhoneCode(account.ID, account.PhoneCode)
+		batch.AddPhone(account.ID, *account.Phone)
 	} else {
 		batch.AddPhoneCode(account.ID, 0)
 	}
@@ -309,14 +318,31 @@ func (batch *IndexBatch) RemoveInterests(id ID, status, sex byte, city City, cou
 // }
 
 func (batch *IndexBatch) AddLike(liker ID, likee ID, ts uint32) {
+	var (
+		group     bool
+		hash      GroupHash
+		interests []Interest
+	)
+	if batch.index.GroupLikes.Enabled() {
+		// liker hash is taken now as later updates queue their own jobs
+		if account := batch.index.store.Get(liker); account != nil {
+			group = true
+			hash = CreateHashFromAccount(account)
+			interests = append([]Interest(nil), account.Interests...)
+		}
+	}
 	batch.jobs = append(batch.jobs, func() {
-		batch.addLike(liker, likee, ts)
+		batch.addLike(liker, likee, ts, group, hash, interests...)
 	})
 }
 
-func (batch *IndexBatch) addLike(liker ID, likee ID, ts uint32) {
-	batch.index.Liker.Add(liker, likee, ts)
-	batch.index.Likee.Add(likee, liker)
+// addLike counts liker in likee aggregations only for the first like, which
+// is found by liker index under its lock, so concurrent jobs count it once.
+func (batch *IndexBatch) addLike(liker ID, likee ID, ts uint32, group bool, hash GroupHash, interests ...Interest) {
+	if batch.index.Liker.Add(liker, likee, ts) && group {
+		batch.index.GroupLikes.AddHash(likee, hash, interests...)
+	}
+	batch.index.Likee.Add(likee, liker, ts)
 }
 
 func (batch *IndexBatch) ReplaceSex(id ID, oldSex byte, newSex byte) {
@@ -373,6 +399,27 @@ func (batch *IndexBatch) replacePhoneCode(id ID, oldPhoneCode uint16, newPhoneCo
 	batch.index.PhoneCode.Add(newPhoneCode, id)
 }
 
+func (batch *IndexBatch) AddPhone(id ID, phone string) {
+	batch.jobs = append(batch.jobs, func() {
+		batch.addPhone(id, phone)
+	})
+}
+
+func (batch *IndexBatch) addPhone(id ID, phone string) {
+	batch.index.Phone.Add(phone, id)
+}
+
+func (batch *IndexBatch) ReplacePhone(id ID, oldPhone string, newPhone string) {
+	batch.jobs = append(batch.jobs, func() {
+		batch.replacePhone(id, oldPhone, newPhone)
+	})
+}
+
+func (batch *IndexBatch) replacePhone(id ID, oldPhone string, newPhone string) {
+	batch.index.Phone.Remove(oldPhone, id)
+	batch.index.Phone.Add(newPhone, id)
+}
+
 func (batch *IndexBatch) ReplaceFname(id ID, oldFname Fname, newFname Fname) {
 	batch.jobs = append(batch.jobs, func() {
 		batch.replaceFname(id, oldFname, newFname)
@@ -406,24 +453,45 @@ func (batch *IndexBatch) replaceCity(id ID, oldCity City, newCity City) {
 	batch.index.City.Add(newCity, id)
 }
 
-func (batch *IndexBatch) SubGroupHash(hash GroupHash, interests ...Interest) {
+func (batch *IndexBatch) SubGroupHash(hash GroupHash, stats GroupStats, interests ...Interest) {
+	batch.jobs = append(batch.jobs, func() {
+		batch.subGroupHash(hash, stats, interests...)
+	})
+}
+
+func (batch *IndexBatch) subGroupHash(hash GroupHash, stats GroupStats, interests ...Interest) {
+	batch.index.Group.SubHash(hash, &stats, interests...)
+}
+
+func (batch *IndexBatch) AddGroupHash(hash GroupHash, stats GroupStats, interests ...Interest) {
 	batch.jobs = append(batch.jobs, func() {
-		batch.subGroupHash(hash, interests...)
+		batch.addGroupHash(hash, stats, interests...)
 	})
 }
 
-func (batch *IndexBatch) subGroupHash(hash GroupHash, interests ...Interest) {
-	batch.index.Group.SubHash(hash, interests...)
+func (batch *IndexBatch) addGroupHash(hash GroupHash, stats GroupStats, interests ...Interest) {
+	batch.index.Group.AddHash(hash, &stats, interests...)
 }
 
-func (batch *IndexBatch) AddGroupHash(hash GroupHash, interests ...Interest) {
+// ReplaceLikesGroupHash moves liker in aggregations of each likee it likes.
+func (batch *IndexBatch) ReplaceLikesGroupHash(id ID, oldHash GroupHash, newHash GroupHash, oldInterests []Interest, newInterests []Interest) {
 	batch.jobs = append(batch.jobs, func() {
-		batch.addGroupHash(hash, interests...)
+		batch.replaceLikesGroupHash(id, oldHash, newHash, oldInterests, newInterests)
 	})
 }
 
-func (batch *IndexBatch) addGroupHash(hash GroupHash, interests ...Interest) {
-	batch.index.Group.AddHash(hash, interests...)
+func (batch *IndexBatch) replaceLikesGroupHash(id ID, oldHash GroupHash, newHash GroupHash, oldInterests []Interest, newInterests []Interest) {
+	if !batch.index.GroupLikes.Enabled() {
+		return
+	}
+	likes := batch.index.Liker.Find(id)
+	for i, like := range likes {
+		if i > 0 && likes[i-1].ID == like.ID {
+			continue
+		}
+		batch.index.GroupLikes.SubHash(like.ID, oldHash, oldInterests...)
+		batch.index.GroupLikes.AddHash(like.ID, newHash, newInterests...)
+	}
 }
 
 func (batch *IndexBatch) AddInterest(id ID, interest Interest) {
@@ -636,7 +704,8 @@ func (batch *IndexBatch) replaceInterestRelationshipCity(id ID, interest Interes
 }
 
 type IndexWorker struct {
-	jobs chan func()
+	jobs    chan func()
+	pending sync.WaitGroup
 }
 
 func NewIndexWorker() *IndexWorker {
@@ -646,16 +715,23 @@ func NewIndexWorker() *IndexWorker {
 }
 
 func (worker *IndexWorker) Add(job func()) {
+	worker.pending.Add(1)
 	worker.jobs <- job
 }
 
 func (worker *IndexWorker) Run() {
 	for job := range worker.jobs {
 		job()
+		worker.pending.Done()
 		// fmt.Println("process index job")
 	}
 }
 
+// Wait waits until added jobs are done, no job should be added meanwhile.
+func (worker *IndexWorker) Wait() {
+	worker.pending.Wait()
+}
+
 func (worker *IndexWorker) Len() int {
 	return len(worker.jobs)
 }
@@ -668,9 +744,29 @@ func (index *Index) RunWorker() {
 	}
 }
 
+// updateGroupLikes builds per likee aggregations once likes are sorted.
+func (index *Index) updateGroupLikes() {
+	if !index.GroupLikes.Enabled() {
+		return
+	}
+	index.store.Iterate(func(account *Account) bool {
+		hash := CreateHashFromAccount(account)
+		likes := index.Liker.Find(account.ID)
+		for i, like := range likes {
+			if i > 0 && likes[i-1].ID == like.ID {
+				continue
+			}
+			index.GroupLikes.AppendHash(like.ID, hash, account.Interests...)
+		}
+		return true
+	})
+	index.GroupLikes.UpdateAll()
+}
+
 func (index *Index) Update() {
 	index.ID.Update()
 	index.Liker.UpdateAll()
+	index.Likee.UpdateAll()
 	index.Sex.UpdateAll()
 	index.Status.UpdateAll()
 	index.BirthYear.UpdateAll()
@@ -679,12 +775,14 @@ func (index *Index) Update() {
 	index.Country.UpdateAll()
 	index.City.UpdateAll()
 	index.PhoneCode.UpdateAll()
+	index.Phone.Update()
 	index.Interest.UpdateAll()
 	index.InterestPremium.UpdateAll()
 	index.InterestSingle.UpdateAll()
 	index.InterestComplicated.UpdateAll()
 	index.InterestRelationship.UpdateAll()
 	index.Group.UpdateAll()
+	index.updateGroupLikes()
 
 	fmt.Println("total birth years =", index.BirthYear.Len())
 	fmt.Println("total joined years =", index.JoinedYear.Len())
@@ -692,6 +790,7 @@ func (index *Index) Update() {
 	fmt.Println("total countries =", index.Country.Len())
 	fmt.Println("total cities =", index.City.Len())
 	fmt.Println("total phone codes =", index.PhoneCode.Len())
+	fmt.Println("total phones =", index.Phone.Len())
 	fmt.Println("total interests =", index.Interest.Len())
 
 	// fmt.Println("total group entries =", len(index.Group.entries))
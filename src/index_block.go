@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+)
+
+// IndexBlock keeps blocks in both directions, so neither of two
+// accounts is shown to the other one.
+type IndexBlock struct {
+	rwLock sync.RWMutex
+	blocks map[ID]*IndexID
+}
+
+func NewIndexBlock() *IndexBlock {
+	return &IndexBlock{
+		blocks: make(map[ID]*IndexID),
+	}
+}
+
+func (index *IndexBlock) Add(blocker ID, blocked ID) {
+	index.add(blocker, blocked)
+	index.add(blocked, blocker)
+}
+
+func (index *IndexBlock) Find(id ID) IDS {
+	index.rwLock.RLock()
+	if _, ok := index.blocks[id]; ok {
+		ids := index.blocks[id].FindAll()
+		index.rwLock.RUnlock()
+		return ids
+	}
+	index.rwLock.RUnlock()
+	return make(IDS, 0)
+}
+
+func (index *IndexBlock) Len() int {
+	index.rwLock.RLock()
+	blocksLen := len(index.blocks)
+	index.rwLock.RUnlock()
+	return blocksLen
+}
+
+func (index *IndexBlock) add(id ID, other ID) {
+	index.rwLock.RLock()
+	_, ok := index.blocks[id]
+	if !ok {
+		index.rwLock.RUnlock()
+		index.rwLock.Lock()
+		if _, ok := index.blocks[id]; !ok {
+			index.blocks[id] = NewIndexID(4)
+		}
+		index.rwLock.Unlock()
+		index.rwLock.RLock()
+	}
+	index.blocks[id].Add(other)
+	index.rwLock.RUnlock()
+}
@@ -101,6 +101,15 @@ func (index *IndexCity) Iter(city City) IndexIterator {
 	return EmptyIndexIterator
 }
 
+func (index *IndexCity) Count(city City) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.cities[city]; ok {
+		count = len(index.cities[city].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexCity) Len() int {
 	index.rwLock.RLock()
 	citiesLen := len(index.cities)
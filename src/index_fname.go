@@ -101,6 +101,15 @@ func (index *IndexFname) Iter(fname Fname) IndexIterator {
 	return EmptyIndexIterator
 }
 
+func (index *IndexFname) Count(fname Fname) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.fnames[fname]; ok {
+		count = len(index.fnames[fname].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexFname) Len() int {
 	index.rwLock.RLock()
 	fnamesLen := len(index.fnames)
@@ -1,214 +1,123 @@
 package main
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 type IndexGroup struct {
-	dicts        *Dicts
+	dicts *Dicts
+	// filterGroups is replaced on changes and never modified in place,
+	// so it is safe to range over it without lock.
 	filterGroups map[GroupHash][]GroupHash
 	entries      map[GroupHash]map[GroupHash]map[GroupHash]*Aggregation
+	hits         map[GroupHash]map[GroupHash]*uint64
+	stats        bool
 	rwLock       sync.RWMutex
 }
 
+type IndexGroupComboStats struct {
+	Filter  GroupHash
+	Group   GroupHash
+	Hits    uint64
+	Values  int
+	Entries int
+	Memory  int
+}
+
 func NewIndexGroup(dicts *Dicts) *IndexGroup {
-	filterGroups := map[GroupHash][]GroupHash{
-		0: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupCityMask,
-			GroupCountryMask,
-			GroupInterestsMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupSexMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupStatusMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupCityMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupCountryMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupJoinedMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupCityMask,
-			GroupCountryMask,
-			GroupInterestsMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupBirthMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupCityMask,
-			GroupCountryMask,
-			GroupInterestsMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-		},
-		GroupInterestsMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupCountryMask | GroupJoinedMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupCountryMask | GroupBirthMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupCityMask | GroupJoinedMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupCityMask | GroupBirthMask: []GroupHash{
-			GroupSexMask,
-			GroupStatusMask,
-			GroupInterestsMask,
-		},
-		GroupJoinedMask | GroupStatusMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupJoinedMask | GroupSexMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupBirthMask | GroupStatusMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupBirthMask | GroupSexMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupInterestsMask | GroupJoinedMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
-		GroupInterestsMask | GroupBirthMask: []GroupHash{
-			GroupCityMask,
-			GroupCountryMask,
-			GroupCityMask | GroupSexMask,
-			GroupCityMask | GroupStatusMask,
-			GroupCountryMask | GroupSexMask,
-			GroupCountryMask | GroupStatusMask,
-		},
+	index := &IndexGroup{
+		dicts: dicts,
 	}
+	index.SetCombos(DefaultGroupCombos())
+	return index
+}
 
+// SetCombos replaces precomputed filter and group combinations,
+// should be called before indexes are built.
+func (index *IndexGroup) SetCombos(filterGroups map[GroupHash][]GroupHash) {
 	entries := make(map[GroupHash]map[GroupHash]map[GroupHash]*Aggregation)
+	hits := make(map[GroupHash]map[GroupHash]*uint64)
 
 	for filter := range filterGroups {
 		entries[filter] = make(map[GroupHash]map[GroupHash]*Aggregation)
+		hits[filter] = make(map[GroupHash]*uint64)
 		for _, group := range filterGroups[filter] {
 			entries[filter][group] = make(map[GroupHash]*Aggregation)
+			hits[filter][group] = new(uint64)
 		}
 	}
 
-	return &IndexGroup{
-		dicts:        dicts,
-		filterGroups: filterGroups,
-		entries:      entries,
-	}
+	index.rwLock.Lock()
+	index.filterGroups = filterGroups
+	index.entries = entries
+	index.hits = hits
+	index.rwLock.Unlock()
+}
+
+func (index *IndexGroup) combos() map[GroupHash][]GroupHash {
+	index.rwLock.RLock()
+	filterGroups := index.filterGroups
+	index.rwLock.RUnlock()
+	return filterGroups
 }
 
-func (index *IndexGroup) AppendHash(hash GroupHash, interests ...Interest) {
-	for filter := range index.filterGroups {
-		for _, group := range index.filterGroups[filter] {
+func (index *IndexGroup) AppendHash(hash GroupHash, sample *GroupStats, interests ...Interest) {
+	if !index.stats {
+		sample = nil
+	}
+	filterGroups := index.combos()
+	for filter := range filterGroups {
+		for _, group := range filterGroups[filter] {
 			if filter&GroupInterestsMask > 0 || group&GroupInterestsMask > 0 {
 				for _, interest := range interests {
 					hash.SetInterest(interest)
-					index.appendGroup(filter, group, hash)
+					index.appendGroup(filter, group, hash, sample)
 				}
 			} else {
 				hash.SetInterest(0)
-				index.appendGroup(filter, group, hash)
+				index.appendGroup(filter, group, hash, sample)
 			}
 		}
 	}
 }
 
-func (index *IndexGroup) AddHash(hash GroupHash, interests ...Interest) {
-	for filter := range index.filterGroups {
-		for _, group := range index.filterGroups[filter] {
+func (index *IndexGroup) AddHash(hash GroupHash, sample *GroupStats, interests ...Interest) {
+	if !index.stats {
+		sample = nil
+	}
+	filterGroups := index.combos()
+	for filter := range filterGroups {
+		for _, group := range filterGroups[filter] {
 			if filter&GroupInterestsMask > 0 || group&GroupInterestsMask > 0 {
 				for _, interest := range interests {
 					hash.SetInterest(interest)
-					index.addGroup(filter, group, hash)
+					index.addGroup(filter, group, hash, sample)
 				}
 			} else {
 				hash.SetInterest(0)
-				index.addGroup(filter, group, hash)
+				index.addGroup(filter, group, hash, sample)
 			}
 		}
 	}
 }
 
-func (index *IndexGroup) SubHash(hash GroupHash, interests ...Interest) {
-	for filter := range index.filterGroups {
-		for _, group := range index.filterGroups[filter] {
+func (index *IndexGroup) SubHash(hash GroupHash, sample *GroupStats, interests ...Interest) {
+	if !index.stats {
+		sample = nil
+	}
+	filterGroups := index.combos()
+	for filter := range filterGroups {
+		for _, group := range filterGroups[filter] {
 			if filter&GroupInterestsMask > 0 || group&GroupInterestsMask > 0 {
 				for _, interest := range interests {
 					hash.SetInterest(interest)
-					index.subGroup(filter, group, hash)
+					index.subGroup(filter, group, hash, sample)
 				}
 			} else {
 				hash.SetInterest(0)
-				index.subGroup(filter, group, hash)
+				index.subGroup(filter, group, hash, sample)
 			}
 		}
 	}
@@ -216,21 +125,33 @@ func (index *IndexGroup) SubHash(hash GroupHash, interests ...Interest) {
 
 func (index *IndexGroup) Get(filter, group, filterVal GroupHash) *Aggregation {
 	index.rwLock.RLock()
-	if _, ok := index.entries[filter]; !ok {
+	values, ok := index.entries[filter][group]
+	if !ok {
 		index.rwLock.RUnlock()
 		return nil
 	}
-	if _, ok := index.entries[filter][group]; !ok {
-		index.rwLock.RUnlock()
-		return nil
-	}
-	if _, ok := index.entries[filter][group][filterVal]; !ok {
-		index.rwLock.RUnlock()
-		return nil
-	}
-	entries := index.entries[filter][group][filterVal]
+	atomic.AddUint64(index.hits[filter][group], 1)
+	aggregation := values[filterVal]
 	index.rwLock.RUnlock()
-	return entries
+	return aggregation
+}
+
+// SetStats enables keeping agg sums in precomputed aggregations,
+// should be called before indexes are built.
+func (index *IndexGroup) SetStats(stats bool) {
+	index.stats = stats
+}
+
+func (index *IndexGroup) Stats() bool {
+	return index.stats
+}
+
+// Has reports whether aggregations are precomputed for filter and group masks.
+func (index *IndexGroup) Has(filter, group GroupHash) bool {
+	index.rwLock.RLock()
+	_, ok := index.entries[filter][group]
+	index.rwLock.RUnlock()
+	return ok
 }
 
 func (index *IndexGroup) UpdateAll() {
@@ -245,41 +166,151 @@ func (index *IndexGroup) UpdateAll() {
 	index.rwLock.RUnlock()
 }
 
-func (index *IndexGroup) appendGroup(filter, group, accHash GroupHash) {
-	index.rwLock.RLock()
-	filterHash := accHash & filter
-	if _, ok := index.entries[filter][group][filterHash]; !ok {
-		index.rwLock.RUnlock()
-		index.rwLock.Lock()
-		index.entries[filter][group][filterHash] = NewAggregation(index.dicts, group)
+// Merge adds combinations built in other index which are not present yet.
+func (index *IndexGroup) Merge(other *IndexGroup) {
+	index.rwLock.Lock()
+	filterGroups := index.copyCombos()
+	for filter, groups := range other.combos() {
+		for _, group := range groups {
+			if _, ok := index.entries[filter][group]; ok {
+				continue
+			}
+			if _, ok := index.entries[filter]; !ok {
+				index.entries[filter] = make(map[GroupHash]map[GroupHash]*Aggregation)
+				index.hits[filter] = make(map[GroupHash]*uint64)
+			}
+			index.entries[filter][group] = other.entries[filter][group]
+			index.hits[filter][group] = new(uint64)
+			filterGroups[filter] = append(filterGroups[filter], group)
+		}
+	}
+	index.filterGroups = filterGroups
+	index.rwLock.Unlock()
+}
+
+func (index *IndexGroup) Drop(filter, group GroupHash) bool {
+	index.rwLock.Lock()
+	if _, ok := index.entries[filter][group]; !ok {
 		index.rwLock.Unlock()
-		index.rwLock.RLock()
+		return false
 	}
-	index.entries[filter][group][filterHash].Append(accHash)
-	index.rwLock.RUnlock()
+	index.drop(filter, group)
+	index.rwLock.Unlock()
+	return true
+}
+
+// DropUnused drops combinations which were never queried.
+func (index *IndexGroup) DropUnused() int {
+	dropped := 0
+	index.rwLock.Lock()
+	for filter := range index.hits {
+		for group, hits := range index.hits[filter] {
+			if atomic.LoadUint64(hits) == 0 {
+				index.drop(filter, group)
+				dropped++
+			}
+		}
+	}
+	index.rwLock.Unlock()
+	return dropped
 }
 
-func (index *IndexGroup) addGroup(filter, group, accHash GroupHash) {
+func (index *IndexGroup) ComboStats() []IndexGroupComboStats {
 	index.rwLock.RLock()
-	filterHash := accHash & filter
-	if _, ok := index.entries[filter][group][filterHash]; !ok {
-		index.rwLock.RUnlock()
-		index.rwLock.Lock()
-		index.entries[filter][group][filterHash] = NewAggregation(index.dicts, group)
-		index.rwLock.Unlock()
-		index.rwLock.RLock()
+	combos := make([]IndexGroupComboStats, 0, len(index.entries))
+	for filter := range index.entries {
+		for group, values := range index.entries[filter] {
+			combo := IndexGroupComboStats{
+				Filter: filter,
+				Group:  group,
+				Hits:   atomic.LoadUint64(index.hits[filter][group]),
+				Values: len(values),
+			}
+			for _, aggregation := range values {
+				combo.Entries += aggregation.Len()
+				combo.Memory += aggregation.Memory()
+			}
+			combos = append(combos, combo)
+		}
 	}
-	index.entries[filter][group][filterHash].Add(accHash)
 	index.rwLock.RUnlock()
+	sort.Slice(combos, func(i, j int) bool {
+		return combos[i].Memory > combos[j].Memory
+	})
+	return combos
+}
+
+func (index *IndexGroup) drop(filter, group GroupHash) {
+	filterGroups := index.copyCombos()
+	groups := make([]GroupHash, 0, len(filterGroups[filter]))
+	for _, g := range filterGroups[filter] {
+		if g != group {
+			groups = append(groups, g)
+		}
+	}
+	delete(index.entries[filter], group)
+	delete(index.hits[filter], group)
+	if len(groups) == 0 {
+		delete(filterGroups, filter)
+		delete(index.entries, filter)
+		delete(index.hits, filter)
+	} else {
+		filterGroups[filter] = groups
+	}
+	index.filterGroups = filterGroups
 }
 
-func (index *IndexGroup) subGroup(filter, group, accHash GroupHash) {
+func (index *IndexGroup) copyCombos() map[GroupHash][]GroupHash {
+	filterGroups := make(map[GroupHash][]GroupHash, len(index.filterGroups))
+	for filter, groups := range index.filterGroups {
+		filterGroups[filter] = append([]GroupHash(nil), groups...)
+	}
+	return filterGroups
+}
+
+func (index *IndexGroup) appendGroup(filter, group, accHash GroupHash, sample *GroupStats) {
+	aggregation := index.aggregation(filter, group, accHash&filter)
+	if aggregation != nil {
+		aggregation.Append(accHash, sample)
+	}
+}
+
+func (index *IndexGroup) addGroup(filter, group, accHash GroupHash, sample *GroupStats) {
+	aggregation := index.aggregation(filter, group, accHash&filter)
+	if aggregation != nil {
+		aggregation.Add(accHash, sample)
+	}
+}
+
+func (index *IndexGroup) subGroup(filter, group, accHash GroupHash, sample *GroupStats) {
 	index.rwLock.RLock()
-	filterHash := accHash & filter
-	if _, ok := index.entries[filter][group][filterHash]; !ok {
-		index.rwLock.RUnlock()
-		return
+	aggregation := index.entries[filter][group][accHash&filter]
+	index.rwLock.RUnlock()
+	if aggregation != nil {
+		aggregation.Sub(accHash, sample)
 	}
-	index.entries[filter][group][filterHash].Sub(accHash)
+}
+
+// aggregation returns aggregation for filter value creating it when missing,
+// nil is returned for combination dropped meanwhile.
+func (index *IndexGroup) aggregation(filter, group, filterHash GroupHash) *Aggregation {
+	index.rwLock.RLock()
+	aggregation, ok := index.entries[filter][group][filterHash]
 	index.rwLock.RUnlock()
+	if ok {
+		return aggregation
+	}
+	index.rwLock.Lock()
+	values, ok := index.entries[filter][group]
+	if !ok {
+		index.rwLock.Unlock()
+		return nil
+	}
+	aggregation, ok = values[filterHash]
+	if !ok {
+		aggregation = NewAggregation(index.dicts, group)
+		values[filterHash] = aggregation
+	}
+	index.rwLock.Unlock()
+	return aggregation
 }
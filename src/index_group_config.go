@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Group config lists precomputed combinations, one per line:
+//
+//	# filter keys   group keys
+//	-               sex
+//	city,joined     sex
+//	country         city,status
+//
+// where "-" means no filter.
+
+// DefaultGroupCombos returns combinations precomputed when no config given.
+func DefaultGroupCombos() map[GroupHash][]GroupHash {
+	return map[GroupHash][]GroupHash{
+		0: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupCityMask,
+			GroupCountryMask,
+			GroupInterestsMask,
+			GroupBirthMask,
+			GroupJoinedMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+			GroupCountryMask | GroupJoinedMask,
+		},
+		GroupSexMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupStatusMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupCityMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+			GroupBirthMask,
+			GroupJoinedMask,
+		},
+		GroupCountryMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+			GroupBirthMask,
+			GroupJoinedMask,
+		},
+		GroupJoinedMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupCityMask,
+			GroupCountryMask,
+			GroupInterestsMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupBirthMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupCityMask,
+			GroupCountryMask,
+			GroupInterestsMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+		},
+		GroupInterestsMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupCountryMask | GroupJoinedMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+		},
+		GroupCountryMask | GroupBirthMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+		},
+		GroupCityMask | GroupJoinedMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+		},
+		GroupCityMask | GroupBirthMask: []GroupHash{
+			GroupSexMask,
+			GroupStatusMask,
+			GroupInterestsMask,
+		},
+		GroupJoinedMask | GroupStatusMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupJoinedMask | GroupSexMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupBirthMask | GroupStatusMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupBirthMask | GroupSexMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupInterestsMask | GroupJoinedMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+		GroupInterestsMask | GroupBirthMask: []GroupHash{
+			GroupCityMask,
+			GroupCountryMask,
+			GroupCityMask | GroupSexMask,
+			GroupCityMask | GroupStatusMask,
+			GroupCountryMask | GroupSexMask,
+			GroupCountryMask | GroupStatusMask,
+		},
+	}
+}
+
+func ReadGroupConfig(filename string) (map[GroupHash][]GroupHash, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	filterGroups := make(map[GroupHash][]GroupHash)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("Invalid group config line %d", n)
+		}
+		filter, err := ParseGroupMask(fields[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		group, err := ParseGroupMask(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		if err := ValidateGroupCombo(filter, group); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		if !containsGroupHash(filterGroups[filter], group) {
+			filterGroups[filter] = append(filterGroups[filter], group)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filterGroups, nil
+}
+
+// ParseGroupMask parses comma separated group keys, "-" and "" mean none.
+func ParseGroupMask(value string) (GroupHash, error) {
+	var mask GroupHash
+	if value == "-" || value == "" {
+		return 0, nil
+	}
+	for _, key := range strings.Split(value, ",") {
+		_, keyMask, err := ParseGroupKey(key)
+		if err != nil {
+			return 0, err
+		}
+		mask |= keyMask
+	}
+	return mask, nil
+}
+
+// ParseGroupMasks parses group keys lists separated by semicolon,
+// e.g. "city;country;sex,status".
+func ParseGroupMasks(value string) ([]GroupHash, error) {
+	groups := make([]GroupHash, 0)
+	for _, keys := range strings.Split(value, ";") {
+		if keys == "" {
+			continue
+		}
+		group, err := ParseGroupMask(keys)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateGroupCombo(0, group); err != nil {
+			return nil, err
+		}
+		if !containsGroupHash(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+func GroupMaskString(mask GroupHash) string {
+	if mask == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, 7)
+	for _, key := range []struct {
+		name string
+		mask GroupHash
+	}{
+		{"sex", GroupSexMask},
+		{"status", GroupStatusMask},
+		{"city", GroupCityMask},
+		{"country", GroupCountryMask},
+		{"interests", GroupInterestsMask},
+		{"joined", GroupJoinedMask},
+		{"birth", GroupBirthMask},
+		{"likes_bucket", GroupLikesMask},
+	} {
+		if mask&key.mask > 0 {
+			keys = append(keys, key.name)
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func ValidateGroupCombo(filter, group GroupHash) error {
+	if group == 0 {
+		return errors.New("Group keys should be specified")
+	}
+	if filter&group > 0 {
+		return errors.New("Group keys should not be filtered")
+	}
+	if (filter|group)&GroupLikesMask > 0 {
+		return errors.New("Likes bucket is not precomputed")
+	}
+	return nil
+}
+
+func containsGroupHash(hashes []GroupHash, hash GroupHash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseGroupMask(t *testing.T) {
+	tests := []struct {
+		value string
+		mask  GroupHash
+		keys  string
+		err   bool
+	}{
+		{"-", 0, "-", false},
+		{"", 0, "-", false},
+		{"sex", GroupSexMask, "sex", false},
+		{"status,city", GroupCityMask | GroupStatusMask, "status,city", false},
+		{"birth,country,joined", GroupBirthMask | GroupCountryMask | GroupJoinedMask, "country,joined,birth", false},
+		{"interests,likes_bucket", GroupInterestsMask | GroupLikesMask, "interests,likes_bucket", false},
+		{"sex,unknown", 0, "", true},
+		{"sex,", 0, "", true},
+	}
+
+	for _, test := range tests {
+		mask, err := ParseGroupMask(test.value)
+		if test.err != (err != nil) {
+			t.Errorf("ParseGroupMask(%q) error %v", test.value, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if mask != test.mask {
+			t.Errorf("ParseGroupMask(%q) = %x, want %x", test.value, mask, test.mask)
+		}
+		if keys := GroupMaskString(mask); keys != test.keys {
+			t.Errorf("GroupMaskString(%x) = %s, want %s", mask, keys, test.keys)
+		}
+	}
+}
+
+func TestValidateGroupCombo(t *testing.T) {
+	tests := []struct {
+		filter GroupHash
+		group  GroupHash
+		err    bool
+	}{
+		{0, GroupSexMask, false},
+		{GroupCityMask | GroupJoinedMask, GroupSexMask | GroupStatusMask, false},
+		{GroupSexMask, 0, true},
+		{GroupSexMask, GroupSexMask | GroupCityMask, true},
+		{0, GroupLikesMask, true},
+		{GroupLikesMask, GroupSexMask, true},
+	}
+
+	for _, test := range tests {
+		if err := ValidateGroupCombo(test.filter, test.group); test.err != (err != nil) {
+			t.Errorf("ValidateGroupCombo(%s, %s) error %v", GroupMaskString(test.filter), GroupMaskString(test.group), err)
+		}
+	}
+}
+
+func TestReadGroupConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		want   map[GroupHash][]GroupHash
+	}{
+		{
+			"# filter keys   group keys\n-   sex\n\ncity,joined   sex\n  country\tcity,status\n-   sex\n",
+			map[GroupHash][]GroupHash{
+				0:                               {GroupSexMask},
+				GroupCityMask | GroupJoinedMask: {GroupSexMask},
+				GroupCountryMask:                {GroupCityMask | GroupStatusMask},
+			},
+		},
+		{"", map[GroupHash][]GroupHash{}},
+		{"sex\n", nil},
+		{"- sex city\n", nil},
+		{"- unknown\n", nil},
+		{"sex sex,city\n", nil},
+		{"- likes_bucket\n", nil},
+	}
+
+	for _, test := range tests {
+		file, err := ioutil.TempFile("", "group-config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.WriteString(test.config)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		filterGroups, err := ReadGroupConfig(file.Name())
+		os.Remove(file.Name())
+
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected error", test.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.config, err)
+			continue
+		}
+		if len(filterGroups) != len(test.want) {
+			t.Errorf("%q: got %v, want %v", test.config, filterGroups, test.want)
+			continue
+		}
+		for filter, groups := range test.want {
+			got := filterGroups[filter]
+			if len(got) != len(groups) {
+				t.Errorf("%q: filter %s groups %v, want %v", test.config, GroupMaskString(filter), got, groups)
+				continue
+			}
+			for i := range groups {
+				if got[i] != groups[i] {
+					t.Errorf("%q: filter %s groups %v, want %v", test.config, GroupMaskString(filter), got, groups)
+					break
+				}
+			}
+		}
+	}
+
+	if _, err := ReadGroupConfig("/nonexistent/group-config"); err == nil {
+		t.Error("missing file: expected error")
+	}
+}
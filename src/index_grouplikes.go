@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+)
+
+// IndexGroupLikes keeps aggregations of likers per likee, so groups
+// filtered by likes are taken without scanning likers. Each liker is
+// counted once per likee regardless of how many times it liked.
+type IndexGroupLikes struct {
+	dicts   *Dicts
+	groups  []GroupHash
+	entries map[ID][]*Aggregation // in order of groups
+	rwLock  sync.RWMutex
+}
+
+func NewIndexGroupLikes(dicts *Dicts) *IndexGroupLikes {
+	return &IndexGroupLikes{
+		dicts:   dicts,
+		entries: make(map[ID][]*Aggregation),
+	}
+}
+
+// SetGroups sets group keys to keep aggregations for, should be called
+// before indexes are built. No groups means index is disabled.
+func (index *IndexGroupLikes) SetGroups(groups []GroupHash) {
+	index.rwLock.Lock()
+	index.groups = groups
+	index.entries = make(map[ID][]*Aggregation)
+	index.rwLock.Unlock()
+}
+
+func (index *IndexGroupLikes) Enabled() bool {
+	return len(index.groups) > 0
+}
+
+func (index *IndexGroupLikes) Has(group GroupHash) bool {
+	for _, g := range index.groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (index *IndexGroupLikes) Get(likee ID, group GroupHash) *Aggregation {
+	index.rwLock.RLock()
+	aggregations := index.entries[likee]
+	index.rwLock.RUnlock()
+	if aggregations == nil {
+		return nil
+	}
+	for i, g := range index.groups {
+		if g == group {
+			return aggregations[i]
+		}
+	}
+	return nil
+}
+
+// AppendHash does not keep entries sorted, UpdateAll should be called
+// once all likers are appended, as groups are read from sorted entries.
+func (index *IndexGroupLikes) AppendHash(likee ID, hash GroupHash, interests ...Interest) {
+	index.apply(index.aggregations(likee), hash, interests, (*Aggregation).Append)
+}
+
+func (index *IndexGroupLikes) AddHash(likee ID, hash GroupHash, interests ...Interest) {
+	index.apply(index.aggregations(likee), hash, interests, (*Aggregation).Add)
+}
+
+func (index *IndexGroupLikes) SubHash(likee ID, hash GroupHash, interests ...Interest) {
+	index.rwLock.RLock()
+	aggregations := index.entries[likee]
+	index.rwLock.RUnlock()
+	if aggregations != nil {
+		index.apply(aggregations, hash, interests, (*Aggregation).Sub)
+	}
+}
+
+func (index *IndexGroupLikes) UpdateAll() {
+	index.rwLock.RLock()
+	for likee := range index.entries {
+		for _, aggregation := range index.entries[likee] {
+			aggregation.Update()
+		}
+	}
+	index.rwLock.RUnlock()
+}
+
+func (index *IndexGroupLikes) apply(aggregations []*Aggregation, hash GroupHash, interests []Interest, fn func(*Aggregation, GroupHash, *GroupStats)) {
+	for i, group := range index.groups {
+		if group&GroupInterestsMask > 0 {
+			for _, interest := range interests {
+				hash.SetInterest(interest)
+				fn(aggregations[i], hash, nil)
+			}
+		} else {
+			hash.SetInterest(0)
+			fn(aggregations[i], hash, nil)
+		}
+	}
+}
+
+// aggregations returns aggregations of likee for each group, creating
+// them when missing.
+func (index *IndexGroupLikes) aggregations(likee ID) []*Aggregation {
+	index.rwLock.RLock()
+	aggregations, ok := index.entries[likee]
+	index.rwLock.RUnlock()
+	if ok {
+		return aggregations
+	}
+	index.rwLock.Lock()
+	aggregations, ok = index.entries[likee]
+	if !ok {
+		aggregations = make([]*Aggregation, len(index.groups))
+		for i, group := range index.groups {
+			aggregations[i] = NewAggregation(index.dicts, group)
+		}
+		index.entries[likee] = aggregations
+	}
+	index.rwLock.Unlock()
+	return aggregations
+}
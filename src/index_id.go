@@ -72,6 +72,14 @@ func (index *IndexID) Remove(id ID) {
 	index.rwLock.Unlock()
 }
 
+// Contains searches id in ids sorted descending.
+func (ids IDS) Contains(id ID) bool {
+	i := sort.Search(len(ids), func(i int) bool {
+		return ids[i] <= id
+	})
+	return i < len(ids) && ids[i] == id
+}
+
 func (ids IDS) Len() int           { return len(ids) }
 func (ids IDS) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
 func (ids IDS) Less(i, j int) bool { return ids[i] > ids[j] }
@@ -280,3 +288,46 @@ func (it *IntersectIndexIterator) Next() ID {
 func (it *IntersectIndexIterator) Cur() ID {
 	return it.value
 }
+
+// ----------------------------------------------------------------------------
+
+type DifferenceIndexIterator struct {
+	iter     IndexIterator
+	excludes []IndexIterator
+	value    ID
+}
+
+func NewDifferenceIndexIterator(iter IndexIterator, excludes ...IndexIterator) IndexIterator {
+	it := &DifferenceIndexIterator{
+		iter:     iter,
+		excludes: excludes,
+	}
+	it.Next()
+	return it
+}
+
+func (it *DifferenceIndexIterator) Next() ID {
+	for it.iter.Cur() != 0 {
+		id := it.iter.Cur()
+		it.iter.Next()
+		excluded := false
+		for _, exclude := range it.excludes {
+			for exclude.Cur() != 0 && exclude.Cur() > id {
+				exclude.Next()
+			}
+			if exclude.Cur() == id {
+				excluded = true
+			}
+		}
+		if !excluded {
+			it.value = id
+			return it.value
+		}
+	}
+	it.value = 0
+	return it.value
+}
+
+func (it *DifferenceIndexIterator) Cur() ID {
+	return it.value
+}
@@ -101,6 +101,15 @@ func (index *IndexInterest) Iter(interest Interest) IndexIterator {
 	return EmptyIndexIterator
 }
 
+func (index *IndexInterest) Count(interest Interest) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.interests[interest]; ok {
+		count = len(index.interests[interest].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexInterest) Len() int {
 	index.rwLock.RLock()
 	interestsLen := len(index.interests)
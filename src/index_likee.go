@@ -4,63 +4,192 @@ import (
 	"sync"
 )
 
+// IndexLikee keeps received likes with timestamps sorted by liker, likers
+// may repeat, so distinct likers are derived from likes.
 type IndexLikee struct {
 	rwLock sync.RWMutex
-	likees map[ID]*IndexID
+	likes  map[ID]*IndexLikes
 }
 
 func NewIndexLikee() *IndexLikee {
 	return &IndexLikee{
-		likees: make(map[ID]*IndexID),
+		likes: make(map[ID]*IndexLikes),
 	}
 }
 
-func (index *IndexLikee) Add(likee ID, liker ID) {
+// Add inserts like and reports whether it is the first like of likee by liker.
+func (index *IndexLikee) Add(likee ID, liker ID, ts uint32) bool {
 	index.rwLock.RLock()
-	_, ok := index.likees[likee]
+	_, ok := index.likes[likee]
 	if !ok {
 		index.rwLock.RUnlock()
-		index.rwLock.Lock()
-		index.likees[likee] = NewIndexID(64)
-		index.rwLock.Unlock()
+		index.create(likee)
 		index.rwLock.RLock()
-		index.likees[likee].Add(liker)
+	}
+	first := index.likes[likee].Add(liker, ts)
+	index.rwLock.RUnlock()
+	return first
+}
+
+// Append adds like without ordering likes, UpdateAll should be called after.
+func (index *IndexLikee) Append(likee ID, liker ID, ts uint32) {
+	index.rwLock.RLock()
+	_, ok := index.likes[likee]
+	if !ok {
 		index.rwLock.RUnlock()
-		return
+		index.create(likee)
+		index.rwLock.RLock()
 	}
-	index.likees[likee].Add(liker)
+	index.likes[likee].Append(liker, ts)
 	index.rwLock.RUnlock()
 }
 
+func (index *IndexLikee) UpdateAll() {
+	index.rwLock.Lock()
+	for likee := range index.likes {
+		index.likes[likee].Update()
+	}
+	index.rwLock.Unlock()
+}
+
 func (index *IndexLikee) Remove(likee ID, liker ID) {
 	index.rwLock.RLock()
-	_, ok := index.likees[likee]
+	_, ok := index.likes[likee]
 	if !ok {
 		index.rwLock.RUnlock()
 		return
 	}
-	index.likees[likee].Remove(liker)
+	index.likes[likee].RemoveAll(liker)
 	index.rwLock.RUnlock()
 }
 
+// Find returns distinct likers of likee sorted descending.
 func (index *IndexLikee) Find(likee ID) IDS {
+	likes := index.FindLikes(likee)
+	ids := make(IDS, 0, len(likes))
+	for i, like := range likes {
+		if i == 0 || likes[i-1].ID != like.ID {
+			ids = append(ids, like.ID)
+		}
+	}
+	return ids
+}
+
+// FindLikes returns likes of likee sorted by liker descending, use
+// LikersIterator to take every liker once.
+func (index *IndexLikee) FindLikes(likee ID) AccountLikes {
 	index.rwLock.RLock()
-	if _, ok := index.likees[likee]; ok {
-		ids := index.likees[likee].FindAll()
+	if _, ok := index.likes[likee]; ok {
+		likes := index.likes[likee].FindAll()
 		index.rwLock.RUnlock()
-		return ids
+		return likes
 	}
 	index.rwLock.RUnlock()
-	return make(IDS, 0)
+	return make(AccountLikes, 0)
 }
 
 func (index *IndexLikee) Iter(likee ID) IndexIterator {
 	index.rwLock.RLock()
-	if _, ok := index.likees[likee]; ok {
-		iter := index.likees[likee].Iter()
+	if _, ok := index.likes[likee]; ok {
+		iter := NewLikesIDIterator(index.likes[likee].FindAll())
 		index.rwLock.RUnlock()
 		return iter
 	}
 	index.rwLock.RUnlock()
 	return EmptyIndexIterator
 }
+
+// Count returns count of distinct likers of likee.
+func (index *IndexLikee) Count(likee ID) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.likes[likee]; ok {
+		count = index.likes[likee].Distinct()
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
+func (index *IndexLikee) create(likee ID) {
+	index.rwLock.Lock()
+	if _, ok := index.likes[likee]; !ok {
+		index.likes[likee] = NewIndexLikes(0)
+	}
+	index.rwLock.Unlock()
+}
+
+// ----------------------------------------------------------------------------
+
+// LikesIDIterator walks likes sorted by id and takes every id once.
+type LikesIDIterator struct {
+	likes AccountLikes
+	i     int
+	value ID
+}
+
+func NewLikesIDIterator(likes AccountLikes) *LikesIDIterator {
+	it := &LikesIDIterator{likes: likes}
+	if len(likes) > 0 {
+		it.value = likes[0].ID
+	}
+	return it
+}
+
+func (it *LikesIDIterator) Cur() ID {
+	return it.value
+}
+
+func (it *LikesIDIterator) Next() ID {
+	for it.i < len(it.likes) && it.likes[it.i].ID == it.value {
+		it.i++
+	}
+	it.value = 0
+	if it.i < len(it.likes) {
+		it.value = it.likes[it.i].ID
+	}
+	return it.value
+}
+
+// ----------------------------------------------------------------------------
+
+// LikersIterator walks likes sorted by liker and takes every liker once
+// with the latest timestamp of its likes between since and until.
+type LikersIterator struct {
+	likes AccountLikes
+	since uint32
+	until uint32
+	i     int
+	value AccountLike
+}
+
+func NewLikersIterator(likes AccountLikes, since uint32, until uint32) *LikersIterator {
+	it := &LikersIterator{
+		likes: likes,
+		since: since,
+		until: until,
+	}
+	it.Next()
+	return it
+}
+
+func (it *LikersIterator) Next() AccountLike {
+	it.value = AccountLike{}
+	for it.i < len(it.likes) {
+		like := it.likes[it.i]
+		it.i++
+		if like.Ts < it.since || like.Ts > it.until {
+			continue
+		}
+		if it.value.ID != 0 && it.value.ID != like.ID {
+			it.i--
+			break
+		}
+		if like.Ts >= it.value.Ts {
+			it.value = like
+		}
+	}
+	return it.value
+}
+
+func (it *LikersIterator) Cur() AccountLike {
+	return it.value
+}
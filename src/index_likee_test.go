@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIndexLikee(t *testing.T) {
+	index := NewIndexLikee()
+
+	adds := []struct {
+		liker ID
+		ts    uint32
+		first bool
+	}{
+		{3, 100, true},
+		{5, 200, true},
+		{3, 300, false},
+		{1, 50, true},
+		{5, 150, false},
+	}
+	for _, add := range adds {
+		if first := index.Add(10, add.liker, add.ts); first != add.first {
+			t.Errorf("Add(10, %d, %d) = %v, want %v", add.liker, add.ts, first, add.first)
+		}
+	}
+
+	if count := index.Count(10); count != 3 {
+		t.Errorf("Count(10) = %d, want 3", count)
+	}
+	if got := index.Find(10); !equalIDS(got, IDS{5, 3, 1}) {
+		t.Errorf("Find(10) = %v, want %v", got, IDS{5, 3, 1})
+	}
+	if likes := index.FindLikes(10); len(likes) != 5 {
+		t.Errorf("FindLikes(10) = %v, want 5 likes", likes)
+	}
+	ids := make(IDS, 0)
+	for it := index.Iter(10); it.Cur() != 0; it.Next() {
+		ids = append(ids, it.Cur())
+	}
+	if !equalIDS(ids, IDS{5, 3, 1}) {
+		t.Errorf("Iter(10) = %v, want %v", ids, IDS{5, 3, 1})
+	}
+
+	// all likes of liker are removed
+	index.Remove(10, 3)
+	if got := index.Find(10); !equalIDS(got, IDS{5, 1}) {
+		t.Errorf("Find(10) after remove = %v, want %v", got, IDS{5, 1})
+	}
+	if first := index.Add(10, 3, 400); !first {
+		t.Error("Add(10, 3, 400) after remove is not the first")
+	}
+
+	if count := index.Count(20); count != 0 {
+		t.Errorf("Count(20) = %d, want 0", count)
+	}
+	if it := index.Iter(20); it.Cur() != 0 {
+		t.Errorf("Iter(20) = %d, want empty", it.Cur())
+	}
+}
+
+func TestLikersIterator(t *testing.T) {
+	// sorted by liker descending, likes of liker are not ordered
+	likes := AccountLikes{{7, 300}, {7, 100}, {7, 200}, {5, 150}, {3, 50}, {3, 400}, {1, 250}}
+
+	tests := []struct {
+		since uint32
+		until uint32
+		want  []AccountLike
+	}{
+		{0, math.MaxUint32, []AccountLike{{7, 300}, {5, 150}, {3, 400}, {1, 250}}},
+		{0, 250, []AccountLike{{7, 200}, {5, 150}, {3, 50}, {1, 250}}},
+		{200, 300, []AccountLike{{7, 300}, {1, 250}}},
+		{100, 100, []AccountLike{{7, 100}}},
+		{500, math.MaxUint32, []AccountLike{}},
+	}
+
+	for _, test := range tests {
+		got := make([]AccountLike, 0)
+		for it := NewLikersIterator(likes, test.since, test.until); it.Cur().ID != 0; it.Next() {
+			got = append(got, it.Cur())
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("since %d until %d: got %v, want %v", test.since, test.until, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("since %d until %d: got %v, want %v", test.since, test.until, got, test.want)
+				break
+			}
+		}
+	}
+
+	if it := NewLikersIterator(AccountLikes{}, 0, math.MaxUint32); it.Cur().ID != 0 {
+		t.Errorf("empty likes: got %v", it.Cur())
+	}
+}
@@ -16,21 +16,22 @@ func NewIndexLiker() *IndexLiker {
 	}
 }
 
-func (index *IndexLiker) Add(liker ID, likee ID, ts uint32) {
+// Add inserts like and reports whether it is the first like of likee by liker.
+func (index *IndexLiker) Add(liker ID, likee ID, ts uint32) bool {
 	index.rwLock.RLock()
 	_, ok := index.likers[liker]
 	if !ok {
 		index.rwLock.RUnlock()
 		index.rwLock.Lock()
-		index.likers[liker] = NewIndexLikes(0)
+		if _, ok := index.likers[liker]; !ok {
+			index.likers[liker] = NewIndexLikes(0)
+		}
 		index.rwLock.Unlock()
 		index.rwLock.RLock()
-		index.likers[liker].Add(likee, ts)
-		index.rwLock.RUnlock()
-		return
 	}
-	index.likers[liker].Add(likee, ts)
+	first := index.likers[liker].Add(likee, ts)
 	index.rwLock.RUnlock()
+	return first
 }
 
 func (index *IndexLiker) Append(liker ID, likee ID, ts uint32) {
@@ -61,6 +62,16 @@ func (index *IndexLiker) Find(liker ID) AccountLikes {
 	return make(AccountLikes, 0)
 }
 
+// Count returns count of distinct likees of liker.
+func (index *IndexLiker) Count(liker ID) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.likers[liker]; ok {
+		count = index.likers[liker].Distinct()
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexLiker) UpdateAll() {
 	index.rwLock.Lock()
 	for liker := range index.likers {
@@ -81,8 +92,9 @@ func (index *IndexLiker) UpdateAll() {
 // }
 
 type IndexLikes struct {
-	rwLock sync.RWMutex
-	likes  AccountLikes
+	rwLock   sync.RWMutex
+	likes    AccountLikes
+	distinct int // ids without repeats
 }
 
 func NewIndexLikes(N int) *IndexLikes {
@@ -99,16 +111,25 @@ func (index *IndexLikes) Len() int {
 	return len(index.likes)
 }
 
-func (index *IndexLikes) Add(likee ID, ts uint32) {
+// Distinct returns count of ids without repeats.
+func (index *IndexLikes) Distinct() int {
+	index.rwLock.RLock()
+	distinct := index.distinct
+	index.rwLock.RUnlock()
+	return distinct
+}
+
+// Add inserts like and reports whether it is the first like of likee.
+func (index *IndexLikes) Add(likee ID, ts uint32) bool {
 	index.rwLock.Lock()
 	n := len(index.likes)
 	i := sort.Search(n, func(i int) bool {
 		return index.likes[i].ID <= likee
 	})
-	// if i < n && index.likes[i].ID == likee {
-	// 	index.rwLock.Unlock()
-	// 	return
-	// }
+	first := i == n || index.likes[i].ID != likee
+	if first {
+		index.distinct++
+	}
 	index.likes = append(index.likes, AccountLike{})
 	copy(index.likes[i+1:], index.likes[i:])
 	index.likes[i] = AccountLike{
@@ -116,6 +137,7 @@ func (index *IndexLikes) Add(likee ID, ts uint32) {
 		Ts: ts,
 	}
 	index.rwLock.Unlock()
+	return first
 }
 
 func (index *IndexLikes) Append(id ID, ts uint32) {
@@ -130,9 +152,41 @@ func (index *IndexLikes) Append(id ID, ts uint32) {
 func (index *IndexLikes) Update() {
 	index.rwLock.Lock()
 	sort.Sort(index.likes)
+	index.distinct = 0
+	for i := range index.likes {
+		if i == 0 || index.likes[i-1].ID != index.likes[i].ID {
+			index.distinct++
+		}
+	}
+	index.rwLock.Unlock()
+}
+
+// RemoveAll removes all likes of id.
+func (index *IndexLikes) RemoveAll(id ID) {
+	index.rwLock.Lock()
+	n := len(index.likes)
+	i := sort.Search(n, func(i int) bool {
+		return index.likes[i].ID <= id
+	})
+	j := i
+	for j < n && index.likes[j].ID == id {
+		j++
+	}
+	if j > i {
+		index.distinct--
+	}
+	index.likes = append(index.likes[:i], index.likes[j:]...)
 	index.rwLock.Unlock()
 }
 
+// Contains reports whether likes sorted by likee contain likee.
+func (al AccountLikes) Contains(likee ID) bool {
+	i := sort.Search(len(al), func(i int) bool {
+		return al[i].ID <= likee
+	})
+	return i < len(al) && al[i].ID == likee
+}
+
 func (al AccountLikes) Len() int {
 	return len(al)
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type IndexPhoneEntry struct {
+	Phone string
+	ID    ID
+}
+
+type IndexPhoneEntries []IndexPhoneEntry
+
+// IndexPhone keeps phones sorted to find them by prefix.
+type IndexPhone struct {
+	rwLock  sync.RWMutex
+	entries IndexPhoneEntries
+}
+
+func NewIndexPhone() *IndexPhone {
+	return &IndexPhone{
+		entries: make(IndexPhoneEntries, 0),
+	}
+}
+
+func (index *IndexPhone) Add(phone string, id ID) {
+	index.rwLock.Lock()
+	n := len(index.entries)
+	i := index.search(phone, id)
+	if i < n && index.entries[i].Phone == phone && index.entries[i].ID == id {
+		index.rwLock.Unlock()
+		return
+	}
+	index.entries = append(index.entries, IndexPhoneEntry{})
+	copy(index.entries[i+1:], index.entries[i:])
+	index.entries[i] = IndexPhoneEntry{Phone: phone, ID: id}
+	index.rwLock.Unlock()
+}
+
+func (index *IndexPhone) Append(phone string, id ID) {
+	index.rwLock.Lock()
+	index.entries = append(index.entries, IndexPhoneEntry{Phone: phone, ID: id})
+	index.rwLock.Unlock()
+}
+
+func (index *IndexPhone) Update() {
+	index.rwLock.Lock()
+	sort.Sort(index.entries)
+	index.rwLock.Unlock()
+}
+
+func (index *IndexPhone) Remove(phone string, id ID) {
+	index.rwLock.Lock()
+	n := len(index.entries)
+	i := index.search(phone, id)
+	if i < n && index.entries[i].Phone == phone && index.entries[i].ID == id {
+		index.entries = append(index.entries[:i], index.entries[i+1:]...)
+	}
+	index.rwLock.Unlock()
+}
+
+func (index *IndexPhone) Find(phone string) IDS {
+	return index.find(phone, false)
+}
+
+func (index *IndexPhone) FindPrefix(prefix string) IDS {
+	return index.find(prefix, true)
+}
+
+func (index *IndexPhone) Iter(phone string) IndexIterator {
+	return NewIndexIDIterator(index.Find(phone))
+}
+
+func (index *IndexPhone) IterPrefix(prefix string) IndexIterator {
+	return NewIndexIDIterator(index.FindPrefix(prefix))
+}
+
+func (index *IndexPhone) Count(phone string) int {
+	index.rwLock.RLock()
+	from, to := index.bounds(phone, false)
+	index.rwLock.RUnlock()
+	return to - from
+}
+
+func (index *IndexPhone) CountPrefix(prefix string) int {
+	index.rwLock.RLock()
+	from, to := index.bounds(prefix, true)
+	index.rwLock.RUnlock()
+	return to - from
+}
+
+func (index *IndexPhone) Len() int {
+	index.rwLock.RLock()
+	entriesLen := len(index.entries)
+	index.rwLock.RUnlock()
+	return entriesLen
+}
+
+func (index *IndexPhone) find(phone string, prefix bool) IDS {
+	index.rwLock.RLock()
+	from, to := index.bounds(phone, prefix)
+	ids := make(IDS, 0, to-from)
+	for _, entry := range index.entries[from:to] {
+		ids = append(ids, entry.ID)
+	}
+	index.rwLock.RUnlock()
+	sort.Sort(ids)
+	return ids
+}
+
+func (index *IndexPhone) search(phone string, id ID) int {
+	return sort.Search(len(index.entries), func(i int) bool {
+		entry := index.entries[i]
+		return entry.Phone > phone || (entry.Phone == phone && entry.ID >= id)
+	})
+}
+
+func (index *IndexPhone) bounds(phone string, prefix bool) (from, to int) {
+	n := len(index.entries)
+	from = sort.Search(n, func(i int) bool {
+		return index.entries[i].Phone >= phone
+	})
+	to = from + sort.Search(n-from, func(i int) bool {
+		entry := index.entries[from+i]
+		if prefix {
+			return !strings.HasPrefix(entry.Phone, phone)
+		}
+		return entry.Phone != phone
+	})
+	return from, to
+}
+
+func (entries IndexPhoneEntries) Len() int      { return len(entries) }
+func (entries IndexPhoneEntries) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
+func (entries IndexPhoneEntries) Less(i, j int) bool {
+	if entries[i].Phone == entries[j].Phone {
+		return entries[i].ID < entries[j].ID
+	}
+	return entries[i].Phone < entries[j].Phone
+}
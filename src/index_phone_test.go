@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIndexPhone(t *testing.T) {
+	index := NewIndexPhone()
+	index.Append("8(912)1234567", 5)
+	index.Append("8(903)7654321", 3)
+	index.Append("8(912)1234567", 1)
+	index.Append("8(912)7654321", 2)
+	index.Append("8(9121)000000", 4)
+	index.Update()
+
+	tests := []struct {
+		phone  string
+		prefix bool
+		want   IDS
+	}{
+		{"8(912)1234567", false, IDS{5, 1}},
+		{"8(912)7654321", false, IDS{2}},
+		{"8(912)", false, IDS{}},
+		{"8(912)", true, IDS{5, 2, 1}},
+		{"8(912", true, IDS{5, 4, 2, 1}},
+		{"8(9", true, IDS{5, 4, 3, 2, 1}},
+		{"8(912)12", true, IDS{5, 1}},
+		{"8(913)", true, IDS{}},
+		{"9", true, IDS{}},
+		{"", true, IDS{5, 4, 3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		var got IDS
+		var count int
+		if test.prefix {
+			got, count = index.FindPrefix(test.phone), index.CountPrefix(test.phone)
+		} else {
+			got, count = index.Find(test.phone), index.Count(test.phone)
+		}
+		if !equalIDS(got, test.want) {
+			t.Errorf("find %q (prefix %v) = %v, want %v", test.phone, test.prefix, got, test.want)
+		}
+		if count != len(test.want) {
+			t.Errorf("count %q (prefix %v) = %d, want %d", test.phone, test.prefix, count, len(test.want))
+		}
+	}
+
+	index.Add("8(912)1234567", 3)
+	index.Add("8(912)1234567", 3)
+	index.Remove("8(912)1234567", 5)
+	index.Remove("8(912)1234567", 6)
+	if got, want := index.Find("8(912)1234567"), (IDS{3, 1}); !equalIDS(got, want) {
+		t.Errorf("find after add and remove = %v, want %v", got, want)
+	}
+	if got, want := index.Len(), 5; got != want {
+		t.Errorf("len = %d, want %d", got, want)
+	}
+}
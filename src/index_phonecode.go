@@ -101,6 +101,15 @@ func (index *IndexPhoneCode) Iter(phoneCode uint16) IndexIterator {
 	return EmptyIndexIterator
 }
 
+func (index *IndexPhoneCode) Count(phoneCode uint16) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.phoneCodes[phoneCode]; ok {
+		count = len(index.phoneCodes[phoneCode].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexPhoneCode) Len() int {
 	index.rwLock.RLock()
 	phoneCodesLen := len(index.phoneCodes)
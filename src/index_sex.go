@@ -90,6 +90,26 @@ func (index *IndexSex) Find(s byte) IDS {
 	return make(IDS, 0)
 }
 
+func (index *IndexSex) Iter(s byte) IndexIterator {
+	index.rwLock.RLock()
+	if _, ok := index.sex[s]; ok {
+		iter := index.sex[s].Iter()
+		index.rwLock.RUnlock()
+		return iter
+	}
+	index.rwLock.RUnlock()
+	return EmptyIndexIterator
+}
+
+func (index *IndexSex) Count(s byte) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.sex[s]; ok {
+		count = len(index.sex[s].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexSex) Len() int {
 	index.rwLock.RLock()
 	sexLen := len(index.sex)
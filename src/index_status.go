@@ -90,6 +90,26 @@ func (index *IndexStatus) Find(s byte) IDS {
 	return make(IDS, 0)
 }
 
+func (index *IndexStatus) Iter(s byte) IndexIterator {
+	index.rwLock.RLock()
+	if _, ok := index.statuses[s]; ok {
+		iter := index.statuses[s].Iter()
+		index.rwLock.RUnlock()
+		return iter
+	}
+	index.rwLock.RUnlock()
+	return EmptyIndexIterator
+}
+
+func (index *IndexStatus) Count(s byte) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.statuses[s]; ok {
+		count = len(index.statuses[s].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexStatus) Len() int {
 	index.rwLock.RLock()
 	statusesLen := len(index.statuses)
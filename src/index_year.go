@@ -101,6 +101,41 @@ func (index *IndexYear) Iter(year Year) IndexIterator {
 	return EmptyIndexIterator
 }
 
+func (index *IndexYear) Count(year Year) (count int) {
+	index.rwLock.RLock()
+	if _, ok := index.years[year]; ok {
+		count = len(index.years[year].FindAll())
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
+func (index *IndexYear) IterRange(gte, lte Year) IndexIterator {
+	iters := make([]IndexIterator, 0, 16)
+	index.rwLock.RLock()
+	for year := range index.years {
+		if year >= gte && year <= lte {
+			iters = append(iters, index.years[year].Iter())
+		}
+	}
+	index.rwLock.RUnlock()
+	if len(iters) == 0 {
+		return EmptyIndexIterator
+	}
+	return NewUnionIndexIterator(iters...)
+}
+
+func (index *IndexYear) CountRange(gte, lte Year) (count int) {
+	index.rwLock.RLock()
+	for year := range index.years {
+		if year >= gte && year <= lte {
+			count += len(index.years[year].FindAll())
+		}
+	}
+	index.rwLock.RUnlock()
+	return count
+}
+
 func (index *IndexYear) Len() int {
 	index.rwLock.RLock()
 	yearsLen := len(index.years)
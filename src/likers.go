@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Likers is a query for accounts which liked account, every liker is
+// taken once with its latest like.
+type Likers struct {
+	limit    int
+	orderAsc bool
+	since    uint32
+	until    uint32
+}
+
+var likersPool = sync.Pool{
+	New: func() interface{} {
+		return &Likers{}
+	},
+}
+
+func BorrowLikers() *Likers {
+	l := likersPool.Get().(*Likers)
+	l.Reset()
+	return l
+}
+
+func NewLikers() *Likers {
+	l := &Likers{}
+	l.Reset()
+	return l
+}
+
+func (likers *Likers) Release() {
+	likersPool.Put(likers)
+}
+
+func (likers *Likers) Reset() {
+	likers.limit = 0
+	likers.orderAsc = false
+	likers.since = 0
+	likers.until = math.MaxUint32
+}
+
+func (likers *Likers) Limit() int {
+	return likers.limit
+}
+
+func (likers *Likers) OrderAsc() bool {
+	return likers.orderAsc
+}
+
+func (likers *Likers) Since() uint32 {
+	return likers.since
+}
+
+func (likers *Likers) Until() uint32 {
+	return likers.until
+}
+
+func (likers *Likers) Parse(query string) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for param, paramValues := range values {
+		if len(paramValues) != 1 || paramValues[0] == "" {
+			return errors.New("Invalid likers param value")
+		}
+
+		err := likers.ParseParam(param, paramValues[0])
+		if err != nil {
+			return err
+		}
+	}
+	if likers.limit == 0 {
+		return errors.New("Limit should be specified")
+	}
+	if likers.since > likers.until {
+		return errors.New("Since should be less or equal until")
+	}
+	return nil
+}
+
+func (likers *Likers) ParseParam(param string, value string) error {
+	switch param {
+	case "limit":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid limit value")
+		}
+		likers.limit = int(ui64)
+	case "order":
+		switch value {
+		case "1":
+			likers.orderAsc = true
+		case "-1":
+			likers.orderAsc = false
+		default:
+			return errors.New("Invalid order value")
+		}
+	case "since":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return errors.New("Invalid since value")
+		}
+		likers.since = uint32(ui64)
+	case "until":
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return errors.New("Invalid until value")
+		}
+		likers.until = uint32(ui64)
+	case "query_id":
+		// skip
+	default:
+		return errors.New("Unknown likers param")
+	}
+
+	return nil
+}
+
+func (likers *Likers) Sex() bool       { return true }
+func (likers *Likers) Status() bool    { return true }
+func (likers *Likers) Fname() bool     { return true }
+func (likers *Likers) Sname() bool     { return true }
+func (likers *Likers) Phone() bool     { return false }
+func (likers *Likers) Country() bool   { return false }
+func (likers *Likers) City() bool      { return false }
+func (likers *Likers) Birth() bool     { return true }
+func (likers *Likers) Premium() bool   { return false }
+func (likers *Likers) Interests() bool { return false }
@@ -28,6 +28,15 @@ func main() {
 	var (
 		dataset = flag.String("dataset", "/tmp/data", "Dataset")
 		addr    = flag.String("addr", ":80", "Addr")
+
+		uniquePhone = flag.Bool("unique-phone", false, "Reject accounts with phone already taken")
+		groupConfig = flag.String("group-config", "", "File with precomputed group filter and keys combinations")
+		groupLikes  = flag.String("group-likes", "", "Group keys kept per likee for likes filter, e.g. city;country;sex,status")
+		groupStats  = flag.Bool("group-stats", false, "Maintain age, premium, interests and likes sums in group indexes")
+
+		recommendScorer       = flag.String("recommend-scorer", "default", "Recommend scorer, default or weighted")
+		recommendExcludeLiked = flag.Bool("recommend-exclude-liked", false, "Skip accounts already liked by requester in recommend for legacy clients, clients sending v=2 skip them anyway, exclude_liked param overrides it")
+		recommendWeights      = flag.String("recommend-weights", "", "Weights of weighted recommend scorer, e.g. premium=100,status=10,interests=5,age=-0.5,city=2,likes=0.1")
 	)
 	flag.Parse()
 
@@ -42,6 +51,37 @@ func main() {
 
 	fmt.Println("Create store")
 	store := NewStore(dicts, now, rating)
+	store.SetUniquePhone(*uniquePhone)
+	store.SetGroupStats(*groupStats)
+	if *groupConfig != "" {
+		filterGroups, err := ReadGroupConfig(*groupConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store.SetGroupCombos(filterGroups)
+	}
+	if *groupLikes != "" {
+		likesGroups, err := ParseGroupMasks(*groupLikes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store.SetGroupLikes(likesGroups)
+	}
+
+	weights := DefaultRecommendWeights()
+	if *recommendWeights != "" {
+		err := ParseRecommendWeights(*recommendWeights, &weights)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	store.SetRecommendWeights(weights)
+	scorer, err := NewRecommendScorer(*recommendScorer, weights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store.SetRecommendScorer(scorer)
+	store.SetRecommendExcludeLiked(*recommendExcludeLiked)
 
 	server := NewServer(store, parser, dicts, &ServerOptions{
 		Addr: *addr,
@@ -106,7 +146,7 @@ func main() {
 	fmt.Println("Run GC...")
 	runtime.GC()
 
-	err := server.Handle()
+	err = server.Handle()
 	if err != nil {
 		log.Fatal(err)
 	}
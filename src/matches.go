@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Matches is a query for accounts which account liked and which liked
+// account back, latest likes go first.
+type Matches struct {
+	limit int
+
+	// position of the last match of previous page
+	cursor   bool
+	cursorTs uint32
+	cursorID ID
+}
+
+var matchesPool = sync.Pool{
+	New: func() interface{} {
+		return &Matches{}
+	},
+}
+
+func BorrowMatches() *Matches {
+	m := matchesPool.Get().(*Matches)
+	m.Reset()
+	return m
+}
+
+func NewMatches() *Matches {
+	return &Matches{}
+}
+
+func (matches *Matches) Release() {
+	matchesPool.Put(matches)
+}
+
+func (matches *Matches) Reset() {
+	matches.limit = 0
+	matches.cursor = false
+	matches.cursorTs = 0
+	matches.cursorID = 0
+}
+
+func (matches *Matches) Limit() int {
+	return matches.limit
+}
+
+// After reports whether match goes after cursor, so it belongs to
+// requested page.
+func (matches *Matches) After(match *Match) bool {
+	if !matches.cursor {
+		return true
+	}
+	if match.Ts != matches.cursorTs {
+		return match.Ts < matches.cursorTs
+	}
+	return match.Account.ID < matches.cursorID
+}
+
+func (matches *Matches) Parse(query string) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for param, paramValues := range values {
+		if len(paramValues) != 1 || paramValues[0] == "" {
+			return errors.New("Invalid matches param value")
+		}
+
+		err := matches.ParseParam(param, paramValues[0])
+		if err != nil {
+			return err
+		}
+	}
+	if matches.limit == 0 {
+		return errors.New("Limit should be specified")
+	}
+	return nil
+}
+
+func (matches *Matches) ParseParam(param string, value string) error {
+	switch param {
+	case "limit":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid limit value")
+		}
+		matches.limit = int(ui64)
+	case "cursor":
+		ts, id, err := DecodeMatchesCursor(value)
+		if err != nil {
+			return err
+		}
+		matches.cursor = true
+		matches.cursorTs = ts
+		matches.cursorID = id
+	case "query_id":
+		// skip
+	default:
+		return errors.New("Unknown matches param")
+	}
+
+	return nil
+}
+
+// Cursor points after the last match of page, it is opaque for clients.
+func EncodeMatchesCursor(ts uint32, id ID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatUint(uint64(ts), 10) + ":" + strconv.FormatUint(uint64(id), 10),
+	))
+}
+
+func DecodeMatchesCursor(cursor string) (uint32, ID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, errors.New("Invalid cursor value")
+	}
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("Invalid cursor value")
+	}
+	ts, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, errors.New("Invalid cursor value")
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, errors.New("Invalid cursor value")
+	}
+	return uint32(ts), ID(id), nil
+}
+
+func (matches *Matches) Sex() bool       { return true }
+func (matches *Matches) Status() bool    { return true }
+func (matches *Matches) Fname() bool     { return true }
+func (matches *Matches) Sname() bool     { return true }
+func (matches *Matches) Phone() bool     { return false }
+func (matches *Matches) Country() bool   { return false }
+func (matches *Matches) City() bool      { return false }
+func (matches *Matches) Birth() bool     { return true }
+func (matches *Matches) Premium() bool   { return false }
+func (matches *Matches) Interests() bool { return false }
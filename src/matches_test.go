@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchesCursor(t *testing.T) {
+	tests := []struct {
+		ts uint32
+		id ID
+	}{
+		{0, 0},
+		{1520000000, 4},
+		{1<<32 - 1, 1<<32 - 1},
+	}
+
+	for _, test := range tests {
+		cursor := EncodeMatchesCursor(test.ts, test.id)
+		ts, id, err := DecodeMatchesCursor(cursor)
+		if err != nil || ts != test.ts || id != test.id {
+			t.Errorf("DecodeMatchesCursor(%s) = %d, %d, %v, want %d, %d", cursor, ts, id, err, test.ts, test.id)
+		}
+	}
+
+	for _, cursor := range []string{"", "x", "MTUyMDAwMDAwMA", "MTUyMDAwMDAwMDo0OjE", "eDo0", "MTo", "MTUyMDAwMDAwMDo0=", "NDI5NDk2NzI5Njox"} {
+		if _, _, err := DecodeMatchesCursor(cursor); err == nil {
+			t.Errorf("DecodeMatchesCursor(%q): expected error", cursor)
+		}
+	}
+}
+
+func TestMatchesAfter(t *testing.T) {
+	matches := NewMatches()
+	if err := matches.Parse("limit=1&cursor=" + EncodeMatchesCursor(1520000000, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ts    uint32
+		id    ID
+		after bool
+	}{
+		{1520000001, 1, false},
+		{1520000000, 5, false},
+		{1520000000, 4, false},
+		{1520000000, 3, true},
+		{1519999999, 100, true},
+	}
+
+	for _, test := range tests {
+		match := &Match{Account: &Account{ID: test.id}, Ts: test.ts}
+		if got := matches.After(match); got != test.after {
+			t.Errorf("After(%d, %d) = %v, want %v", test.ts, test.id, got, test.after)
+		}
+	}
+
+	for _, query := range []string{"", "limit=0", "limit=x", "limit=1&cursor=x", "limit=1&offset=1", "limit=1&limit=2"} {
+		matches := NewMatches()
+		if err := matches.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"io"
+	"math"
 	"strconv"
 	"strings"
 
@@ -99,6 +100,37 @@ func (parser *Parser) DecodeLikes(data []byte, likes *Likes) error {
 	return nil
 }
 
+// DecodeBlocks decodes blocked accounts like {"ids": [1, 2]}.
+func (parser *Parser) DecodeBlocks(data []byte, ids *IDS) error {
+	found := false
+	err := gojay.UnmarshalJSONObject(data, gojay.DecodeObjectFunc(func(dec *gojay.Decoder, key string) error {
+		switch key {
+		case "ids":
+			found = true
+			return dec.Array(gojay.DecodeArrayFunc(func(dec *gojay.Decoder) error {
+				var id uint32
+				err := dec.Uint32(&id)
+				if err != nil {
+					return err
+				}
+				if id == 0 {
+					return errors.New("Invalid blocked id")
+				}
+				*ids = append(*ids, ID(id))
+				return nil
+			}))
+		}
+		return errors.New(`Unknown blocks field "` + key + `"`)
+	}))
+	if err != nil {
+		return err
+	}
+	if !found || len(*ids) == 0 {
+		return errors.New("Blocked ids should be specified")
+	}
+	return nil
+}
+
 func (parser *Parser) EncodeAccounts(accounts AccountsBuffer, buffer io.Writer, fields SerializeFields) {
 	enc := gojay.BorrowEncoder(buffer)
 	defer enc.Release()
@@ -112,6 +144,309 @@ func (parser *Parser) EncodeAccounts(accounts AccountsBuffer, buffer io.Writer,
 	}))
 }
 
+func (parser *Parser) EncodeAccountsPlan(accounts AccountsBuffer, buffer io.Writer, fields SerializeFields, plan *FilterPlan) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("accounts", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for _, account := range accounts {
+				enc.Object(parser.AccountEncodeFunc(account, fields))
+			}
+		}))
+		enc.AddObjectKey("explain", parser.PlanEncodeFunc(plan))
+	}))
+}
+
+func (parser *Parser) EncodeCountPlan(count int, buffer io.Writer, plan *FilterPlan) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddIntKey("count", count)
+		enc.AddObjectKey("explain", parser.PlanEncodeFunc(plan))
+	}))
+}
+
+func (parser *Parser) PlanEncodeFunc(plan *FilterPlan) gojay.EncodeObjectFunc {
+	return gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("plan", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for _, step := range plan.Steps {
+				enc.Object(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+					enc.AddStringKey("index", step.Index)
+					enc.AddIntKey("estimate", step.Estimate)
+				}))
+			}
+		}))
+		enc.AddIntKey("estimated", plan.Estimate)
+		enc.AddIntKey("scanned", plan.Scanned)
+	})
+}
+
+func (parser *Parser) EncodeRecommendExplained(accounts AccountsBuffer, buffer io.Writer, recommend *Recommend) {
+	explains := recommend.Explains()
+	parser.encodeAccountsExplained(accounts, buffer, recommend, func(i int) gojay.EncodeObjectFunc {
+		return parser.RecommendExplainEncodeFunc(&explains[i])
+	})
+}
+
+func (parser *Parser) EncodeSuggestExplained(accounts AccountsBuffer, buffer io.Writer, suggest *Suggest) {
+	explains := suggest.Explains()
+	parser.encodeAccountsExplained(accounts, buffer, suggest, func(i int) gojay.EncodeObjectFunc {
+		return parser.SuggestExplainEncodeFunc(&explains[i])
+	})
+}
+
+// encodeAccountsExplained adds "_explain" object to every account.
+func (parser *Parser) encodeAccountsExplained(accounts AccountsBuffer, buffer io.Writer, fields SerializeFields, explain func(i int) gojay.EncodeObjectFunc) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("accounts", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i, account := range accounts {
+				accountFunc := parser.AccountEncodeFunc(account, fields)
+				explainFunc := explain(i)
+				enc.Object(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+					accountFunc(enc)
+					enc.AddObjectKey("_explain", explainFunc)
+				}))
+			}
+		}))
+	}))
+}
+
+func (parser *Parser) RecommendExplainEncodeFunc(explain *RecommendExplain) gojay.EncodeObjectFunc {
+	return gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddBoolKey("premium", explain.Premium)
+		enc.AddIntKey("status_rank", explain.StatusRank)
+		enc.AddArrayKey("interests", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for _, interest := range explain.Interests {
+				interestStr, err := parser.dicts.GetInterestString(interest)
+				if err == nil {
+					enc.AddString(interestStr)
+				}
+			}
+		}))
+		enc.AddFloat64Key("age_gap", roundFloat(explain.AgeGap))
+		enc.AddFloat64Key("score", explain.Score)
+	})
+}
+
+func (parser *Parser) SuggestExplainEncodeFunc(explain *SuggestExplain) gojay.EncodeObjectFunc {
+	return gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("likers", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for _, liker := range explain.Likers {
+				enc.AddObject(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+					enc.AddUint32Key("id", uint32(liker.ID))
+					enc.AddFloat64Key("similarity", liker.Similarity)
+				}))
+			}
+		}))
+	})
+}
+
+func (parser *Parser) EncodeMatches(matchesBuffer *MatchesBuffer, buffer io.Writer, fields SerializeFields) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	matches := matchesBuffer.matches
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("accounts", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range matches {
+				enc.Object(parser.accountTsEncodeFunc(matches[i].Account, matches[i].Ts, fields))
+			}
+		}))
+		if matchesBuffer.next {
+			last := &matches[len(matches)-1]
+			enc.AddStringKey("next", EncodeMatchesCursor(last.Ts, last.Account.ID))
+		}
+	}))
+}
+
+func (parser *Parser) EncodeLikers(likersBuffer *LikersBuffer, buffer io.Writer, fields SerializeFields) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	likers := likersBuffer.likers
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("accounts", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range likers {
+				enc.Object(parser.accountTsEncodeFunc(likers[i].Account, likers[i].Ts, fields))
+			}
+		}))
+	}))
+}
+
+// accountTsEncodeFunc encodes account with timestamp of like.
+func (parser *Parser) accountTsEncodeFunc(account *Account, ts uint32, fields SerializeFields) gojay.EncodeObjectFunc {
+	accountFunc := parser.AccountEncodeFunc(account, fields)
+	return gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		accountFunc(enc)
+		enc.AddUint32Key("ts", ts)
+	})
+}
+
+func (parser *Parser) EncodeMatchesStats(stats MatchesStats, buffer io.Writer) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddIntKey("pairs", stats.Pairs)
+		enc.AddIntKey("accounts", stats.Accounts)
+	}))
+}
+
+func (parser *Parser) EncodeCount(count int, buffer io.Writer) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddIntKey("count", count)
+	}))
+}
+
+func (parser *Parser) EncodeGroupCombos(combos []IndexGroupComboStats, buffer io.Writer) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	memory := 0
+	for i := range combos {
+		memory += combos[i].Memory
+	}
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddIntKey("memory", memory)
+		enc.AddArrayKey("groups", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range combos {
+				combo := &combos[i]
+				enc.Object(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+					enc.AddStringKey("filter", GroupMaskString(combo.Filter))
+					enc.AddStringKey("keys", GroupMaskString(combo.Group))
+					enc.AddUint64Key("hits", combo.Hits)
+					enc.AddIntKey("values", combo.Values)
+					enc.AddIntKey("entries", combo.Entries)
+					enc.AddIntKey("memory", combo.Memory)
+				}))
+			}
+		}))
+	}))
+}
+
+func (parser *Parser) EncodePivot(pivotBuffer *PivotBuffer, buffer io.Writer) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	rows, cols := pivotBuffer.rows, pivotBuffer.cols
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddArrayKey("rows", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range rows {
+				parser.encodeGroupKey(enc, pivotBuffer.rowKey, &rows[i])
+			}
+		}))
+		enc.AddArrayKey("cols", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range cols {
+				parser.encodeGroupKey(enc, pivotBuffer.colKey, &cols[i])
+			}
+		}))
+		enc.AddArrayKey("cells", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for row := range rows {
+				enc.AddArray(gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+					for col := range cols {
+						enc.AddUint32(pivotBuffer.Cell(row, col))
+					}
+				}))
+			}
+		}))
+		enc.AddArrayKey("row_totals", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range rows {
+				enc.AddUint32(rows[i].Count)
+			}
+		}))
+		enc.AddArrayKey("col_totals", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range cols {
+				enc.AddUint32(cols[i].Count)
+			}
+		}))
+		enc.AddUint32Key("total", pivotBuffer.total)
+	}))
+}
+
+func (parser *Parser) EncodeCooccurrence(cooccurrenceBuffer *CooccurrenceBuffer, buffer io.Writer) {
+	enc := gojay.BorrowEncoder(buffer)
+	defer enc.Release()
+
+	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+		enc.AddUint32Key("total", cooccurrenceBuffer.total)
+		enc.AddArrayKey("interests", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+			for i := range cooccurrenceBuffer.interests {
+				entry := &cooccurrenceBuffer.interests[i]
+				interestStr, err := parser.dicts.GetInterestString(entry.Interest)
+				if err != nil {
+					continue
+				}
+				enc.AddObject(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+					enc.AddStringKey("interest", interestStr)
+					enc.AddUint32Key("count", entry.Count)
+					enc.AddArrayKey("cooccurring", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
+						for j := range entry.Pairs {
+							pair := &entry.Pairs[j]
+							pairStr, err := parser.dicts.GetInterestString(pair.Interest)
+							if err != nil {
+								continue
+							}
+							enc.AddObject(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
+								enc.AddStringKey("interest", pairStr)
+								enc.AddUint32Key("count", pair.Count)
+								enc.AddFloat64Key("lift", roundFloatTo(pair.Lift, 4))
+								enc.AddFloat64Key("jaccard", roundFloatTo(pair.Jaccard, 4))
+							}))
+						}
+					}))
+				}))
+			}
+		}))
+	}))
+}
+
+// encodeGroupKey adds decoded value of group key as array element.
+func (parser *Parser) encodeGroupKey(enc *gojay.Encoder, key GroupKey, groupEntry *GroupEntry) {
+	var (
+		str string
+		err error
+	)
+	switch key {
+	case GroupSex:
+		if groupEntry.GetSex() == SexFemale {
+			str = "f"
+		} else {
+			str = "m"
+		}
+	case GroupStatus:
+		str = statusString(groupEntry.GetStatus())
+	case GroupInterests:
+		str, err = parser.dicts.GetInterestString(groupEntry.GetInterest())
+	case GroupCountry:
+		str, err = parser.dicts.GetCountryString(groupEntry.GetCountry())
+	case GroupCity:
+		str, err = parser.dicts.GetCityString(groupEntry.GetCity())
+	case GroupBirth:
+		enc.AddInt(int(groupEntry.GetBirth()))
+		return
+	case GroupJoined:
+		enc.AddInt(int(groupEntry.GetJoined()))
+		return
+	case GroupLikes:
+		enc.AddUint32(LikesBucketMin(groupEntry.GetLikesBucket()))
+		return
+	}
+	if err != nil || str == "" {
+		enc.AddNull()
+		return
+	}
+	enc.AddString(str)
+}
+
 func (parser *Parser) EncodeGroupEntries(groupsBuffer *GroupsBuffer, buffer io.Writer) {
 	enc := gojay.NewEncoder(buffer)
 	defer enc.Release()
@@ -119,15 +454,18 @@ func (parser *Parser) EncodeGroupEntries(groupsBuffer *GroupsBuffer, buffer io.W
 	enc.Encode(gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
 		enc.AddArrayKey("groups", gojay.EncodeArrayFunc(func(enc *gojay.Encoder) {
 			if groupsBuffer.orderAsc {
-				for _, groupEntry := range groupsBuffer.groups {
-					enc.Object(parser.EncodeGroupFunc(groupEntry))
+				for i := range groupsBuffer.groups {
+					enc.Object(parser.EncodeGroupFunc(i, groupsBuffer))
 				}
 			} else {
 				for i := len(groupsBuffer.groups) - 1; i >= 0; i-- {
-					enc.Object(parser.EncodeGroupFunc(groupsBuffer.groups[i]))
+					enc.Object(parser.EncodeGroupFunc(i, groupsBuffer))
 				}
 			}
 		}))
+		if groupsBuffer.next > 0 {
+			enc.AddStringKey("next", EncodeGroupCursor(groupsBuffer.next))
+		}
 	}))
 }
 
@@ -235,6 +573,18 @@ func (parser *Parser) AccountDecodeFunc(rawAccount *RawAccount, update bool) goj
 				rawAccount.Likes = append(rawAccount.Likes, like)
 				return nil
 			}))
+		case "seeking":
+			var seekingStr string
+			err := readString(dec, &seekingStr, false)
+			if err != nil {
+				return err
+			}
+			seeking, err := parser.ParseSeeking(seekingStr)
+			if err != nil {
+				return err
+			}
+			rawAccount.Seeking = seeking
+			return nil
 		case "interests":
 			return dec.Array(gojay.DecodeArrayFunc(func(dec *gojay.Decoder) error {
 				var interest string
@@ -365,7 +715,9 @@ func (parser *Parser) AccountEncodeFunc(account *Account, fields SerializeFields
 	})
 }
 
-func (parser *Parser) EncodeGroupFunc(groupEntry *GroupEntry) gojay.EncodeObjectFunc {
+func (parser *Parser) EncodeGroupFunc(i int, groupsBuffer *GroupsBuffer) gojay.EncodeObjectFunc {
+	groupEntry := groupsBuffer.groups[i]
+	keysMask := groupsBuffer.keysMask
 	return gojay.EncodeObjectFunc(func(enc *gojay.Encoder) {
 		if groupEntry.GetSex() != 0 {
 			if groupEntry.GetSex() == SexFemale {
@@ -413,10 +765,62 @@ func (parser *Parser) EncodeGroupFunc(groupEntry *GroupEntry) gojay.EncodeObject
 			}
 		}
 
+		// years are stored as offsets, so zero does not mean null
+		if keysMask&GroupBirthMask > 0 {
+			enc.AddIntKey("birth", int(groupEntry.GetBirth()))
+		}
+
+		if keysMask&GroupJoinedMask > 0 {
+			enc.AddIntKey("joined", int(groupEntry.GetJoined()))
+		}
+
+		// bucket is printed as the least likes count in it
+		if keysMask&GroupLikesMask > 0 {
+			enc.AddUint32Key("likes_bucket", LikesBucketMin(groupEntry.GetLikesBucket()))
+		}
+
 		enc.AddUint32Key("count", groupEntry.Count)
+
+		if groupsBuffer.agg != 0 && groupsBuffer.stats[i] != nil {
+			parser.encodeGroupStats(enc, groupEntry, groupsBuffer.stats[i], groupsBuffer.agg, groupsBuffer.now)
+		}
 	})
 }
 
+func (parser *Parser) encodeGroupStats(enc *gojay.Encoder, groupEntry *GroupEntry, stats *GroupStats, agg GroupAgg, now uint32) {
+	count := float64(groupEntry.Count)
+
+	if agg&GroupAggAvgAge > 0 {
+		// age of average birth, it does not depend on when sums were taken
+		avgBirth := float64(stats.BirthSum) / count
+		enc.AddFloat64Key("avg_age", roundFloat((float64(now)-avgBirth)/secondsInYear))
+	}
+	if agg&GroupAggMinAge > 0 {
+		enc.AddIntKey("min_age", AgeAt(stats.BirthMax, now))
+	}
+	if agg&GroupAggMaxAge > 0 {
+		enc.AddIntKey("max_age", AgeAt(stats.BirthMin, now))
+	}
+	if agg&GroupAggPremiumShare > 0 {
+		enc.AddFloat64Key("premium_share", roundFloat(float64(stats.Premium)/count))
+	}
+	if agg&GroupAggAvgInterests > 0 {
+		enc.AddFloat64Key("avg_interests", roundFloat(float64(stats.Interests)/count))
+	}
+	if agg&GroupAggAvgLikes > 0 {
+		enc.AddFloat64Key("avg_likes", roundFloat(float64(stats.Likes)/count))
+	}
+}
+
+func roundFloat(f float64) float64 {
+	return roundFloatTo(f, 2)
+}
+
+func roundFloatTo(f float64, digits int) float64 {
+	scale := math.Pow10(digits)
+	return math.Floor(f*scale+0.5) / scale
+}
+
 func (parser *Parser) ParseStatus(status string) (byte, error) {
 	switch status {
 	case StatusSingleString:
@@ -436,6 +840,16 @@ func (parser *Parser) ParseSex(sex string) (byte, error) {
 	return sex[0], nil
 }
 
+func (parser *Parser) ParseSeeking(seeking string) (byte, error) {
+	if seeking == "any" {
+		return SeekingAny, nil
+	}
+	if len(seeking) != 1 || seeking[0] != SexFemale && seeking[0] != SexMale {
+		return 0, errors.New("Invalid account seeking")
+	}
+	return seeking[0], nil
+}
+
 func readString(dec *gojay.Decoder, str *string, unquote bool) error {
 	var buf []byte
 	err := dec.EmbeddedJSON((*gojay.EmbeddedJSON)(&buf))
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Pivot is a group by two keys laid out as matrix, it takes
+// the same filter params as group.
+type Pivot struct {
+	group     Group
+	rowKey    GroupKey
+	colKey    GroupKey
+	rowMask   GroupHash
+	colMask   GroupHash
+	rowsLimit int
+	colsLimit int
+}
+
+var pivotsPool = sync.Pool{
+	New: func() interface{} {
+		return &Pivot{
+			group: Group{
+				Keys: make([]GroupKey, 0, 2),
+			},
+		}
+	},
+}
+
+func BorrowPivot(parser *Parser, dicts *Dicts) *Pivot {
+	p := pivotsPool.Get().(*Pivot)
+	p.Reset()
+	p.group.parser = parser
+	p.group.dicts = dicts
+	return p
+}
+
+func NewPivot(parser *Parser, dicts *Dicts) *Pivot {
+	return &Pivot{
+		group: Group{
+			parser: parser,
+			dicts:  dicts,
+		},
+	}
+}
+
+func (pivot *Pivot) Release() {
+	pivotsPool.Put(pivot)
+}
+
+func (pivot *Pivot) Reset() {
+	pivot.group.Reset()
+	pivot.rowKey = 0
+	pivot.colKey = 0
+	pivot.rowMask = 0
+	pivot.colMask = 0
+	pivot.rowsLimit = 0
+	pivot.colsLimit = 0
+}
+
+func (pivot *Pivot) Group() *Group {
+	return &pivot.group
+}
+
+func (pivot *Pivot) RowKey() GroupKey {
+	return pivot.rowKey
+}
+
+func (pivot *Pivot) ColKey() GroupKey {
+	return pivot.colKey
+}
+
+// RowsLimit and ColsLimit keep top N headers by total, zero keeps all.
+func (pivot *Pivot) RowsLimit() int {
+	return pivot.rowsLimit
+}
+
+func (pivot *Pivot) ColsLimit() int {
+	return pivot.colsLimit
+}
+
+func (pivot *Pivot) Parse(query string) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	for param, paramValues := range values {
+		if len(paramValues) != 1 || paramValues[0] == "" {
+			return errors.New("Invalid pivot param value")
+		}
+
+		err := pivot.ParseParam(param, paramValues[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	if pivot.rowKey == 0 || pivot.colKey == 0 {
+		return errors.New("Rows and cols should be specified")
+	}
+	if pivot.rowKey == pivot.colKey {
+		return errors.New("Rows and cols should differ")
+	}
+
+	// all groups are needed to build matrix
+	group := &pivot.group
+	group.limit = math.MaxInt32
+	group.orderAsc = true
+	group.updateNoFilter()
+
+	return nil
+}
+
+func (pivot *Pivot) ParseParam(param string, value string) error {
+	group := &pivot.group
+
+	switch param {
+	case "rows", "cols":
+		key, mask, err := ParseGroupKey(value)
+		if err != nil {
+			return err
+		}
+		if group.KeysMask&mask > 0 {
+			return errors.New("Rows and cols should differ")
+		}
+		if param == "rows" {
+			pivot.rowKey, pivot.rowMask = key, mask
+		} else {
+			pivot.colKey, pivot.colMask = key, mask
+		}
+		group.Keys = append(group.Keys, key)
+		group.KeysMask |= mask
+	case "rows_limit", "cols_limit":
+		ui64, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || ui64 == 0 {
+			return errors.New("Invalid " + param + " value")
+		}
+		if param == "rows_limit" {
+			pivot.rowsLimit = int(ui64)
+		} else {
+			pivot.colsLimit = int(ui64)
+		}
+	case "keys", "order", "limit", "offset", "cursor", "sort", "agg":
+		return errors.New("Unknown pivot param")
+	default:
+		return group.ParseParam(param, value)
+	}
+
+	return nil
+}
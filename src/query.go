@@ -0,0 +1,422 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Query is a boolean filter expression passed in q= param, e.g.
+// (city=Москва OR country=Росмаль) AND NOT status=заняты AND interests HAS Спорт
+
+type QueryOp byte
+
+const (
+	QueryAnd QueryOp = iota + 1
+	QueryOr
+	QueryNot
+	QueryPred
+)
+
+type QueryField byte
+
+const (
+	QuerySex QueryField = iota + 1
+	QueryStatus
+	QueryFname
+	QuerySname
+	QueryPhoneCode
+	QueryCountry
+	QueryCity
+	QueryBirth
+	QueryBirthYear
+	QueryInterests
+	QueryLikes
+	QueryPremium
+	QueryEmailDomain
+)
+
+type QueryCmp byte
+
+const (
+	QueryEq QueryCmp = iota + 1
+	QueryLt
+	QueryGt
+	QueryHas
+)
+
+type QueryNode struct {
+	Op       QueryOp
+	Children []*QueryNode
+
+	// predicate
+	Field QueryField
+	Cmp   QueryCmp
+	Null  bool  // field=null
+	Empty bool  // unknown value, matches nothing
+	Value int64 // dict value, phone code, timestamp, year or account id
+	Gte   int64 // birth year bounds
+	Lte   int64
+	Str   string
+}
+
+type queryTokenType byte
+
+const (
+	queryTokenWord queryTokenType = iota + 1
+	queryTokenString
+	queryTokenLParen
+	queryTokenRParen
+	queryTokenCmp
+)
+
+type queryToken struct {
+	typ   queryTokenType
+	value string
+}
+
+type QueryParser struct {
+	parser *Parser
+	dicts  *Dicts
+	tokens []queryToken
+	pos    int
+}
+
+func ParseQuery(parser *Parser, dicts *Dicts, query string) (*QueryNode, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("Empty query")
+	}
+
+	qp := &QueryParser{
+		parser: parser,
+		dicts:  dicts,
+		tokens: tokens,
+	}
+
+	node, err := qp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if qp.pos != len(qp.tokens) {
+		return nil, errors.New("Unexpected query token " + qp.tokens[qp.pos].value)
+	}
+	return node, nil
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0, 16)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{queryTokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{queryTokenRParen, ")"})
+			i++
+		case c == '=' || c == '<' || c == '>':
+			tokens = append(tokens, queryToken{queryTokenCmp, string(c)})
+			i++
+		case c == '!':
+			if i+1 >= len(query) || query[i+1] != '=' {
+				return nil, errors.New("Invalid query operator")
+			}
+			tokens = append(tokens, queryToken{queryTokenCmp, "!="})
+			i += 2
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end == -1 {
+				return nil, errors.New("Unterminated query string")
+			}
+			tokens = append(tokens, queryToken{queryTokenString, query[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			start := i
+			for i < len(query) && strings.IndexByte(" \t\n\r()=<>!\"", query[i]) == -1 {
+				i++
+			}
+			tokens = append(tokens, queryToken{queryTokenWord, query[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+func (qp *QueryParser) peek() *queryToken {
+	if qp.pos < len(qp.tokens) {
+		return &qp.tokens[qp.pos]
+	}
+	return nil
+}
+
+func (qp *QueryParser) next() *queryToken {
+	token := qp.peek()
+	if token != nil {
+		qp.pos++
+	}
+	return token
+}
+
+func (qp *QueryParser) keyword(keyword string) bool {
+	token := qp.peek()
+	if token == nil || token.typ != queryTokenWord || strings.ToUpper(token.value) != keyword {
+		return false
+	}
+	qp.pos++
+	return true
+}
+
+func (qp *QueryParser) parseOr() (*QueryNode, error) {
+	node, err := qp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for qp.keyword("OR") {
+		right, err := qp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if node.Op == QueryOr {
+			node.Children = append(node.Children, right)
+		} else {
+			node = &QueryNode{Op: QueryOr, Children: []*QueryNode{node, right}}
+		}
+	}
+	return node, nil
+}
+
+func (qp *QueryParser) parseAnd() (*QueryNode, error) {
+	node, err := qp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for qp.keyword("AND") {
+		right, err := qp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if node.Op == QueryAnd {
+			node.Children = append(node.Children, right)
+		} else {
+			node = &QueryNode{Op: QueryAnd, Children: []*QueryNode{node, right}}
+		}
+	}
+	return node, nil
+}
+
+func (qp *QueryParser) parseNot() (*QueryNode, error) {
+	if qp.keyword("NOT") {
+		child, err := qp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNode{Op: QueryNot, Children: []*QueryNode{child}}, nil
+	}
+	return qp.parsePrimary()
+}
+
+func (qp *QueryParser) parsePrimary() (*QueryNode, error) {
+	token := qp.next()
+	if token == nil {
+		return nil, errors.New("Unexpected end of query")
+	}
+	if token.typ == queryTokenLParen {
+		node, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		token = qp.next()
+		if token == nil || token.typ != queryTokenRParen {
+			return nil, errors.New("Expected closing paren in query")
+		}
+		return node, nil
+	}
+	if token.typ != queryTokenWord {
+		return nil, errors.New("Expected field name in query")
+	}
+	field := token.value
+
+	var cmp string
+	if qp.keyword("HAS") {
+		cmp = "HAS"
+	} else {
+		token = qp.next()
+		if token == nil || token.typ != queryTokenCmp {
+			return nil, errors.New("Expected operator after " + field)
+		}
+		cmp = token.value
+	}
+
+	token = qp.next()
+	if token == nil || (token.typ != queryTokenWord && token.typ != queryTokenString) {
+		return nil, errors.New("Expected value for " + field)
+	}
+
+	if cmp == "!=" {
+		node, err := qp.parsePredicate(field, "=", token)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNode{Op: QueryNot, Children: []*QueryNode{node}}, nil
+	}
+	return qp.parsePredicate(field, cmp, token)
+}
+
+func (qp *QueryParser) parsePredicate(field string, cmp string, token *queryToken) (*QueryNode, error) {
+	node := &QueryNode{Op: QueryPred, Cmp: QueryEq}
+	value := token.value
+	null := token.typ == queryTokenWord && value == "null"
+
+	switch cmp {
+	case "=":
+	case "<":
+		node.Cmp = QueryLt
+	case ">":
+		node.Cmp = QueryGt
+	case "HAS":
+		node.Cmp = QueryHas
+	default:
+		return nil, errors.New("Unknown query operator " + cmp)
+	}
+
+	switch field {
+	case "sex":
+		node.Field = QuerySex
+		sex, err := qp.parser.ParseSex(value)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = int64(sex)
+	case "status":
+		node.Field = QueryStatus
+		status, err := qp.parser.ParseStatus(value)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = int64(status)
+	case "fname":
+		node.Field = QueryFname
+		if null {
+			node.Null = true
+			break
+		}
+		fname, err := qp.dicts.GetFname(value)
+		if err != nil {
+			node.Empty = true
+		}
+		node.Value = int64(fname)
+	case "sname":
+		node.Field = QuerySname
+		if null {
+			node.Null = true
+			break
+		}
+		sname, err := qp.dicts.GetSname(value)
+		if err != nil {
+			node.Empty = true
+		}
+		node.Value = int64(sname)
+	case "phone_code":
+		node.Field = QueryPhoneCode
+		if null {
+			node.Null = true
+			break
+		}
+		ui64, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = int64(ui64)
+	case "country":
+		node.Field = QueryCountry
+		if null {
+			node.Null = true
+			break
+		}
+		country, err := qp.dicts.GetCountry(value)
+		if err != nil {
+			node.Empty = true
+		}
+		node.Value = int64(country)
+	case "city":
+		node.Field = QueryCity
+		if null {
+			node.Null = true
+			break
+		}
+		city, err := qp.dicts.GetCity(value)
+		if err != nil {
+			node.Empty = true
+		}
+		node.Value = int64(city)
+	case "birth":
+		node.Field = QueryBirth
+		if node.Cmp != QueryLt && node.Cmp != QueryGt {
+			return nil, errors.New("Birth supports only < and > operators")
+		}
+		ts, err := parseTimestamp(value)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = ts
+	case "birth_year":
+		node.Field = QueryBirthYear
+		ui64, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = int64(ui64)
+		node.Gte, node.Lte = YearToTimestamp(Year(ui64))
+	case "interests":
+		node.Field = QueryInterests
+		interest, err := qp.dicts.GetInterest(value)
+		if err != nil {
+			node.Empty = true
+		}
+		node.Value = int64(interest)
+	case "likes":
+		node.Field = QueryLikes
+		ui64, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = int64(ui64)
+	case "premium":
+		node.Field = QueryPremium
+		if null {
+			node.Null = true
+		} else if value != "now" {
+			return nil, errors.New("Premium supports only now and null values")
+		}
+	case "email_domain":
+		node.Field = QueryEmailDomain
+		node.Str = value
+	default:
+		return nil, errors.New("Unknown query field " + field)
+	}
+
+	if node.Cmp == QueryHas && node.Field != QueryInterests && node.Field != QueryLikes {
+		return nil, errors.New("HAS supports only interests and likes")
+	}
+	if node.Cmp != QueryHas && (node.Field == QueryInterests || node.Field == QueryLikes) {
+		return nil, errors.New("Interests and likes support only HAS")
+	}
+	if (node.Cmp == QueryLt || node.Cmp == QueryGt) && node.Field != QueryBirth {
+		return nil, errors.New("Only birth supports < and > operators")
+	}
+
+	return node, nil
+}
+
+func (node *QueryNode) Walk(visit func(*QueryNode)) {
+	visit(node)
+	for _, child := range node.Children {
+		child.Walk(visit)
+	}
+}
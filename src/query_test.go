@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// queryString formats node with ops as functions and predicates as field
+// names with operator, e.g. OR(sex=, AND(city=, NOT(status=))).
+func queryString(node *QueryNode) string {
+	if node.Op == QueryPred {
+		field := map[QueryField]string{
+			QuerySex: "sex", QueryStatus: "status", QueryFname: "fname", QuerySname: "sname",
+			QueryPhoneCode: "phone_code", QueryCountry: "country", QueryCity: "city",
+			QueryBirth: "birth", QueryBirthYear: "birth_year", QueryInterests: "interests",
+			QueryLikes: "likes", QueryPremium: "premium", QueryEmailDomain: "email_domain",
+		}[node.Field]
+		cmp := map[QueryCmp]string{QueryEq: "=", QueryLt: "<", QueryGt: ">", QueryHas: " HAS"}[node.Cmp]
+		if node.Null {
+			return field + cmp + "null"
+		}
+		return field + cmp
+	}
+	children := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = queryString(child)
+	}
+	op := map[QueryOp]string{QueryAnd: "AND", QueryOr: "OR", QueryNot: "NOT"}[node.Op]
+	return op + "(" + strings.Join(children, ", ") + ")"
+}
+
+func TestParseQuery(t *testing.T) {
+	_, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"sex=m", "sex="},
+		{"sex=m AND city=Москва OR status=заняты", "OR(AND(sex=, city=), status=)"},
+		{"sex=m AND (city=Москва OR status=заняты)", "AND(sex=, OR(city=, status=))"},
+		{"a=1 OR", ""},
+		{"NOT NOT sex=f", "NOT(NOT(sex=))"},
+		{"status!=заняты", "NOT(status=)"},
+		{"sex=m and interests has Спорт", "AND(sex=, interests HAS)"},
+		{`status="всё сложно"`, "status="},
+		{"city=null OR fname=null", "OR(city=null, fname=null)"},
+		{"sex=m AND city=Москва AND country=Росмаль", "AND(sex=, city=, country=)"},
+		{"birth<631152000 OR birth>946684800", "OR(birth<, birth>)"},
+		{"premium=now AND likes HAS 1", "AND(premium=, likes HAS)"},
+		{"", ""},
+		{"sex=m AND", ""},
+		{"(sex=m", ""},
+		{"sex=m)", ""},
+		{"sex m", ""},
+		{"sex=x", ""},
+		{"unknown=1", ""},
+		{"city HAS Москва", ""},
+		{"interests=Спорт", ""},
+		{"city<Москва", ""},
+		{"birth=631152000", ""},
+		{"premium=yes", ""},
+		{`fname="Иван`, ""},
+		{"sex!m", ""},
+	}
+
+	for _, test := range tests {
+		node, err := ParseQuery(parser, dicts, test.query)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("ParseQuery(%q) = %s, want error", test.query, queryString(node))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %v", test.query, err)
+			continue
+		}
+		if got := queryString(node); got != test.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  IDS
+	}{
+		{"sex=m", IDS{6, 4, 1}},
+		{"sex=m AND city=Москва OR status=заняты", IDS{6, 3, 1}},
+		{"sex=f AND NOT city=Москва", IDS{5, 3}},
+		{"status!=свободны", IDS{6, 4, 3}},
+		{"interests HAS Спорт AND interests HAS Музыка", IDS{4, 2}},
+		{"interests HAS Unknown OR sex=f", IDS{5, 3, 2}},
+		{"NOT interests HAS Unknown AND sex=f", IDS{5, 3, 2}},
+		{"city=null", IDS{4}},
+		{"fname=null OR sname=null", IDS{6, 5, 3}},
+		{"phone_code=912 OR phone_code=null AND sex=f", IDS{5, 2, 1}},
+		{"birth_year=1990 OR birth>946684800", IDS{6, 1}},
+		{"birth<662688000", IDS{4, 1}},
+		{"premium=now", IDS{1}},
+		{"premium=null AND sex=m", IDS{6}},
+		{"likes HAS 1", IDS{6, 3, 2}},
+		{"likes HAS 1 AND NOT country=Германия", IDS{6, 2}},
+		{"email_domain=gmail.com", IDS{5, 2}},
+		{`status="всё сложно" OR city=Мадрид`, IDS{5, 4}},
+		{"country=Unknown", IDS{}},
+	}
+
+	for _, test := range tests {
+		params := url.Values{
+			"q":     {test.query},
+			"limit": {strconv.Itoa(10)},
+		}
+		if got := filterIDs(t, store, parser, dicts, params); !equalIDS(got, test.want) {
+			t.Errorf("q=%s: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
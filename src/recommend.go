@@ -9,17 +9,39 @@ import (
 )
 
 type RecommendFilter struct {
-	Country Country
-	City    City
+	Country   Country
+	City      City
+	AgeMin    uint16
+	AgeMinSet bool
+	AgeMax    uint16
+	AgeMaxSet bool
 }
 
+type RecommendLocality uint8
+
+const (
+	RecommendLocalityNone RecommendLocality = iota
+	RecommendLocalityCity
+	RecommendLocalityCountry
+	RecommendLocalityAny
+)
+
 type Recommend struct {
 	store *Store
 	dicts *Dicts
 
-	queryID     string
-	expectEmpty bool
-	limit       int
+	queryID      string
+	expectEmpty  bool
+	limit        int
+	scorerName   string
+	weights      string
+	scorer       RecommendScorer
+	excludeLiked bool
+	excludeSet   bool  // exclude_liked is given
+	version      uint8 // api version of client, zero for legacy ones
+	locality     RecommendLocality
+	explain      bool
+	explains     []RecommendExplain // by results, filled by store
 
 	Filter RecommendFilter
 }
@@ -53,8 +75,21 @@ func (recommend *Recommend) Reset() {
 	// recommend.queryID = ""
 	recommend.expectEmpty = false
 	recommend.limit = 0
+	recommend.scorerName = ""
+	recommend.weights = ""
+	recommend.scorer = nil
+	recommend.excludeLiked = false
+	recommend.excludeSet = false
+	recommend.version = 0
+	recommend.locality = RecommendLocalityNone
+	recommend.explain = false
+	recommend.explains = recommend.explains[:0]
 	recommend.Filter.Country = 0
 	recommend.Filter.City = 0
+	recommend.Filter.AgeMin = 0
+	recommend.Filter.AgeMinSet = false
+	recommend.Filter.AgeMax = 0
+	recommend.Filter.AgeMaxSet = false
 }
 
 func (recommend *Recommend) ExpectEmpty() bool {
@@ -65,6 +100,49 @@ func (recommend *Recommend) Limit() int {
 	return recommend.limit
 }
 
+// ExcludeLiked reports whether accounts already liked by requester are
+// not recommended.
+func (recommend *Recommend) ExcludeLiked() bool {
+	return recommend.excludeLiked
+}
+
+// Explain reports whether reasons of results are returned.
+func (recommend *Recommend) Explain() bool {
+	return recommend.explain
+}
+
+func (recommend *Recommend) Explains() []RecommendExplain {
+	return recommend.explains
+}
+
+// LocalityFilters returns filters to fill recommendations with one by one,
+// from own city of account to the whole world when locality is given.
+func (recommend *Recommend) LocalityFilters(account *Account) []RecommendFilter {
+	if recommend.locality == RecommendLocalityNone {
+		return []RecommendFilter{recommend.Filter}
+	}
+	filters := make([]RecommendFilter, 0, 3)
+	if recommend.locality == RecommendLocalityCity && account.City != 0 {
+		filter := recommend.Filter
+		filter.City = account.City
+		filters = append(filters, filter)
+	}
+	if recommend.locality <= RecommendLocalityCountry && account.Country != 0 {
+		filter := recommend.Filter
+		filter.Country = account.Country
+		filters = append(filters, filter)
+	}
+	return append(filters, recommend.Filter)
+}
+
+// Scorer returns scorer chosen by request or store one.
+func (recommend *Recommend) Scorer() RecommendScorer {
+	if recommend.scorer != nil {
+		return recommend.scorer
+	}
+	return recommend.store.RecommendScorer()
+}
+
 func (recommend *Recommend) Parse(query string) error {
 	values, err := url.ParseQuery(query)
 	if err != nil {
@@ -81,12 +159,48 @@ func (recommend *Recommend) Parse(query string) error {
 			return err
 		}
 	}
+	// new clients do not get accounts they already liked unless asked,
+	// legacy ones get them unless store skips them
+	if !recommend.excludeSet {
+		recommend.excludeLiked = recommend.version >= 2 || recommend.store.RecommendExcludeLiked()
+	}
 	if recommend.limit == 0 {
 		return errors.New("Limit should be specified")
 	}
 	if recommend.limit > 20 {
 		return errors.New("Limit should be less or equal 20")
 	}
+	if recommend.Filter.AgeMinSet && recommend.Filter.AgeMaxSet && recommend.Filter.AgeMin > recommend.Filter.AgeMax {
+		return errors.New("Invalid age range")
+	}
+	if recommend.locality != RecommendLocalityNone && (recommend.Filter.City != 0 || recommend.Filter.Country != 0) {
+		return errors.New("Locality cannot be used with city or country")
+	}
+	return recommend.updateScorer()
+}
+
+// updateScorer creates scorer when request chooses it or overrides
+// weights of store ones.
+func (recommend *Recommend) updateScorer() error {
+	if recommend.scorerName == "" && recommend.weights == "" {
+		return nil
+	}
+	weights := recommend.store.RecommendWeights()
+	if recommend.weights != "" {
+		if recommend.scorerName == "default" {
+			return errors.New("Weights are not used by default scorer")
+		}
+		recommend.scorerName = "weighted"
+		err := ParseRecommendWeights(recommend.weights, &weights)
+		if err != nil {
+			return err
+		}
+	}
+	scorer, err := NewRecommendScorer(recommend.scorerName, weights)
+	if err != nil {
+		return err
+	}
+	recommend.scorer = scorer
 	return nil
 }
 
@@ -112,6 +226,60 @@ func (recommend *Recommend) ParseParam(param string, value string) error {
 			return errors.New("Invalid limit value")
 		}
 		recommend.limit = int(ui64)
+	case "age_min":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid age_min value")
+		}
+		recommend.Filter.AgeMin = uint16(ui64)
+		recommend.Filter.AgeMinSet = true
+	case "age_max":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid age_max value")
+		}
+		recommend.Filter.AgeMax = uint16(ui64)
+		recommend.Filter.AgeMaxSet = true
+	case "locality":
+		switch value {
+		case "city":
+			recommend.locality = RecommendLocalityCity
+		case "country":
+			recommend.locality = RecommendLocalityCountry
+		case "any":
+			recommend.locality = RecommendLocalityAny
+		default:
+			return errors.New("Invalid locality value")
+		}
+	case "explain":
+		switch value {
+		case "0":
+			recommend.explain = false
+		case "1":
+			recommend.explain = true
+		default:
+			return errors.New("Invalid explain value")
+		}
+	case "exclude_liked":
+		switch value {
+		case "0":
+			recommend.excludeLiked = false
+		case "1":
+			recommend.excludeLiked = true
+		default:
+			return errors.New("Invalid exclude_liked value")
+		}
+		recommend.excludeSet = true
+	case "v":
+		ui64, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return errors.New("Invalid v value")
+		}
+		recommend.version = uint8(ui64)
+	case "scorer":
+		recommend.scorerName = value
+	case "weights":
+		recommend.weights = value
 	case "query_id":
 		// recommend.queryID = value
 	default:
@@ -121,9 +289,54 @@ func (recommend *Recommend) ParseParam(param string, value string) error {
 	return nil
 }
 
-func Compability(me *Account, somebody *Account) uint64 {
-	compability := uint64(0)
-	commonInts := uint64(0)
+// Seeks reports whether account looks for sex, accounts without seeking
+// look for opposite sex.
+func Seeks(account *Account, sex byte) bool {
+	switch account.Seeking {
+	case 0:
+		return account.Sex != sex
+	case SeekingAny:
+		return true
+	}
+	return account.Seeking == sex
+}
+
+func SeekEachOther(me *Account, somebody *Account) bool {
+	return Seeks(me, somebody.Sex) && Seeks(somebody, me.Sex)
+}
+
+// SeekingSexes returns sexes account looks for.
+func SeekingSexes(account *Account) []byte {
+	sexes := make([]byte, 0, 2)
+	for _, sex := range []byte{SexFemale, SexMale} {
+		if Seeks(account, sex) {
+			sexes = append(sexes, sex)
+		}
+	}
+	return sexes
+}
+
+type RecommendExplain struct {
+	Premium    bool
+	StatusRank int
+	Interests  []Interest // shared ones
+	AgeGap     float64    // in years
+	Score      float64
+}
+
+// StatusRank returns rank of status in Compability, greater goes first.
+func StatusRank(status byte) int {
+	switch status {
+	case StatusSingle:
+		return 3
+	case StatusComplicated:
+		return 2
+	}
+	return 1
+}
+
+func CommonInterests(me *Account, somebody *Account) int {
+	commonInts := 0
 	for _, meInterest := range me.Interests {
 		for _, somebodyInterest := range somebody.Interests {
 			if meInterest == somebodyInterest {
@@ -132,17 +345,17 @@ func Compability(me *Account, somebody *Account) uint64 {
 			}
 		}
 	}
+	return commonInts
+}
+
+func Compability(me *Account, somebody *Account) uint64 {
+	compability := uint64(0)
+	commonInts := uint64(CommonInterests(me, somebody))
 	if commonInts == 0 {
 		return compability
 	}
 
-	if somebody.Status == StatusSingle {
-		compability |= 3 << 40
-	} else if somebody.Status == StatusComplicated {
-		compability |= 2 << 40
-	} else {
-		compability |= 1 << 40
-	}
+	compability |= uint64(StatusRank(somebody.Status)) << 40
 
 	compability |= commonInts << 32
 
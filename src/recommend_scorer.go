@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RecommendScorer scores how well somebody suits me, greater scores go
+// first in recommend.
+type RecommendScorer interface {
+	Score(store *Store, me *Account, somebody *Account) float64
+	// Tiered reports whether candidates are taken premium first and then
+	// by status, so scores are compared only inside these tiers.
+	Tiered() bool
+}
+
+// CompabilityScorer is the default scorer, see Compability.
+type CompabilityScorer struct{}
+
+func (CompabilityScorer) Score(store *Store, me *Account, somebody *Account) float64 {
+	// packed value takes less than 53 bits, so it is exact
+	return float64(Compability(me, somebody))
+}
+
+func (CompabilityScorer) Tiered() bool {
+	return true
+}
+
+type RecommendWeights struct {
+	Premium   float64
+	Status    float64 // per status step, relationship is 0 and single is 2
+	Interests float64 // per common interest
+	AgeGap    float64 // per year of age difference
+	SameCity  float64
+	Likes     float64 // per received like
+}
+
+func DefaultRecommendWeights() RecommendWeights {
+	return RecommendWeights{
+		Premium:   100,
+		Status:    10,
+		Interests: 5,
+		AgeGap:    -0.5,
+		SameCity:  2,
+		Likes:     0.1,
+	}
+}
+
+// ParseRecommendWeights overrides weights from string like
+// "premium=50,age=-1", weights not listed are kept.
+func ParseRecommendWeights(str string, weights *RecommendWeights) error {
+	for _, pair := range strings.Split(str, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("Invalid recommend weight")
+		}
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return errors.New("Invalid recommend weight value")
+		}
+		switch parts[0] {
+		case "premium":
+			weights.Premium = value
+		case "status":
+			weights.Status = value
+		case "interests":
+			weights.Interests = value
+		case "age":
+			weights.AgeGap = value
+		case "city":
+			weights.SameCity = value
+		case "likes":
+			weights.Likes = value
+		default:
+			return errors.New("Unknown recommend weight")
+		}
+	}
+	return nil
+}
+
+// WeightedScorer is a linear model over premium, status, common
+// interests, age gap, same city and received likes.
+type WeightedScorer struct {
+	Weights RecommendWeights
+}
+
+func (scorer *WeightedScorer) Score(store *Store, me *Account, somebody *Account) float64 {
+	weights := &scorer.Weights
+
+	score := weights.Interests * float64(CommonInterests(me, somebody))
+	if store.PremiumNow(somebody) {
+		score += weights.Premium
+	}
+	switch somebody.Status {
+	case StatusSingle:
+		score += 2 * weights.Status
+	case StatusComplicated:
+		score += weights.Status
+	}
+
+	diff := float64(me.Birth - somebody.Birth)
+	if diff < 0 {
+		diff = -diff
+	}
+	score += weights.AgeGap * diff / secondsInYear
+
+	if me.City != 0 && me.City == somebody.City {
+		score += weights.SameCity
+	}
+	score += weights.Likes * float64(store.index.Likee.Count(somebody.ID))
+
+	return score
+}
+
+func (scorer *WeightedScorer) Tiered() bool {
+	return false
+}
+
+// NewRecommendScorer returns scorer by name, weights are used by
+// weighted scorer only.
+func NewRecommendScorer(name string, weights RecommendWeights) (RecommendScorer, error) {
+	switch name {
+	case "default":
+		return CompabilityScorer{}, nil
+	case "weighted":
+		return &WeightedScorer{Weights: weights}, nil
+	}
+	return nil, errors.New("Unknown recommend scorer")
+}
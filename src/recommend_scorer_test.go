@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseRecommendWeights(t *testing.T) {
+	defaults := DefaultRecommendWeights()
+
+	tests := []struct {
+		str  string
+		want RecommendWeights
+		err  bool
+	}{
+		{"premium=50", RecommendWeights{50, 10, 5, -0.5, 2, 0.1}, false},
+		{"age=-1,likes=0", RecommendWeights{100, 10, 5, -1, 2, 0}, false},
+		{"status=1,interests=2,city=3,premium=0.5", RecommendWeights{0.5, 1, 2, -0.5, 3, 0.1}, false},
+		{"status=1,status=2", RecommendWeights{100, 2, 5, -0.5, 2, 0.1}, false},
+		{"", defaults, true},
+		{"premium", defaults, true},
+		{"premium=", defaults, true},
+		{"premium=x", defaults, true},
+		{"premium=1,", defaults, true},
+		{"beauty=1", defaults, true},
+	}
+
+	for _, test := range tests {
+		weights := DefaultRecommendWeights()
+		err := ParseRecommendWeights(test.str, &weights)
+		if test.err != (err != nil) {
+			t.Errorf("ParseRecommendWeights(%q) error %v", test.str, err)
+			continue
+		}
+		if err == nil && weights != test.want {
+			t.Errorf("ParseRecommendWeights(%q) = %+v, want %+v", test.str, weights, test.want)
+		}
+	}
+}
+
+func TestNewRecommendScorer(t *testing.T) {
+	tests := []struct {
+		name   string
+		tiered bool
+		err    bool
+	}{
+		{"default", true, false},
+		{"weighted", false, false},
+		{"", false, true},
+		{"random", false, true},
+	}
+
+	for _, test := range tests {
+		scorer, err := NewRecommendScorer(test.name, DefaultRecommendWeights())
+		if test.err != (err != nil) {
+			t.Errorf("NewRecommendScorer(%q) error %v", test.name, err)
+			continue
+		}
+		if err == nil && scorer.Tiered() != test.tiered {
+			t.Errorf("NewRecommendScorer(%q) tiered %v, want %v", test.name, scorer.Tiered(), test.tiered)
+		}
+	}
+}
+
+func TestCompability(t *testing.T) {
+	me := &Account{Birth: 631152000, Interests: []Interest{1, 2, 3}}
+
+	tests := []struct {
+		better *Account
+		worse  *Account
+	}{
+		// status goes first
+		{&Account{Status: StatusSingle, Birth: 0, Interests: []Interest{1}}, &Account{Status: StatusComplicated, Birth: 631152000, Interests: []Interest{1, 2, 3}}},
+		{&Account{Status: StatusComplicated, Interests: []Interest{1}}, &Account{Status: StatusRelationship, Interests: []Interest{1, 2}}},
+		// then common interests
+		{&Account{Status: StatusSingle, Interests: []Interest{4, 2, 1}}, &Account{Status: StatusSingle, Birth: 631152000, Interests: []Interest{3}}},
+		// then age gap
+		{&Account{Status: StatusSingle, Birth: 631152000 - 100, Interests: []Interest{1}}, &Account{Status: StatusSingle, Birth: 631152000 + 200, Interests: []Interest{2}}},
+		// account without common interests is never better
+		{&Account{Status: StatusRelationship, Interests: []Interest{3}}, &Account{Status: StatusSingle, Birth: 631152000, Interests: []Interest{4}}},
+	}
+
+	for i, test := range tests {
+		better, worse := Compability(me, test.better), Compability(me, test.worse)
+		if better <= worse {
+			t.Errorf("test %d: compability %x is not greater than %x", i, better, worse)
+		}
+	}
+	if got := Compability(me, &Account{Status: StatusSingle, Interests: []Interest{4}}); got != 0 {
+		t.Errorf("compability without common interests %x, want 0", got)
+	}
+}
+
+func TestWeightedScorer(t *testing.T) {
+	store, _, _ := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		weights  RecommendWeights
+		me       ID
+		somebody ID
+		want     float64
+	}{
+		{RecommendWeights{Interests: 1}, 1, 2, 1},
+		{RecommendWeights{Interests: 1}, 4, 2, 2},
+		{RecommendWeights{Status: 1}, 1, 2, 2},
+		{RecommendWeights{Status: 1}, 2, 4, 1},
+		{RecommendWeights{Status: 1}, 2, 6, 0},
+		{RecommendWeights{SameCity: 1}, 1, 2, 1},
+		{RecommendWeights{SameCity: 1}, 1, 3, 0},
+		// account 4 has no city
+		{RecommendWeights{SameCity: 1}, 4, 4, 0},
+		{RecommendWeights{Likes: 1}, 1, 2, 2},
+		{RecommendWeights{Likes: 1}, 1, 1, 3},
+		{RecommendWeights{Premium: 1}, 2, 1, 1},
+		// premium of account 4 is expired
+		{RecommendWeights{Premium: 1}, 2, 4, 0},
+		{RecommendWeights{AgeGap: 1}, 1, 2, 31536000 / secondsInYear},
+		{RecommendWeights{AgeGap: 1}, 2, 1, 31536000 / secondsInYear},
+		{DefaultRecommendWeights(), 1, 2, 5 + 20 - 0.5*31536000/secondsInYear + 2 + 0.2},
+	}
+
+	for _, test := range tests {
+		scorer := &WeightedScorer{Weights: test.weights}
+		got := scorer.Score(store, store.Get(test.me), store.Get(test.somebody))
+		if got != test.want {
+			t.Errorf("%+v: score of %d for %d = %v, want %v", test.weights, test.somebody, test.me, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSeeks(t *testing.T) {
+	tests := []struct {
+		sex     byte
+		seeking byte
+		sexes   string
+	}{
+		{SexMale, 0, "f"},
+		{SexFemale, 0, "m"},
+		{SexMale, SexMale, "m"},
+		{SexFemale, SexFemale, "f"},
+		{SexFemale, SexMale, "m"},
+		{SexMale, SeekingAny, "fm"},
+	}
+
+	for _, test := range tests {
+		account := &Account{Sex: test.sex, Seeking: test.seeking}
+		if got := string(SeekingSexes(account)); got != test.sexes {
+			t.Errorf("SeekingSexes(%c seeking %q) = %s, want %s", test.sex, test.seeking, got, test.sexes)
+		}
+		for _, sex := range []byte{SexFemale, SexMale} {
+			want := test.sexes[0] == sex || test.sexes[len(test.sexes)-1] == sex
+			if got := Seeks(account, sex); got != want {
+				t.Errorf("Seeks(%c seeking %q, %c) = %v, want %v", test.sex, test.seeking, sex, got, want)
+			}
+		}
+	}
+}
+
+func TestSeekEachOther(t *testing.T) {
+	tests := []struct {
+		me       Account
+		somebody Account
+		want     bool
+	}{
+		{Account{Sex: SexMale}, Account{Sex: SexFemale}, true},
+		{Account{Sex: SexMale}, Account{Sex: SexMale}, false},
+		{Account{Sex: SexMale, Seeking: SexMale}, Account{Sex: SexMale}, false},
+		{Account{Sex: SexMale, Seeking: SexMale}, Account{Sex: SexMale, Seeking: SeekingAny}, true},
+		{Account{Sex: SexFemale, Seeking: SexFemale}, Account{Sex: SexFemale, Seeking: SexFemale}, true},
+		{Account{Sex: SexFemale, Seeking: SeekingAny}, Account{Sex: SexMale}, true},
+		{Account{Sex: SexFemale, Seeking: SexMale}, Account{Sex: SexMale, Seeking: SexMale}, false},
+	}
+
+	for _, test := range tests {
+		if got := SeekEachOther(&test.me, &test.somebody); got != test.want {
+			t.Errorf("SeekEachOther(%+v, %+v) = %v, want %v", test.me, test.somebody, got, test.want)
+		}
+		if got := SeekEachOther(&test.somebody, &test.me); got != test.want {
+			t.Errorf("SeekEachOther(%+v, %+v) = %v, want %v", test.somebody, test.me, got, test.want)
+		}
+	}
+}
+
+func TestParseSeeking(t *testing.T) {
+	parser := NewParser(NewDicts())
+
+	tests := []struct {
+		value string
+		want  byte
+		err   bool
+	}{
+		{"m", SexMale, false},
+		{"f", SexFemale, false},
+		{"any", SeekingAny, false},
+		{"", 0, true},
+		{"a", 0, true},
+		{"mf", 0, true},
+		{"Any", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parser.ParseSeeking(test.value)
+		if test.err != (err != nil) {
+			t.Errorf("ParseSeeking(%q) error %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseSeeking(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
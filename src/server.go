@@ -58,8 +58,14 @@ func (buffer *AccountsBuffer) Release() {
 // ----
 
 type GroupsBuffer struct {
-	orderAsc bool
-	groups   []*GroupEntry
+	orderAsc    bool
+	keysMask    GroupHash
+	agg         GroupAgg
+	now         uint32
+	next        int // offset of the next page for paged requests, zero if there is no one
+	groups      []*GroupEntry
+	stats       []*GroupStats // by groups, only with agg
+	aggregation *Aggregation  // scanned aggregation groups point to
 }
 
 var groupsBufferPool = sync.Pool{
@@ -78,15 +84,160 @@ func BorrowGroupsBuffer() *GroupsBuffer {
 
 func (buffer *GroupsBuffer) Reset() {
 	buffer.orderAsc = false
+	buffer.keysMask = 0
+	buffer.agg = 0
+	buffer.now = 0
+	buffer.next = 0
 	buffer.groups = buffer.groups[:0]
+	buffer.stats = buffer.stats[:0]
+	buffer.aggregation = nil
 }
 
 func (buffer *GroupsBuffer) Release() {
+	if buffer.aggregation != nil {
+		buffer.aggregation.Release()
+		buffer.aggregation = nil
+	}
 	groupsBufferPool.Put(buffer)
 }
 
 // ----
 
+type PivotBuffer struct {
+	rowKey GroupKey
+	colKey GroupKey
+	rows   []GroupEntry // header values with totals
+	cols   []GroupEntry
+	cells  []uint32 // rows by cols
+	total  uint32
+}
+
+var pivotBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &PivotBuffer{}
+	},
+}
+
+func BorrowPivotBuffer() *PivotBuffer {
+	pb := pivotBufferPool.Get().(*PivotBuffer)
+	pb.Reset()
+	return pb
+}
+
+func (buffer *PivotBuffer) Reset() {
+	buffer.rowKey = 0
+	buffer.colKey = 0
+	buffer.rows = buffer.rows[:0]
+	buffer.cols = buffer.cols[:0]
+	buffer.cells = buffer.cells[:0]
+	buffer.total = 0
+}
+
+func (buffer *PivotBuffer) Release() {
+	pivotBufferPool.Put(buffer)
+}
+
+func (buffer *PivotBuffer) Cell(row, col int) uint32 {
+	return buffer.cells[row*len(buffer.cols)+col]
+}
+
+// ----
+
+type InterestPair struct {
+	Interest Interest
+	Count    uint32
+	Lift     float64
+	Jaccard  float64
+}
+
+type InterestCooccurrence struct {
+	Interest Interest
+	Count    uint32
+	Pairs    []InterestPair
+}
+
+type CooccurrenceBuffer struct {
+	total     uint32 // accounts matched by filter
+	interests []InterestCooccurrence
+}
+
+var cooccurrenceBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &CooccurrenceBuffer{}
+	},
+}
+
+func BorrowCooccurrenceBuffer() *CooccurrenceBuffer {
+	cb := cooccurrenceBufferPool.Get().(*CooccurrenceBuffer)
+	cb.Reset()
+	return cb
+}
+
+func (buffer *CooccurrenceBuffer) Reset() {
+	buffer.total = 0
+	buffer.interests = buffer.interests[:0]
+}
+
+func (buffer *CooccurrenceBuffer) Release() {
+	cooccurrenceBufferPool.Put(buffer)
+}
+
+// ----
+
+type MatchesBuffer struct {
+	matches []Match // page of matches
+	next    bool    // whether there are matches after page
+}
+
+var matchesBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &MatchesBuffer{}
+	},
+}
+
+func BorrowMatchesBuffer() *MatchesBuffer {
+	mb := matchesBufferPool.Get().(*MatchesBuffer)
+	mb.Reset()
+	return mb
+}
+
+func (buffer *MatchesBuffer) Reset() {
+	buffer.matches = buffer.matches[:0]
+	buffer.next = false
+}
+
+func (buffer *MatchesBuffer) Release() {
+	matchesBufferPool.Put(buffer)
+}
+
+// ----
+
+type LikersBuffer struct {
+	likers []Liker
+}
+
+var likersBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &LikersBuffer{}
+	},
+}
+
+func BorrowLikersBuffer() *LikersBuffer {
+	lb := likersBufferPool.Get().(*LikersBuffer)
+	lb.Reset()
+	return lb
+}
+
+func (buffer *LikersBuffer) Reset() {
+	buffer.likers = buffer.likers[:0]
+}
+
+func (buffer *LikersBuffer) Release() {
+	likersBufferPool.Put(buffer)
+}
+
+// ----
+
 type OutputBuffer struct {
 	bytes.Buffer
 	buf []byte
@@ -142,6 +293,9 @@ func (server *Server) Handle() error {
 	updateRegex := regexp.MustCompile("^/accounts/([0-9]+)/$")
 	recommendRegexp := regexp.MustCompile("^/accounts/([0-9]+)/recommend/$")
 	suggestRegexp := regexp.MustCompile("^/accounts/([0-9]+)/suggest/$")
+	blockRegexp := regexp.MustCompile("^/accounts/([0-9]+)/block/$")
+	matchesRegexp := regexp.MustCompile("^/accounts/([0-9]+)/matches/$")
+	likersRegexp := regexp.MustCompile("^/accounts/([0-9]+)/likers/$")
 
 	handler := func(ctx *fasthttp.RequestCtx) {
 		path := string(ctx.Path())
@@ -153,45 +307,75 @@ func (server *Server) Handle() error {
 
 		switch path {
 		case "/accounts/filter/":
-			server.handleFilterRequest(ctx)
+			server.handleFilterRequest(ctx, false)
+		case "/accounts/filter/count/":
+			server.handleFilterRequest(ctx, true)
 		case "/accounts/group/":
 			server.handleGroupRequest(ctx)
+		case "/accounts/pivot/":
+			server.handlePivotRequest(ctx)
+		case "/accounts/interests/cooccurrence/":
+			server.handleCooccurrenceRequest(ctx)
 		case "/accounts/new/":
 			server.handleNewRequest(ctx)
 		case "/accounts/likes/":
 			server.handleLikesRequest(ctx)
+		case "/admin/groups/":
+			server.handleAdminGroupsRequest(ctx)
+		case "/admin/groups/add/":
+			server.handleAdminGroupsChangeRequest(ctx, true)
+		case "/admin/groups/drop/":
+			server.handleAdminGroupsChangeRequest(ctx, false)
+		case "/admin/matches/count", "/admin/matches/count/":
+			server.handleAdminMatchesCountRequest(ctx)
 		default:
-			updateMatches := updateRegex.FindStringSubmatch(path)
-			if len(updateMatches) > 0 {
-				server.handleUpdateRequest(ctx, updateMatches)
+			if matches := updateRegex.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleUpdateRequest(ctx, matches)
+			} else if matches := recommendRegexp.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleRecommendRequest(ctx, matches)
+			} else if matches := suggestRegexp.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleSuggestRequest(ctx, matches)
+			} else if matches := blockRegexp.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleBlockRequest(ctx, matches)
+			} else if matches := matchesRegexp.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleMatchesRequest(ctx, matches)
+			} else if matches := likersRegexp.FindStringSubmatch(path); len(matches) > 0 {
+				server.handleLikersRequest(ctx, matches)
 			} else {
-				recommendMatches := recommendRegexp.FindStringSubmatch(path)
-				if len(recommendMatches) > 0 {
-					server.handleRecommendRequest(ctx, recommendMatches)
-				} else {
-					suggestMatches := suggestRegexp.FindStringSubmatch(path)
-					if len(suggestMatches) > 0 {
-						server.handleSuggestRequest(ctx, suggestMatches)
-					} else {
-						ctx.NotFound()
-					}
-				}
+				ctx.NotFound()
 			}
 		}
 	}
 	return fasthttp.ListenAndServe(server.options.Addr, handler)
 }
 
-func (srv *Server) handleFilterRequest(ctx *fasthttp.RequestCtx) {
+func (srv *Server) handleFilterRequest(ctx *fasthttp.RequestCtx, count bool) {
 	filter := BorrowFilter(srv.parser, srv.dicts)
 	defer filter.Release()
 
+	filter.count = count
 	err := filter.Parse(string(ctx.URI().QueryString()))
 	if err != nil {
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		return
 	}
 
+	if filter.Count() {
+		buffer := BorrowBuffer()
+		defer buffer.Release()
+
+		count := srv.store.FilterCount(filter)
+		if filter.Explain() {
+			srv.parser.EncodeCountPlan(count, buffer, filter.Plan())
+		} else {
+			srv.parser.EncodeCount(count, buffer)
+		}
+
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyStream(buffer, buffer.Len())
+		return
+	}
+
 	accounts := BorrowAccountsBuffer()
 	defer accounts.Release()
 
@@ -200,7 +384,11 @@ func (srv *Server) handleFilterRequest(ctx *fasthttp.RequestCtx) {
 	buffer := BorrowBuffer()
 	defer buffer.Release()
 
-	srv.parser.EncodeAccounts(*accounts, buffer, filter)
+	if filter.Explain() {
+		srv.parser.EncodeAccountsPlan(*accounts, buffer, filter, filter.Plan())
+	} else {
+		srv.parser.EncodeAccounts(*accounts, buffer, filter)
+	}
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.SetBodyStream(buffer, buffer.Len())
@@ -313,6 +501,224 @@ func (srv *Server) handleGroupRequest(ctx *fasthttp.RequestCtx) {
 	ctx.SetBodyStream(buffer, buffer.Len())
 }
 
+func (srv *Server) handleBlockRequest(ctx *fasthttp.RequestCtx, matches []string) {
+	if !ctx.IsPost() {
+		ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+		return
+	}
+
+	ui64, err := strconv.ParseUint(matches[1], 10, 32)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	account := srv.store.Get(ID(ui64))
+	if account == nil {
+		ctx.NotFound()
+		return
+	}
+
+	ids := BorrowIDS()
+	defer ids.Release()
+
+	err = srv.parser.DecodeBlocks(ctx.PostBody(), ids)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	err = srv.store.Block(account.ID, *ids)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+	ctx.Write(defaultPostResponse)
+}
+
+func (srv *Server) handleMatchesRequest(ctx *fasthttp.RequestCtx, matches []string) {
+	ui64, err := strconv.ParseUint(matches[1], 10, 32)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	account := srv.store.Get(ID(ui64))
+	if account == nil {
+		ctx.NotFound()
+		return
+	}
+
+	query := BorrowMatches()
+	defer query.Release()
+
+	err = query.Parse(string(ctx.URI().QueryString()))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	matchesBuffer := BorrowMatchesBuffer()
+	defer matchesBuffer.Release()
+
+	srv.store.Matches(account, query, matchesBuffer)
+
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodeMatches(matchesBuffer, buffer, query)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+func (srv *Server) handleLikersRequest(ctx *fasthttp.RequestCtx, matches []string) {
+	ui64, err := strconv.ParseUint(matches[1], 10, 32)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	account := srv.store.Get(ID(ui64))
+	if account == nil {
+		ctx.NotFound()
+		return
+	}
+
+	likers := BorrowLikers()
+	defer likers.Release()
+
+	err = likers.Parse(string(ctx.URI().QueryString()))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	likersBuffer := BorrowLikersBuffer()
+	defer likersBuffer.Release()
+
+	srv.store.Likers(account, likers, likersBuffer)
+
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodeLikers(likersBuffer, buffer, likers)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+func (srv *Server) handleAdminMatchesCountRequest(ctx *fasthttp.RequestCtx) {
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodeMatchesStats(srv.store.MatchesStats(), buffer)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+func (srv *Server) handlePivotRequest(ctx *fasthttp.RequestCtx) {
+	pivot := BorrowPivot(srv.parser, srv.dicts)
+	defer pivot.Release()
+
+	err := pivot.Parse(string(ctx.URI().QueryString()))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	pivotBuffer := BorrowPivotBuffer()
+	defer pivotBuffer.Release()
+
+	srv.store.Pivot(pivot, pivotBuffer)
+
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodePivot(pivotBuffer, buffer)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+func (srv *Server) handleCooccurrenceRequest(ctx *fasthttp.RequestCtx) {
+	cooccurrence := BorrowCooccurrence(srv.parser, srv.dicts)
+	defer cooccurrence.Release()
+
+	err := cooccurrence.Parse(string(ctx.URI().QueryString()))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	cooccurrenceBuffer := BorrowCooccurrenceBuffer()
+	defer cooccurrenceBuffer.Release()
+
+	srv.store.Cooccurrence(cooccurrence, cooccurrenceBuffer)
+
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodeCooccurrence(cooccurrenceBuffer, buffer)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+func (srv *Server) handleAdminGroupsRequest(ctx *fasthttp.RequestCtx) {
+	buffer := BorrowBuffer()
+	defer buffer.Release()
+
+	srv.parser.EncodeGroupCombos(srv.store.GroupCombos(), buffer)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStream(buffer, buffer.Len())
+}
+
+// handleAdminGroupsChangeRequest adds or drops combination given by filter
+// and keys params, drop with unused=1 drops all never queried ones.
+func (srv *Server) handleAdminGroupsChangeRequest(ctx *fasthttp.RequestCtx, add bool) {
+	if !ctx.IsPost() {
+		ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	args := ctx.QueryArgs()
+
+	if !add && string(args.Peek("unused")) == "1" {
+		srv.store.DropUnusedGroupCombos()
+		ctx.SetStatusCode(fasthttp.StatusAccepted)
+		ctx.Write(defaultPostResponse)
+		return
+	}
+
+	filter, err := ParseGroupMask(string(args.Peek("filter")))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+	group, err := ParseGroupMask(string(args.Peek("keys")))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	if add {
+		err = srv.store.AddGroupCombo(filter, group)
+	} else {
+		err = srv.store.DropGroupCombo(filter, group)
+	}
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+	ctx.Write(defaultPostResponse)
+}
+
 func (srv *Server) handleSuggestRequest(ctx *fasthttp.RequestCtx, matches []string) {
 	ui64, err := strconv.ParseUint(matches[1], 10, 32)
 	if err != nil {
@@ -343,7 +749,11 @@ func (srv *Server) handleSuggestRequest(ctx *fasthttp.RequestCtx, matches []stri
 	buffer := BorrowBuffer()
 	defer buffer.Release()
 
-	srv.parser.EncodeAccounts(*accounts, buffer, suggest)
+	if suggest.Explain() {
+		srv.parser.EncodeSuggestExplained(*accounts, buffer, suggest)
+	} else {
+		srv.parser.EncodeAccounts(*accounts, buffer, suggest)
+	}
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.SetBodyStream(buffer, buffer.Len())
@@ -379,7 +789,11 @@ func (srv *Server) handleRecommendRequest(ctx *fasthttp.RequestCtx, matches []st
 	buffer := BorrowBuffer()
 	defer buffer.Release()
 
-	srv.parser.EncodeAccounts(*accounts, buffer, recommend)
+	if recommend.Explain() {
+		srv.parser.EncodeRecommendExplained(*accounts, buffer, recommend)
+	} else {
+		srv.parser.EncodeAccounts(*accounts, buffer, recommend)
+	}
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
 	ctx.SetBodyStream(buffer, buffer.Len())
@@ -19,8 +19,15 @@ type Store struct {
 	accountsMap map[ID]*Account
 	accountsArr []Account
 	emails      map[string]ID
+	phones      map[string]ID
+	uniquePhone bool
 	rwLock      sync.RWMutex
+	writeLock   sync.RWMutex // held by writers until index jobs are added
 	index       *Index
+
+	recommendScorer       RecommendScorer
+	recommendWeights      RecommendWeights
+	recommendExcludeLiked bool
 }
 
 func NewStore(dicts *Dicts, now uint32, rating bool) *Store {
@@ -31,12 +38,19 @@ func NewStore(dicts *Dicts, now uint32, rating bool) *Store {
 		accountsMap: make(map[ID]*Account),
 		accountsArr: make([]Account, storePreallocCount),
 		emails:      make(map[string]ID),
+		phones:      make(map[string]ID),
+
+		recommendScorer:  CompabilityScorer{},
+		recommendWeights: DefaultRecommendWeights(),
 	}
 	store.index = NewIndex(store, dicts)
 	return store
 }
 
 func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool) (*Account, error) {
+	store.writeLock.RLock()
+	defer store.writeLock.RUnlock()
+
 	if check {
 		if rawAccount.Email == "" {
 			return nil, errors.New("Email field should be specified")
@@ -72,6 +86,12 @@ func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool)
 			store.rwLock.Unlock()
 			return nil, errors.New("Same email already taken")
 		}
+		if store.uniquePhone && rawAccount.Phone != nil {
+			if _, ok := store.phones[*rawAccount.Phone]; ok {
+				store.rwLock.Unlock()
+				return nil, errors.New("Same phone already taken")
+			}
+		}
 		if store.get(ID(rawAccount.ID)) != nil {
 			store.rwLock.Unlock()
 			return nil, errors.New("Account with same ID already exists")
@@ -88,6 +108,7 @@ func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool)
 		account.Premium = rawAccount.Premium
 		account.Email = rawAccount.Email
 		account.EmailDomain = rawAccount.EmailDomain
+		account.Seeking = rawAccount.Seeking
 	} else {
 		store.accountsMap[ID(rawAccount.ID)] = &Account{
 			ID:          ID(rawAccount.ID),
@@ -98,10 +119,14 @@ func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool)
 			Premium:     rawAccount.Premium,
 			Email:       rawAccount.Email,
 			EmailDomain: rawAccount.EmailDomain,
+			Seeking:     rawAccount.Seeking,
 		}
 		account = store.accountsMap[ID(rawAccount.ID)]
 	}
 	store.emails[account.Email] = account.ID
+	if rawAccount.Phone != nil {
+		store.phones[*rawAccount.Phone] = account.ID
+	}
 	store.rwLock.Unlock()
 
 	if rawAccount.Phone != nil {
@@ -138,7 +163,7 @@ func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool)
 		batch := &IndexBatch{index: store.index}
 		batch.Add(account)
 		batch.AddInterests(account.ID, account.Status, account.Sex, account.City, account.Country, store.PremiumNow(account), account.Interests...)
-		batch.AddGroupHash(CreateHashFromAccount(account), account.Interests...)
+		batch.AddGroupHash(CreateHashFromAccount(account), CreateStatsFromAccount(account, store.PremiumNow(account)), account.Interests...)
 		for _, like := range rawAccount.Likes {
 			batch.AddLike(account.ID, ID(like.ID), like.Ts)
 		}
@@ -155,6 +180,9 @@ func (store *Store) Add(rawAccount *RawAccount, check bool, updateIndexes bool)
 }
 
 func (store *Store) AddLikes(likes *Likes, updateIndexes bool) error {
+	store.writeLock.RLock()
+	defer store.writeLock.RUnlock()
+
 	store.rwLock.RLock()
 	for _, like := range likes.likes {
 		if store.get(ID(like.Likee)) == nil {
@@ -178,24 +206,65 @@ func (store *Store) AddLikes(likes *Likes, updateIndexes bool) error {
 	return nil
 }
 
+// Block hides blocked accounts and blocker from each other in recommend
+// and suggest.
+func (store *Store) Block(blocker ID, blocked IDS) error {
+	store.rwLock.RLock()
+	for _, id := range blocked {
+		if id == blocker {
+			store.rwLock.RUnlock()
+			return errors.New("Cannot block itself")
+		}
+		if store.get(id) == nil {
+			store.rwLock.RUnlock()
+			return errors.New("Cannot find blocked account")
+		}
+	}
+	store.rwLock.RUnlock()
+
+	for _, id := range blocked {
+		store.index.Block.Add(blocker, id)
+	}
+	return nil
+}
+
 func (store *Store) Update(id ID, rawAccount *RawAccount, updateIndexes bool) (*Account, error) {
+	store.writeLock.RLock()
+	defer store.writeLock.RUnlock()
+
 	if rawAccount.Email != "" && rawAccount.EmailDomain == 0 {
 		return nil, errors.New("Invalid email")
 	}
-	store.rwLock.RLock()
+	// phone is checked and taken under the same lock, so concurrent
+	// updates can not take the same phone
+	store.rwLock.Lock()
 	emailID, ok := store.emails[rawAccount.Email]
 	if ok && emailID != id {
-		store.rwLock.RUnlock()
+		store.rwLock.Unlock()
 		return nil, errors.New("Same email already taken")
 	}
+	if store.uniquePhone && rawAccount.Phone != nil {
+		phoneID, ok := store.phones[*rawAccount.Phone]
+		if ok && phoneID != id {
+			store.rwLock.Unlock()
+			return nil, errors.New("Same phone already taken")
+		}
+	}
 	account := store.get(id)
 	if account == nil {
-		store.rwLock.RUnlock()
+		store.rwLock.Unlock()
 		return nil, errors.New("Unknwon account for update")
 	}
-	store.rwLock.RUnlock()
+	if rawAccount.Phone != nil && (account.Phone == nil || *account.Phone != *rawAccount.Phone) {
+		if account.Phone != nil && store.phones[*account.Phone] == account.ID {
+			delete(store.phones, *account.Phone)
+		}
+		store.phones[*rawAccount.Phone] = account.ID
+	}
+	store.rwLock.Unlock()
 
 	oldHash := CreateHashFromAccount(account)
+	oldStats := CreateStatsFromAccount(account, store.PremiumNow(account))
 	oldInts := make([]Interest, len(account.Interests))
 	for i, interest := range account.Interests {
 		oldInts[i] = interest
@@ -247,6 +316,9 @@ func (store *Store) Update(id ID, rawAccount *RawAccount, updateIndexes bool) (*
 		// batch.Sex.Remove(oldSex, account.ID)
 		// batch.Sex.Add(account.Sex, account.ID)
 	}
+	if rawAccount.Seeking != 0 {
+		account.Seeking = rawAccount.Seeking
+	}
 	if rawAccount.Status != 0 {
 		oldStatus := account.Status
 		account.Status = rawAccount.Status
@@ -283,7 +355,7 @@ func (store *Store) Update(id ID, rawAccount *RawAccount, updateIndexes bool) (*
 		}
 	}
 	if rawAccount.Birth != 0 && account.Birth != rawAccount.Birth {
-		oldBirth := rawAccount.Birth
+		oldBirth := account.Birth
 		account.Birth = rawAccount.Birth
 		// batch.BirthYear.Remove(timestampToYear(oldBirth), ID(account.ID))
 		// newYear := timestampToYear(rawAccount.Birth)
@@ -300,6 +372,11 @@ func (store *Store) Update(id ID, rawAccount *RawAccount, updateIndexes bool) (*
 		store.rwLock.Unlock()
 	}
 	if rawAccount.Phone != nil && (account.Phone == nil || *account.Phone != *rawAccount.Phone) {
+		if account.Phone != nil {
+			batch.ReplacePhone(account.ID, *account.Phone, *rawAccount.Phone)
+		} else {
+			batch.AddPhone(account.ID, *rawAccount.Phone)
+		}
 		account.Phone = rawAccount.Phone
 		oldPhoneCode := account.PhoneCode
 		// if account.PhoneCode != 0 {
@@ -426,8 +503,13 @@ func (store *Store) Update(id ID, rawAccount *RawAccount, updateIndexes bool) (*
 		}
 	}
 
-	batch.SubGroupHash(oldHash, oldInts...)
-	batch.AddGroupHash(CreateHashFromAccount(account), account.Interests...)
+	// interests are reused by next update, so jobs get own copy
+	newHash := CreateHashFromAccount(account)
+	newInts := make([]Interest, len(account.Interests))
+	copy(newInts, account.Interests)
+	batch.SubGroupHash(oldHash, oldStats, oldInts...)
+	batch.AddGroupHash(newHash, CreateStatsFromAccount(account, store.PremiumNow(account)), newInts...)
+	batch.ReplaceLikesGroupHash(account.ID, oldHash, newHash, oldInts, newInts)
 
 	store.index.worker.Add(batch.Dispatch())
 
@@ -460,6 +542,67 @@ func (store *Store) Count() int {
 	return int(store.count)
 }
 
+// SetUniquePhone enables rejecting new and updated accounts with phone
+// already taken by other account.
+func (store *Store) SetUniquePhone(uniquePhone bool) {
+	store.uniquePhone = uniquePhone
+}
+
+// SetGroupStats enables maintaining sums for group aggregates in
+// precomputed group indexes, should be called before indexes are built.
+func (store *Store) SetGroupStats(stats bool) {
+	store.index.Group.SetStats(stats)
+}
+
+// SetGroupCombos sets precomputed group combinations, should be called
+// before indexes are built.
+func (store *Store) SetGroupCombos(filterGroups map[GroupHash][]GroupHash) {
+	store.index.Group.SetCombos(filterGroups)
+}
+
+// SetGroupLikes sets group keys of aggregations kept per likee,
+// should be called before indexes are built.
+func (store *Store) SetGroupLikes(groups []GroupHash) {
+	store.index.GroupLikes.SetGroups(groups)
+}
+
+// SetRecommendScorer sets scorer used by recommend requests which do not
+// choose one.
+func (store *Store) SetRecommendScorer(scorer RecommendScorer) {
+	store.recommendScorer = scorer
+}
+
+func (store *Store) RecommendScorer() RecommendScorer {
+	return store.recommendScorer
+}
+
+// SetRecommendWeights sets weights used by weighted scorer chosen by
+// recommend request.
+func (store *Store) SetRecommendWeights(weights RecommendWeights) {
+	store.recommendWeights = weights
+}
+
+func (store *Store) RecommendWeights() RecommendWeights {
+	return store.recommendWeights
+}
+
+// SetRecommendExcludeLiked sets whether recommend skips accounts already
+// liked by requester when request of legacy client does not tell.
+func (store *Store) SetRecommendExcludeLiked(excludeLiked bool) {
+	store.recommendExcludeLiked = excludeLiked
+}
+
+func (store *Store) RecommendExcludeLiked() bool {
+	return store.recommendExcludeLiked
+}
+
+func (store *Store) FindPhone(phone string) (ID, bool) {
+	store.rwLock.RLock()
+	id, ok := store.phones[phone]
+	store.rwLock.RUnlock()
+	return id, ok
+}
+
 func (store *Store) get(id ID) *Account {
 	if id < storePreallocCount {
 		if store.accountsArr[id].ID == id {
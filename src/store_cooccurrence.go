@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+)
+
+func (store *Store) Cooccurrence(cooccurrence *Cooccurrence, buffer *CooccurrenceBuffer) {
+	if cooccurrence.ExpectEmpty() {
+		return
+	}
+
+	interestsCount := store.dicts.CountInterests()
+	counts := make([]uint32, interestsCount+1)
+	pairs := make([]uint32, (interestsCount+1)*(interestsCount+1))
+
+	interest := cooccurrence.Filter.Interest
+	if interest != 0 {
+		// one row only, so intersect posting lists instead of scanning
+		buffer.total = countIterator(store.cooccurrenceIter(cooccurrence))
+		for other := Interest(1); int(other) <= interestsCount; other++ {
+			counts[other] = countIterator(store.cooccurrenceIter(cooccurrence, store.index.Interest.Iter(other)))
+			if other == interest || counts[other] == 0 {
+				continue
+			}
+			pairs[int(interest)*(interestsCount+1)+int(other)] = countIterator(store.cooccurrenceIter(
+				cooccurrence,
+				store.index.Interest.Iter(interest),
+				store.index.Interest.Iter(other),
+			))
+		}
+		store.appendCooccurrence(cooccurrence, buffer, interest, counts, pairs)
+		return
+	}
+
+	it := store.cooccurrenceIter(cooccurrence)
+	for it.Cur() != 0 {
+		account := store.get(it.Cur())
+		buffer.total++
+		for _, a := range account.Interests {
+			if int(a) > interestsCount {
+				continue
+			}
+			counts[a]++
+			for _, b := range account.Interests {
+				if a != b && int(b) <= interestsCount {
+					pairs[int(a)*(interestsCount+1)+int(b)]++
+				}
+			}
+		}
+		it.Next()
+	}
+
+	for interest := Interest(1); int(interest) <= interestsCount; interest++ {
+		if counts[interest] > 0 {
+			store.appendCooccurrence(cooccurrence, buffer, interest, counts, pairs)
+		}
+	}
+	sort.Slice(buffer.interests, func(i, j int) bool {
+		a, b := &buffer.interests[i], &buffer.interests[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return store.interestString(a.Interest) < store.interestString(b.Interest)
+	})
+}
+
+// appendCooccurrence adds top pairs of interest to buffer from counts of
+// interests and flat matrix of pair counts.
+func (store *Store) appendCooccurrence(cooccurrence *Cooccurrence, buffer *CooccurrenceBuffer, interest Interest, counts []uint32, pairs []uint32) {
+	entry := InterestCooccurrence{
+		Interest: interest,
+		Count:    counts[interest],
+	}
+	row := pairs[int(interest)*len(counts) : int(interest+1)*len(counts)]
+	for other, count := range row {
+		if count == 0 {
+			continue
+		}
+		union := counts[interest] + counts[other] - count
+		entry.Pairs = append(entry.Pairs, InterestPair{
+			Interest: Interest(other),
+			Count:    count,
+			Lift:     float64(count) * float64(buffer.total) / (float64(counts[interest]) * float64(counts[other])),
+			Jaccard:  float64(count) / float64(union),
+		})
+	}
+
+	sortBy := cooccurrence.Sort()
+	sort.Slice(entry.Pairs, func(i, j int) bool {
+		a, b := &entry.Pairs[i], &entry.Pairs[j]
+		switch sortBy {
+		case CooccurrenceSortLift:
+			if a.Lift != b.Lift {
+				return a.Lift > b.Lift
+			}
+		case CooccurrenceSortJaccard:
+			if a.Jaccard != b.Jaccard {
+				return a.Jaccard > b.Jaccard
+			}
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return store.interestString(a.Interest) < store.interestString(b.Interest)
+	})
+	if len(entry.Pairs) > cooccurrence.Limit() {
+		entry.Pairs = entry.Pairs[:cooccurrence.Limit()]
+	}
+
+	buffer.interests = append(buffer.interests, entry)
+}
+
+// cooccurrenceIter returns iterator over accounts matched by filter of
+// cooccurrence query and by all of extra iterators.
+func (store *Store) cooccurrenceIter(cooccurrence *Cooccurrence, extra ...IndexIterator) IndexIterator {
+	filter := cooccurrence.Filter
+	iters := extra
+	if filter.Country != 0 {
+		iters = append(iters, store.index.Country.Iter(filter.Country))
+	}
+	if filter.City != 0 {
+		iters = append(iters, store.index.City.Iter(filter.City))
+	}
+	if filter.Sex != 0 {
+		iters = append(iters, store.index.Sex.Iter(filter.Sex))
+	}
+	switch len(iters) {
+	case 0:
+		return store.index.ID.Iter()
+	case 1:
+		return iters[0]
+	}
+	return NewIntersectIndexIterator(iters...)
+}
+
+func (store *Store) interestString(interest Interest) string {
+	str, _ := store.dicts.GetInterestString(interest)
+	return str
+}
+
+func countIterator(it IndexIterator) (count uint32) {
+	for it.Cur() != 0 {
+		count++
+		it.Next()
+	}
+	return count
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// cooccurrenceJSON runs cooccurrence by query and returns response body.
+func cooccurrenceJSON(t *testing.T, store *Store, parser *Parser, dicts *Dicts, query string) string {
+	cooccurrence := BorrowCooccurrence(parser, dicts)
+	defer cooccurrence.Release()
+	err := cooccurrence.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	cooccurrenceBuffer := BorrowCooccurrenceBuffer()
+	defer cooccurrenceBuffer.Release()
+	store.Cooccurrence(cooccurrence, cooccurrenceBuffer)
+
+	var buffer bytes.Buffer
+	parser.EncodeCooccurrence(cooccurrenceBuffer, &buffer)
+	return buffer.String()
+}
+
+func TestCooccurrence(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"limit=10", `{"total":6,"interests":[{"interest":"Кино","count":3,"cooccurring":[{"interest":"Книги","count":1,"lift":1,"jaccard":0.25},{"interest":"Спорт","count":1,"lift":0.6667,"jaccard":0.2}]},{"interest":"Спорт","count":3,"cooccurring":[{"interest":"Музыка","count":2,"lift":2,"jaccard":0.6667},{"interest":"Книги","count":1,"lift":1,"jaccard":0.25},{"interest":"Кино","count":1,"lift":0.6667,"jaccard":0.2}]},{"interest":"Книги","count":2,"cooccurring":[{"interest":"Музыка","count":1,"lift":1.5,"jaccard":0.3333},{"interest":"Кино","count":1,"lift":1,"jaccard":0.25},{"interest":"Спорт","count":1,"lift":1,"jaccard":0.25}]},{"interest":"Музыка","count":2,"cooccurring":[{"interest":"Спорт","count":2,"lift":2,"jaccard":0.6667},{"interest":"Книги","count":1,"lift":1.5,"jaccard":0.3333}]}]}`},
+		{"limit=1&sort=lift", `{"total":6,"interests":[{"interest":"Кино","count":3,"cooccurring":[{"interest":"Книги","count":1,"lift":1,"jaccard":0.25}]},{"interest":"Спорт","count":3,"cooccurring":[{"interest":"Музыка","count":2,"lift":2,"jaccard":0.6667}]},{"interest":"Книги","count":2,"cooccurring":[{"interest":"Музыка","count":1,"lift":1.5,"jaccard":0.3333}]},{"interest":"Музыка","count":2,"cooccurring":[{"interest":"Спорт","count":2,"lift":2,"jaccard":0.6667}]}]}`},
+		{"limit=10&sort=jaccard&sex=m", `{"total":3,"interests":[{"interest":"Кино","count":2,"cooccurring":[{"interest":"Книги","count":1,"lift":0.75,"jaccard":0.3333},{"interest":"Спорт","count":1,"lift":0.75,"jaccard":0.3333}]},{"interest":"Книги","count":2,"cooccurring":[{"interest":"Музыка","count":1,"lift":1.5,"jaccard":0.5},{"interest":"Кино","count":1,"lift":0.75,"jaccard":0.3333},{"interest":"Спорт","count":1,"lift":0.75,"jaccard":0.3333}]},{"interest":"Спорт","count":2,"cooccurring":[{"interest":"Музыка","count":1,"lift":1.5,"jaccard":0.5},{"interest":"Кино","count":1,"lift":0.75,"jaccard":0.3333},{"interest":"Книги","count":1,"lift":0.75,"jaccard":0.3333}]},{"interest":"Музыка","count":1,"cooccurring":[{"interest":"Книги","count":1,"lift":1.5,"jaccard":0.5},{"interest":"Спорт","count":1,"lift":1.5,"jaccard":0.5}]}]}`},
+		{"limit=10&interest=Спорт", `{"total":6,"interests":[{"interest":"Спорт","count":3,"cooccurring":[{"interest":"Музыка","count":2,"lift":2,"jaccard":0.6667},{"interest":"Книги","count":1,"lift":1,"jaccard":0.25},{"interest":"Кино","count":1,"lift":0.6667,"jaccard":0.2}]}]}`},
+		{"limit=10&interest=Кино&country=Росмаль", `{"total":3,"interests":[{"interest":"Кино","count":2,"cooccurring":[{"interest":"Книги","count":1,"lift":1.5,"jaccard":0.5},{"interest":"Спорт","count":1,"lift":0.75,"jaccard":0.3333}]}]}`},
+		{"limit=10&interest=Unknown", `{"total":0,"interests":[]}`},
+		{"limit=10&city=Берлин", `{"total":1,"interests":[{"interest":"Кино","count":1,"cooccurring":[]}]}`},
+	}
+
+	for _, test := range tests {
+		if got := cooccurrenceJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"interest=Спорт", "limit=0", "limit=10&sort=count&sort=lift", "limit=10&sort=support", "limit=10&sex=x", "limit=10&keys=sex"} {
+		cooccurrence := BorrowCooccurrence(parser, dicts)
+		if err := cooccurrence.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		cooccurrence.Release()
+	}
+}
+
+func TestCooccurrenceInterest(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	// row of one interest counted by posting lists is the same as row of
+	// all interests scanned
+	for _, filter := range []string{"", "&sex=f", "&country=Росмаль", "&city=Москва&sex=m"} {
+		for _, sortBy := range []string{"count", "lift", "jaccard"} {
+			query := "limit=10&sort=" + sortBy + filter
+			cooccurrence := BorrowCooccurrence(parser, dicts)
+			if err := cooccurrence.Parse(query); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			all := BorrowCooccurrenceBuffer()
+			store.Cooccurrence(cooccurrence, all)
+			cooccurrence.Release()
+
+			for _, entry := range all.interests {
+				interest, _ := dicts.GetInterestString(entry.Interest)
+				want := BorrowCooccurrenceBuffer()
+				want.total = all.total
+				want.interests = append(want.interests, entry)
+				var buffer bytes.Buffer
+				parser.EncodeCooccurrence(want, &buffer)
+				want.Release()
+
+				one := query + "&interest=" + interest
+				if got := cooccurrenceJSON(t, store, parser, dicts, one); got != buffer.String() {
+					t.Errorf("%s:\ngot  %s\nwant %s", one, got, buffer.String())
+				}
+			}
+			all.Release()
+		}
+	}
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"math"
+	"math/rand"
+	"sort"
 	"strings"
+	"time"
 )
 
 func (store *Store) Filter(filter *Filter, accounts *AccountsBuffer) {
 	if filter.ExpectEmpty() {
 		return
 	}
+	store.resolveAge(filter)
+
+	if filter.Sample() != 0 {
+		store.sample(filter, accounts)
+		return
+	}
 
 	it := store.findIds(filter)
 
 	for it.Cur() != 0 {
 		account := store.get(it.Cur())
+		filter.plan.Scanned++
 
 		if !filter.NoFilter() && !store.filterAccount(account, filter) {
 			it.Next()
@@ -42,148 +53,170 @@ func (store *Store) Filter(filter *Filter, accounts *AccountsBuffer) {
 	// }
 }
 
-func (store *Store) findIds(filter *Filter) IndexIterator {
-	if len(filter.LikesContains) > 0 {
-		if len(filter.LikesContains) == 1 {
-			likee := filter.LikesContains[0]
-			filter.LikesContains = filter.LikesContains[:0]
-			return store.index.Likee.Iter(ID(likee))
-			// return store.index.Likee.Find(ID(likee))
-		}
-		likersAll := make([]IndexIterator, len(filter.LikesContains))
-		// likersAll := BorrowIndexIterators()
-		// defer likersAll.Release()
-		for i, likeeContains := range filter.LikesContains {
-			// likersAll[i] = store.index.Likee.Find(ID(likeeContains))
-			likersAll[i] = store.index.Likee.Iter(ID(likeeContains))
-		}
-		filter.LikesContains = nil
-		return NewIntersectIndexIterator(likersAll...)
-		// return IntersectIndexes(likersAll...)
-	}
-	if filter.CityEq != 0 {
-		city := filter.CityEq
-		filter.CityEq = 0
-		// return store.index.City.Find(city)
-		return store.index.City.Iter(city)
-	}
-	if filter.BirthYear != 0 {
-		birthYear := filter.BirthYear
-		filter.BirthYear = 0
-		// return store.index.BirthYear.Find(birthYear)
-		if filter.CityNullSet && filter.CityNull {
-			filter.CityNullSet = false
-			// return store.index.City.Find(0)
-			return NewIntersectIndexIterator(
-				store.index.BirthYear.Iter(birthYear),
-				store.index.City.Iter(0),
-			)
-		}
-		return store.index.BirthYear.Iter(birthYear)
-	}
-	if filter.PhoneCode != 0 {
-		phoneCode := filter.PhoneCode
-		filter.PhoneCode = 0
-		// return store.index.PhoneCode.Find(phoneCode)
-		return store.index.PhoneCode.Iter(phoneCode)
-	}
-	if len(filter.InterestsContains) > 0 {
-		if len(filter.InterestsContains) == 1 {
-			interest := filter.InterestsContains[0]
-			filter.InterestsContains = filter.InterestsContains[:0]
-			// return store.index.Interest.Find(interest)
-			return store.index.Interest.Iter(interest)
-		}
-		interestsAll := make([]IndexIterator, len(filter.InterestsContains))
-		// interestsAll := BorrowIndexIterators()
-		// defer interestsAll.Release()
-		for i, interestContains := range filter.InterestsContains {
-			// interestsAll[i] = store.index.Interest.Find(interestContains)
-			interestsAll[i] = store.index.Interest.Iter(interestContains)
-		}
-		filter.InterestsContains = filter.InterestsContains[:0]
-		if filter.CountryNullSet && filter.CountryNull {
-			filter.CountryNullSet = false
-			interestsAll = append(interestsAll, store.index.Country.Iter(0))
-		}
-		return NewIntersectIndexIterator((interestsAll)...)
-		// return IntersectIndexes(interestsAll...)
-	}
-	if len(filter.InterestsAny) > 0 {
-		interestsAny := make([]IndexIterator, len(filter.InterestsAny))
-		// interestsAny := BorrowIndexIterators()
-		// defer interestsAny.Release()
+// sample picks uniformly random matched accounts with reservoir
+// sampling over all ids, so recent ids are not preferred.
+func (store *Store) sample(filter *Filter, accounts *AccountsBuffer) {
+	rnd := rand.New(rand.NewSource(filter.Seed()))
+	matched := int64(0)
+
+	it := store.findIds(filter)
+	for it.Cur() != 0 {
+		account := store.get(it.Cur())
+		filter.plan.Scanned++
+		it.Next()
+
+		if !filter.NoFilter() && !store.filterAccount(account, filter) {
+			continue
+		}
 
-		for i, interestAny := range filter.InterestsAny {
-			interestsAny[i] = store.index.Interest.Iter(interestAny)
+		matched++
+		if len(*accounts) < filter.Sample() {
+			*accounts = append(*accounts, account)
+			continue
 		}
-		filter.InterestsAny = filter.InterestsAny[:0]
-		interestsIt := NewUnionIndexIterator((interestsAny)...)
-		if filter.CountryEq != 0 {
-			country := filter.CountryEq
-			filter.CountryEq = 0
-			// return store.index.Country.Find(country)
-			return NewIntersectIndexIterator(interestsIt, store.index.Country.Iter(country))
+		if i := rnd.Int63n(matched); i < int64(filter.Sample()) {
+			(*accounts)[i] = account
 		}
-		return interestsIt
 	}
-	if len(filter.CityAny) > 0 {
-		citiesAny := make([]IndexIterator, len(filter.CityAny))
-		// citiesAny := BorrowIndexIterators()
-		// defer citiesAny.Release()
 
-		for i, cityAny := range filter.CityAny {
-			citiesAny[i] = store.index.City.Iter(cityAny)
-		}
-		filter.CityAny = filter.CityAny[:0]
-		return NewUnionIndexIterator((citiesAny)...)
+	sort.Slice(*accounts, func(i, j int) bool {
+		return (*accounts)[i].ID > (*accounts)[j].ID
+	})
+}
+
+func (store *Store) FilterCount(filter *Filter) int {
+	if filter.ExpectEmpty() {
+		return 0
 	}
-	if len(filter.FnameAny) > 0 {
-		// fnamesAny := make([]IDS, len(filter.FnameAny))
-		fnamesAny := make([]IndexIterator, len(filter.FnameAny))
-		// fnamesAny := BorrowIndexIterators()
-		// defer fnamesAny.Release()
+	store.resolveAge(filter)
 
-		for i, fnameAny := range filter.FnameAny {
-			// fnamesAny[i] = store.index.Fname.Find(fnameAny)
-			// fnamesAny[i] = store.index.Fname.Iter(fnameAny)
-			fnamesAny[i] = store.index.Fname.Iter(fnameAny)
-		}
-		filter.FnameAny = filter.FnameAny[:0]
-		if filter.CountryEq != 0 {
-			country := filter.CountryEq
-			filter.CountryEq = 0
-			// return store.index.Country.Find(country)
-			return NewIntersectIndexIterator(
-				NewUnionIndexIterator((fnamesAny)...),
-				store.index.Country.Iter(country),
-			)
-		}
-		return NewUnionIndexIterator((fnamesAny)...)
-		// return UnionIndexes(fnamesAny...)
+	if count, ok := store.countIds(filter); ok {
+		// answered by index sizes without scan
+		filter.plan.Estimate = count
+		filter.plan.Steps = append(filter.plan.Steps, FilterPlanStep{Index: "count", Estimate: count})
+		return count
 	}
-	if filter.CityNullSet {
-		if filter.CityNull {
-			filter.CityNullSet = false
-			// return store.index.City.Find(0)
-			return store.index.City.Iter(0)
+
+	count := 0
+	it := store.findIds(filter)
+	for it.Cur() != 0 {
+		filter.plan.Scanned++
+		if filter.NoFilter() || store.filterAccount(store.get(it.Cur()), filter) {
+			count++
 		}
+		it.Next()
 	}
-	if filter.CountryEq != 0 {
-		country := filter.CountryEq
-		filter.CountryEq = 0
-		// return store.index.Country.Find(country)
-		return store.index.Country.Iter(country)
+	return count
+}
+
+// resolveAge converts age params to birth bounds relative to store.now,
+// so the same filter stays correct while the clock moves.
+func (store *Store) resolveAge(filter *Filter) {
+	if !filter.Age() {
+		return
 	}
-	if filter.CountryNullSet {
+	now := time.Unix(int64(store.now), 0).UTC()
+	filter.ageBirthGte = math.MinInt64
+	filter.ageBirthLte = math.MaxInt64
+	if filter.AgeMinSet {
+		filter.ageBirthLte = now.AddDate(-int(filter.AgeMin), 0, 0).Unix()
+	}
+	if filter.AgeMaxSet {
+		filter.ageBirthGte = now.AddDate(-int(filter.AgeMax)-1, 0, 0).Unix() + 1
+	}
+}
+
+// countIds returns cardinality of the filter without scan when
+// it maps to index buckets as is.
+func (store *Store) countIds(filter *Filter) (int, bool) {
+	if filter.NoFilter() {
+		return store.index.ID.Len(), true
+	}
+	if filter.params != 1 {
+		return 0, false
+	}
+	switch {
+	case filter.SexEq != 0:
+		return store.index.Sex.Count(filter.SexEq), true
+	case filter.SexNeq != 0:
+		return store.index.ID.Len() - store.index.Sex.Count(filter.SexNeq), true
+	case filter.StatusEq != 0:
+		return store.index.Status.Count(filter.StatusEq), true
+	case len(filter.StatusAny) > 0:
+		count := 0
+		for _, status := range filter.StatusAny {
+			count += store.index.Status.Count(status)
+		}
+		return count, true
+	case filter.StatusNeq != 0:
+		return store.index.ID.Len() - store.index.Status.Count(filter.StatusNeq), true
+	case filter.FnameEq != 0:
+		return store.index.Fname.Count(filter.FnameEq), true
+	case len(filter.FnameAny) > 0:
+		count := 0
+		for _, fname := range filter.FnameAny {
+			count += store.index.Fname.Count(fname)
+		}
+		return count, true
+	case len(filter.FnameNany) > 0:
+		count := store.index.ID.Len()
+		for _, fname := range filter.FnameNany {
+			count -= store.index.Fname.Count(fname)
+		}
+		return count, true
+	case filter.FnameNullSet:
+		if filter.FnameNull {
+			return store.index.Fname.Count(0), true
+		}
+		return store.index.ID.Len() - store.index.Fname.Count(0), true
+	case filter.CountryEq != 0:
+		return store.index.Country.Count(filter.CountryEq), true
+	case len(filter.CountryAny) > 0:
+		count := 0
+		for _, country := range filter.CountryAny {
+			count += store.index.Country.Count(country)
+		}
+		return count, true
+	case len(filter.CountryNany) > 0:
+		count := store.index.ID.Len()
+		for _, country := range filter.CountryNany {
+			count -= store.index.Country.Count(country)
+		}
+		return count, true
+	case filter.CountryNullSet:
 		if filter.CountryNull {
-			filter.CountryNullSet = false
-			// return store.index.Country.Find(0)
-			return store.index.Country.Iter(0)
+			return store.index.Country.Count(0), true
 		}
-	}
-	// return store.index.ID.FindAll()
-	return store.index.ID.Iter()
+		return store.index.ID.Len() - store.index.Country.Count(0), true
+	case filter.CityEq != 0:
+		return store.index.City.Count(filter.CityEq), true
+	case len(filter.CityAny) > 0:
+		count := 0
+		for _, city := range filter.CityAny {
+			count += store.index.City.Count(city)
+		}
+		return count, true
+	case len(filter.CityNany) > 0:
+		count := store.index.ID.Len()
+		for _, city := range filter.CityNany {
+			count -= store.index.City.Count(city)
+		}
+		return count, true
+	case filter.CityNullSet:
+		if filter.CityNull {
+			return store.index.City.Count(0), true
+		}
+		return store.index.ID.Len() - store.index.City.Count(0), true
+	case filter.BirthYear != 0:
+		return store.index.BirthYear.Count(filter.BirthYear), true
+	case filter.PhoneCode != 0:
+		return store.index.PhoneCode.Count(filter.PhoneCode), true
+	case len(filter.InterestsContains) == 1:
+		return store.index.Interest.Count(filter.InterestsContains[0]), true
+	case len(filter.LikesContains) == 1:
+		return store.index.Likee.Count(ID(filter.LikesContains[0])), true
+	}
+	return 0, false
 }
 
 func (store *Store) filterAccount(account *Account, filter *Filter) bool {
@@ -192,6 +225,11 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if filter.SexNeq != 0 {
+		if account.Sex == filter.SexNeq {
+			return false
+		}
+	}
 	if filter.EmailDomain != "" {
 		if account.Email[account.EmailDomain:] != filter.EmailDomain {
 			return false
@@ -207,6 +245,17 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.StatusAny) > 0 {
+		any := false
+		for _, status := range filter.StatusAny {
+			if status == account.Status {
+				any = true
+			}
+		}
+		if !any {
+			return false
+		}
+	}
 	if filter.FnameEq != 0 {
 		if account.Fname == 0 {
 			return false
@@ -215,6 +264,24 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.FnameLikeAny) > 0 {
+		any := false
+		for _, fname := range filter.FnameLikeAny {
+			if fname == account.Fname {
+				any = true
+			}
+		}
+		if !any {
+			return false
+		}
+	}
+	if len(filter.FnameNany) > 0 {
+		for _, fname := range filter.FnameNany {
+			if fname == account.Fname {
+				return false
+			}
+		}
+	}
 	if filter.FnameNullSet {
 		if filter.FnameNull {
 			if account.Fname != 0 {
@@ -234,6 +301,17 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.SnameLikeAny) > 0 {
+		any := false
+		for _, sname := range filter.SnameLikeAny {
+			if sname == account.Sname {
+				any = true
+			}
+		}
+		if !any {
+			return false
+		}
+	}
 	if filter.SnameNullSet {
 		if filter.SnameNull {
 			if account.Sname != 0 {
@@ -250,6 +328,23 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.PhoneCodeNany) > 0 && account.Phone != nil {
+		for _, phoneCode := range filter.PhoneCodeNany {
+			if phoneCode == account.PhoneCode {
+				return false
+			}
+		}
+	}
+	if filter.PhoneEq != "" {
+		if account.Phone == nil || *account.Phone != filter.PhoneEq {
+			return false
+		}
+	}
+	if filter.PhoneStarts != "" {
+		if account.Phone == nil || !strings.HasPrefix(*account.Phone, filter.PhoneStarts) {
+			return false
+		}
+	}
 	if filter.PhoneNullSet {
 		if filter.PhoneNull {
 			if account.Phone != nil {
@@ -270,6 +365,27 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.CountryAny) > 0 {
+		if account.Country == 0 {
+			return false
+		}
+		any := false
+		for _, country := range filter.CountryAny {
+			if country == account.Country {
+				any = true
+			}
+		}
+		if !any {
+			return false
+		}
+	}
+	if len(filter.CountryNany) > 0 {
+		for _, country := range filter.CountryNany {
+			if country == account.Country {
+				return false
+			}
+		}
+	}
 	if filter.CountryNullSet {
 		if filter.CountryNull {
 			if account.Country != 0 {
@@ -315,6 +431,24 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.CityLikeAny) > 0 {
+		any := false
+		for _, city := range filter.CityLikeAny {
+			if city == account.City {
+				any = true
+			}
+		}
+		if !any {
+			return false
+		}
+	}
+	if len(filter.CityNany) > 0 {
+		for _, city := range filter.CityNany {
+			if city == account.City {
+				return false
+			}
+		}
+	}
 	if filter.CityNullSet {
 		if filter.CityNull {
 			if account.City != 0 {
@@ -341,6 +475,11 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if filter.Age() {
+		if account.Birth < filter.ageBirthGte || account.Birth > filter.ageBirthLte {
+			return false
+		}
+	}
 	if filter.PremiumNow {
 		if !store.PremiumNow(account) {
 			return false
@@ -385,6 +524,15 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.InterestsNone) > 0 {
+		for _, interestNone := range filter.InterestsNone {
+			for _, interest := range account.Interests {
+				if interest == interestNone {
+					return false
+				}
+			}
+		}
+	}
 	if len(filter.LikesContains) != 0 {
 		likes := store.index.Liker.Find(account.ID)
 		if len(likes) == 0 {
@@ -408,6 +556,47 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if len(filter.LikesAny) != 0 {
+		likes := store.index.Liker.Find(account.ID)
+		if len(likes) == 0 {
+			return false
+		}
+		any := false
+		for _, likeID := range filter.LikesAny {
+			for _, like := range likes {
+				if like.ID == ID(likeID) {
+					any = true
+					break
+				}
+			}
+			if any {
+				break
+			}
+		}
+		if !any {
+			return false
+		}
+	}
+	if filter.LikesCountGtSet {
+		if uint32(store.index.Liker.Count(account.ID)) <= filter.LikesCountGt {
+			return false
+		}
+	}
+	if filter.LikesCountLtSet {
+		if uint32(store.index.Liker.Count(account.ID)) >= filter.LikesCountLt {
+			return false
+		}
+	}
+	if filter.LikedCountGtSet {
+		if uint32(store.index.Likee.Count(account.ID)) <= filter.LikedCountGt {
+			return false
+		}
+	}
+	if filter.LikedCountLtSet {
+		if uint32(store.index.Likee.Count(account.ID)) >= filter.LikedCountLt {
+			return false
+		}
+	}
 	if filter.SnameStarts != "" {
 		if account.Sname == 0 {
 			return false
@@ -444,5 +633,10 @@ func (store *Store) filterAccount(account *Account, filter *Filter) bool {
 			return false
 		}
 	}
+	if filter.Query != nil {
+		if !store.queryMatch(filter.Query, account) {
+			return false
+		}
+	}
 	return true
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestFilterCount(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		params url.Values
+		want   int
+	}{
+		{url.Values{}, 6},
+		{url.Values{"sex_eq": {"m"}}, 3},
+		{url.Values{"status_eq": {"заняты"}}, 2},
+		{url.Values{"fname_null": {"1"}}, 1},
+		{url.Values{"sex_eq": {"f"}, "city_eq": {"Москва"}}, 1},
+		{url.Values{"sex_eq": {"m"}, "interests_contains": {"Спорт"}}, 2},
+		{url.Values{"q": {"city=null OR sex=f"}}, 4},
+		{url.Values{"country_eq": {"Unknown"}}, 0},
+	}
+
+	for _, test := range tests {
+		filter := NewFilter(parser, dicts)
+		filter.Reset()
+		params := url.Values{"count": {"1"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		err := filter.Parse(params.Encode())
+		if err != nil {
+			t.Fatalf("%s: %v", params.Encode(), err)
+		}
+		if got := store.FilterCount(filter); got != test.want {
+			t.Errorf("%s: count %d, want %d", params.Encode(), got, test.want)
+		}
+
+		// count matches accounts found by filter
+		params.Del("count")
+		params.Set("limit", "50")
+		if got := len(filterIDs(t, store, parser, dicts, params)); got != test.want {
+			t.Errorf("%s: found %d, want %d", params.Encode(), got, test.want)
+		}
+	}
+}
+
+func TestFilterSample(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		params  url.Values
+		matched IDS
+		want    int
+	}{
+		{url.Values{"sample": {"2"}}, IDS{6, 5, 4, 3, 2, 1}, 2},
+		{url.Values{"sample": {"10"}}, IDS{6, 5, 4, 3, 2, 1}, 6},
+		{url.Values{"sample": {"2"}, "sex_eq": {"f"}}, IDS{5, 3, 2}, 2},
+		{url.Values{"sample": {"1"}, "status_neq": {"свободны"}}, IDS{6, 4, 3}, 1},
+		{url.Values{"sample": {"3"}, "country_eq": {"Германия"}}, IDS{3}, 1},
+	}
+
+	for _, test := range tests {
+		for seed := 1; seed <= 20; seed++ {
+			params := url.Values{"seed": {strconv.Itoa(seed)}}
+			for param, values := range test.params {
+				params[param] = values
+			}
+			got := filterIDs(t, store, parser, dicts, params)
+			if len(got) != test.want {
+				t.Fatalf("%s: got %v, want %d accounts", params.Encode(), got, test.want)
+			}
+			for i, id := range got {
+				if IntersectIndexes(test.matched, IDS{id}).Len() == 0 {
+					t.Fatalf("%s: got %v, %d does not match", params.Encode(), got, id)
+				}
+				if i > 0 && got[i-1] <= id {
+					t.Fatalf("%s: got %v, not sorted by id", params.Encode(), got)
+				}
+			}
+			// the same seed takes the same sample
+			if again := filterIDs(t, store, parser, dicts, params); !equalIDS(again, got) {
+				t.Fatalf("%s: got %v and %v", params.Encode(), got, again)
+			}
+		}
+	}
+
+	for _, query := range []string{"sample=0", "sample=x", "seed=1&limit=1", "sample=1&seed=x"} {
+		filter := NewFilter(parser, dicts)
+		filter.Reset()
+		if err := filter.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+func TestFilterSampleUniform(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	const seeds = 3000
+	taken := make(map[ID]int)
+	for seed := 1; seed <= seeds; seed++ {
+		params := url.Values{"sample": {"2"}, "seed": {strconv.Itoa(seed)}}
+		for _, id := range filterIDs(t, store, parser, dicts, params) {
+			taken[id]++
+		}
+	}
+	// every account is taken in third of samples
+	for id := ID(1); id <= 6; id++ {
+		if taken[id] < seeds/3*85/100 || taken[id] > seeds/3*115/100 {
+			t.Errorf("account %d taken %d times of %d", id, taken[id], seeds)
+		}
+	}
+}
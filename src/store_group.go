@@ -2,6 +2,8 @@ package main
 
 import (
 	"sort"
+
+	"github.com/pkg/errors"
 )
 
 func (store *Store) Group(group *Group, buffer *GroupsBuffer) {
@@ -10,8 +12,23 @@ func (store *Store) Group(group *Group, buffer *GroupsBuffer) {
 	}
 
 	filter := &group.Filter
+	buffer.keysMask = group.KeysMask
+	buffer.agg = group.Agg
+	buffer.now = store.now
+
+	precomputed := group.Agg == 0 ||
+		(store.index.Group.Stats() && group.Agg&GroupAggScanOnly == 0)
 
-	if filter.Likes == 0 {
+	if filter.Likes != 0 && group.FilterMask == 0 && group.Agg == 0 &&
+		store.index.GroupLikes.Has(group.KeysMask) {
+		aggregation := store.index.GroupLikes.Get(filter.Likes, group.KeysMask)
+		if aggregation != nil {
+			store.groupFromAggregation(group, aggregation, buffer)
+		}
+		return
+	}
+
+	if filter.Likes == 0 && precomputed {
 		aggregation := store.index.Group.Get(
 			group.FilterMask,
 			group.KeysMask,
@@ -19,70 +36,20 @@ func (store *Store) Group(group *Group, buffer *GroupsBuffer) {
 		)
 		// Copy???
 		if aggregation != nil {
-			if group.OrderAsc() {
-				if len(aggregation.Get()) > group.Limit() {
-					buffer.groups = buffer.groups[:group.Limit()]
-					entries := aggregation.Get()
-					for i := range entries {
-						if i >= group.Limit() {
-							break
-						}
-						buffer.groups[i] = &entries[i]
-					}
-					// return entries[:group.Limit()], true
-				} else {
-					entries := aggregation.Get()
-					buffer.groups = buffer.groups[:len(entries)]
-					// copy(buffer.groups, ag)
-					for i := range entries {
-						buffer.groups[i] = &entries[i]
-					}
-				}
-				buffer.orderAsc = true
-				return
-				// return entries, true
-			}
-
-			// OrderDesc
-			if len(aggregation.Get()) > group.Limit() {
-				buffer.groups = buffer.groups[:group.Limit()]
-				// copy(buffer.groups, aggregation.Get()[len(aggregation.Get())-group.Limit():])
-				entries := aggregation.Get()[len(aggregation.Get())-group.Limit():]
-				for i := range entries {
-					if i >= group.Limit() {
-						break
-					}
-					buffer.groups[i] = &entries[i]
-				}
-				// return entries[len(entries)-group.Limit():], false
-			} else {
-				buffer.groups = buffer.groups[:len(aggregation.Get())]
-				// copy(buffer.groups, aggregation.Get())
-				entries := aggregation.Get()
-				for i := range entries {
-					buffer.groups[i] = &entries[i]
-				}
-			}
-			buffer.orderAsc = false
+			store.groupFromAggregation(group, aggregation, buffer)
 			return
-
-			// return entries, false
-			// reverse := make([]*GroupEntry, len(entries))
-			// for i, j := len(entries)-1, 0; i >= 0; i, j = i-1, j+1 {
-			// 	reverse[j] = entries[i]
-			// }
-			// return reverse
 		}
 
-		// return make([]*GroupEntry, 0), true
-		return
+		// combination is precomputed, but no account has such filter values
+		if store.index.Group.Has(group.FilterMask, group.KeysMask) {
+			return
+		}
 	}
 
-	// scan by indexes
-	// fmt.Println("from scan")
-
+	// scan by indexes for likes filter and combinations
+	// which are not precomputed
 	aggregation := BorrowAggregation(store.dicts, group.KeysMask)
-	defer aggregation.Release()
+	buffer.aggregation = aggregation
 
 	iter := store.findGroupIds(filter)
 
@@ -112,76 +79,184 @@ func (store *Store) Group(group *Group, buffer *GroupsBuffer) {
 				if account.City != 0 {
 					groupHash.SetCity(account.City)
 				}
+			case GroupBirth:
+				groupHash.SetBirth(timestampToYear(account.Birth))
+			case GroupJoined:
+				groupHash.SetJoined(timestampToYear(int64(account.Joined)))
+			case GroupLikes:
+				groupHash.SetLikesBucket(LikesBucket(uint32(store.index.Likee.Count(account.ID))))
 			}
 		}
 
+		var sample *GroupStats
+		if group.Agg != 0 {
+			stats := CreateStatsFromAccount(account, store.PremiumNow(account))
+			if group.Agg&GroupAggAvgLikes > 0 {
+				stats.Likes = uint32(store.index.Likee.Count(account.ID))
+			}
+			sample = &stats
+		}
+
 		if group.HasKey(GroupInterestsMask) {
 			for _, interest := range account.Interests {
 				groupHash.SetInterest(interest)
-				aggregation.Append(groupHash)
+				aggregation.Append(groupHash, sample)
 			}
 		} else {
-			aggregation.Append(groupHash)
+			aggregation.Append(groupHash, sample)
 		}
 		iter.Next()
 	}
 
-	if group.OrderAsc() {
+	if !group.SortKey() {
 		sort.Sort(aggregation)
-	} else {
-		sort.Sort(sort.Reverse(aggregation))
 	}
+	store.groupFromAggregation(group, aggregation, buffer)
+}
 
-	buffer.orderAsc = true
+// groupStats copies stats of page groups for agg functions.
+func (store *Store) groupStats(group *Group, aggregation *Aggregation, buffer *GroupsBuffer) {
+	if group.Agg == 0 {
+		return
+	}
+	for _, entry := range buffer.groups {
+		buffer.stats = append(buffer.stats, aggregation.Stats(entry.Hash))
+	}
+}
+
+// groupFromAggregation fills buffer with page of entries of aggregation,
+// which is kept sorted in ascending order by count.
+func (store *Store) groupFromAggregation(group *Group, aggregation *Aggregation, buffer *GroupsBuffer) {
 	entries := aggregation.Get()
-	if len(entries) > group.Limit() {
-		buffer.groups = buffer.groups[:group.Limit()]
-		// copy(buffer.groups, entries)
+	offset, limit := group.Offset(), group.Limit()
+	if group.Paged() && len(entries) > offset+limit {
+		buffer.next = offset + limit
+	}
+
+	if group.SortKey() {
 		for i := range entries {
-			if i >= group.Limit() {
-				break
+			buffer.groups = append(buffer.groups, &entries[i])
+		}
+		groups := buffer.groups
+		sort.Slice(groups, func(i, j int) bool {
+			if group.OrderDesc() {
+				return group.isKeyLess(groups[j], groups[i])
 			}
-			buffer.groups[i] = &entries[i]
+			return group.isKeyLess(groups[i], groups[j])
+		})
+		if offset > len(groups) {
+			offset = len(groups)
 		}
-	} else {
-		buffer.groups = buffer.groups[:len(entries)]
-		// copy(buffer.groups, entries)
-		for i := range entries {
-			buffer.groups[i] = &entries[i]
+		n := copy(groups, groups[offset:])
+		if n > limit {
+			n = limit
 		}
+		buffer.groups = groups[:n]
+		buffer.orderAsc = true
+		store.groupStats(group, aggregation, buffer)
+		return
 	}
+
+	from, to := offset, offset+limit
+	buffer.orderAsc = true
+	if group.OrderDesc() {
+		// encoder walks groups backward
+		from, to = len(entries)-offset-limit, len(entries)-offset
+		buffer.orderAsc = false
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > len(entries) {
+		to = len(entries)
+	}
+	for i := from; i < to; i++ {
+		buffer.groups = append(buffer.groups, &entries[i])
+	}
+	store.groupStats(group, aggregation, buffer)
 }
 
+// findGroupIds drives scan by the smallest index bucket of the filter
+// and intersects it with buckets of comparable size like findIds does.
 func (store *Store) findGroupIds(filter *GroupFilter) IndexIterator {
+	candidates := make([]filterCandidate, 0, 8)
+
 	if filter.Likes != 0 {
-		likee := filter.Likes
-		filter.Likes = 0
-		return store.index.Likee.Iter(likee)
+		candidates = append(candidates, filterCandidate{"likes", store.index.Likee.Count(filter.Likes), func() IndexIterator {
+			likee := filter.Likes
+			filter.Likes = 0
+			return store.index.Likee.Iter(likee)
+		}})
 	}
 	if filter.City != 0 {
-		city := filter.City
-		filter.City = 0
-		return store.index.City.Iter(city)
+		candidates = append(candidates, filterCandidate{"city", store.index.City.Count(filter.City), func() IndexIterator {
+			city := filter.City
+			filter.City = 0
+			return store.index.City.Iter(city)
+		}})
 	}
-	iters := make([]IndexIterator, 0)
 	if filter.Interests != 0 {
-		iters = append(iters, store.index.Interest.Iter(filter.Interests))
-		filter.Interests = 0
+		candidates = append(candidates, filterCandidate{"interests", store.index.Interest.Count(filter.Interests), func() IndexIterator {
+			interest := filter.Interests
+			filter.Interests = 0
+			return store.index.Interest.Iter(interest)
+		}})
 	}
 	if filter.Country != 0 {
-		iters = append(iters, store.index.Country.Iter(filter.Country))
-		filter.Country = 0
+		candidates = append(candidates, filterCandidate{"country", store.index.Country.Count(filter.Country), func() IndexIterator {
+			country := filter.Country
+			filter.Country = 0
+			return store.index.Country.Iter(country)
+		}})
 	}
 	if filter.BirthYear != 0 {
-		iters = append(iters, store.index.BirthYear.Iter(filter.BirthYear))
-		filter.BirthYear = 0
+		candidates = append(candidates, filterCandidate{"birth", store.index.BirthYear.Count(filter.BirthYear), func() IndexIterator {
+			birthYear := filter.BirthYear
+			filter.BirthYear = 0
+			return store.index.BirthYear.Iter(birthYear)
+		}})
+	}
+	if filter.JoinedYear != 0 {
+		candidates = append(candidates, filterCandidate{"joined", store.index.JoinedYear.Count(filter.JoinedYear), func() IndexIterator {
+			joinedYear := filter.JoinedYear
+			filter.JoinedYear = 0
+			return store.index.JoinedYear.Iter(joinedYear)
+		}})
+	}
+	if filter.Sex != 0 {
+		candidates = append(candidates, filterCandidate{"sex", store.index.Sex.Count(filter.Sex), func() IndexIterator {
+			sex := filter.Sex
+			filter.Sex = 0
+			return store.index.Sex.Iter(sex)
+		}})
+	}
+	if filter.Status != 0 {
+		candidates = append(candidates, filterCandidate{"status", store.index.Status.Count(filter.Status), func() IndexIterator {
+			status := filter.Status
+			filter.Status = 0
+			return store.index.Status.Iter(status)
+		}})
+	}
+
+	if len(candidates) == 0 {
+		return store.index.ID.Iter()
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].estimate < candidates[j].estimate
+	})
+
+	iters := make([]IndexIterator, 0, len(candidates))
+	for i, candidate := range candidates {
+		if i > 0 && candidate.estimate > candidates[0].estimate*planIntersectFactor {
+			break
+		}
+		iters = append(iters, candidate.iter())
 	}
 	if len(iters) == 1 {
 		return iters[0]
-	} else if len(iters) > 1 {
-		return NewIntersectIndexIterator(iters...)
 	}
-	return store.index.ID.Iter()
+	return NewIntersectIndexIterator(iters...)
 }
 
 func (store *Store) groupFilterAccount(account *Account, filter *GroupFilter) bool {
@@ -211,8 +286,9 @@ func (store *Store) groupFilterAccount(account *Account, filter *GroupFilter) bo
 			return false
 		}
 	}
+	// years are compared the same way group hashes are built
 	if filter.BirthYear != 0 {
-		if account.Birth < filter.BirthYearGte || account.Birth > filter.BirthYearLte {
+		if timestampToYear(account.Birth) != filter.BirthYear {
 			return false
 		}
 	}
@@ -248,9 +324,62 @@ func (store *Store) groupFilterAccount(account *Account, filter *GroupFilter) bo
 		}
 	}
 	if filter.JoinedYear != 0 {
-		if account.Joined < filter.JoinedYearGte || account.Joined > filter.JoinedYearLte {
+		if timestampToYear(int64(account.Joined)) != filter.JoinedYear {
 			return false
 		}
 	}
 	return true
 }
+
+// AddGroupCombo starts building aggregations for filter and group masks in
+// background, queries use them once built.
+func (store *Store) AddGroupCombo(filter, group GroupHash) error {
+	if err := ValidateGroupCombo(filter, group); err != nil {
+		return err
+	}
+	if store.index.Group.Has(filter, group) {
+		return errors.New("Group combination already exists")
+	}
+	go store.buildGroupCombo(filter, group)
+	return nil
+}
+
+func (store *Store) DropGroupCombo(filter, group GroupHash) error {
+	if !store.index.Group.Drop(filter, group) {
+		return errors.New("Unknown group combination")
+	}
+	return nil
+}
+
+// GroupCombos returns usage and size of precomputed combinations.
+func (store *Store) GroupCombos() []IndexGroupComboStats {
+	return store.index.Group.ComboStats()
+}
+
+// DropUnusedGroupCombos drops combinations which were never queried.
+func (store *Store) DropUnusedGroupCombos() int {
+	return store.index.Group.DropUnused()
+}
+
+// buildGroupCombo builds aggregations for filter and group masks, writers
+// wait until the combination is published, so no change is missed.
+func (store *Store) buildGroupCombo(filter, group GroupHash) {
+	staging := NewIndexGroup(store.dicts)
+	staging.SetCombos(map[GroupHash][]GroupHash{filter: {group}})
+	staging.SetStats(store.index.Group.Stats())
+
+	store.writeLock.Lock()
+	store.index.worker.Wait()
+	store.Iterate(func(account *Account) bool {
+		var sample *GroupStats
+		if staging.Stats() {
+			stats := CreateStatsFromAccount(account, store.PremiumNow(account))
+			sample = &stats
+		}
+		staging.AppendHash(CreateHashFromAccount(account), sample, account.Interests...)
+		return true
+	})
+	staging.UpdateAll()
+	store.index.Group.Merge(staging)
+	store.writeLock.Unlock()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"testing"
+)
+
+// testGroupQueries cover precomputed by default and scanned combinations.
+var testGroupQueries = []struct {
+	query string
+	want  string
+}{
+	{"keys=sex&order=1&limit=10", `{"groups":[{"sex":"f","count":3},{"sex":"m","count":3}]}`},
+	{"keys=status&order=-1&limit=10", `{"groups":[{"status":"свободны","count":3},{"status":"заняты","count":2},{"status":"всё сложно","count":1}]}`},
+	{"keys=city&order=1&limit=10", `{"groups":[{"count":1},{"city":"Берлин","count":1},{"city":"Мадрид","count":1},{"city":"Москва","count":3}]}`},
+	{"keys=country&order=-1&limit=10", `{"groups":[{"country":"Росмаль","count":3},{"country":"Испания","count":1},{"country":"Германия","count":1},{"count":1}]}`},
+	{"keys=interests&order=-1&limit=10", `{"groups":[{"interests":"Спорт","count":3},{"interests":"Кино","count":3},{"interests":"Музыка","count":2},{"interests":"Книги","count":2}]}`},
+	{"keys=birth&order=1&limit=10", `{"groups":[{"birth":1980,"count":1},{"birth":1990,"count":1},{"birth":1991,"count":1},{"birth":1996,"count":1},{"birth":2000,"count":2}]}`},
+	// ties are ordered by city first
+	{"keys=city,status&order=-1&limit=3", `{"groups":[{"status":"свободны","city":"Москва","count":2},{"status":"заняты","city":"Москва","count":1},{"status":"свободны","city":"Мадрид","count":1}]}`},
+	{"keys=country,sex&order=1&limit=10", `{"groups":[{"sex":"m","count":1},{"sex":"f","country":"Германия","count":1},{"sex":"f","country":"Испания","count":1},{"sex":"f","country":"Росмаль","count":1},{"sex":"m","country":"Росмаль","count":2}]}`},
+	{"keys=sex&city=Москва&order=1&limit=10", `{"groups":[{"sex":"f","count":1},{"sex":"m","count":2}]}`},
+	{"keys=interests&country=Росмаль&order=-1&limit=10", `{"groups":[{"interests":"Спорт","count":2},{"interests":"Кино","count":2},{"interests":"Музыка","count":1},{"interests":"Книги","count":1}]}`},
+	{"keys=status&interests=Кино&order=1&limit=10", `{"groups":[{"status":"свободны","count":1},{"status":"заняты","count":2}]}`},
+	{"keys=city&sex=m&status=заняты&order=1&limit=10", `{"groups":[{"city":"Москва","count":1}]}`},
+	{"keys=country,status&joined=2015&order=-1&limit=10", `{"groups":[{"status":"свободны","country":"Росмаль","count":1},{"status":"свободны","country":"Испания","count":1}]}`},
+	{"keys=sex,status&birth=2000&order=1&limit=10", `{"groups":[{"sex":"f","status":"заняты","count":1},{"sex":"m","status":"заняты","count":1}]}`},
+	// likers of account 1 are 2, 3 and 6
+	{"keys=interests&likes=1&order=1&limit=10", `{"groups":[{"interests":"Книги","count":1},{"interests":"Музыка","count":1},{"interests":"Спорт","count":1},{"interests":"Кино","count":2}]}`},
+	{"keys=sex&country=Unknown&order=1&limit=10", `{"groups":[]}`},
+}
+
+func TestGroupScan(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+	scanned, scanParser, scanDicts := newTestStore(t, testAccounts, func(store *Store) {
+		store.SetGroupCombos(map[GroupHash][]GroupHash{})
+	})
+
+	for _, test := range testGroupQueries {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+		if got := groupJSON(t, scanned, scanParser, scanDicts, test.query); got != test.want {
+			t.Errorf("%s without combinations:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestGroupComboBuild(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts, func(store *Store) {
+		store.SetGroupCombos(map[GroupHash][]GroupHash{})
+	})
+	store.index.RunWorker()
+
+	combos := []struct {
+		filter GroupHash
+		group  GroupHash
+	}{
+		{0, GroupCityMask | GroupStatusMask},
+		{0, GroupInterestsMask},
+		{GroupCityMask, GroupSexMask},
+		{GroupSexMask | GroupStatusMask, GroupCityMask},
+	}
+	for _, combo := range combos {
+		store.buildGroupCombo(combo.filter, combo.group)
+		if !store.index.Group.Has(combo.filter, combo.group) {
+			t.Fatalf("combination %s by %s is not built", GroupMaskString(combo.group), GroupMaskString(combo.filter))
+		}
+		if err := store.AddGroupCombo(combo.filter, combo.group); err == nil {
+			t.Errorf("combination %s by %s added twice", GroupMaskString(combo.group), GroupMaskString(combo.filter))
+		}
+	}
+	if got := len(store.GroupCombos()); got != len(combos) {
+		t.Errorf("got %d combinations, want %d", got, len(combos))
+	}
+
+	for _, test := range testGroupQueries {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	// account 2 moves to Берлин, becomes заняты and likes only Книги
+	rawAccount := &RawAccount{}
+	err := parser.DecodeAccount([]byte(`{"city": "Берлин", "status": "заняты", "interests": ["Книги"]}`), rawAccount, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Update(2, rawAccount, true); err != nil {
+		t.Fatal(err)
+	}
+	store.index.worker.Wait()
+
+	updated := []struct {
+		query string
+		want  string
+	}{
+		{"keys=city,status&order=-1&limit=3", `{"groups":[{"status":"заняты","city":"Берлин","count":2},{"status":"свободны","city":"Москва","count":1},{"status":"заняты","city":"Москва","count":1}]}`},
+		{"keys=interests&order=-1&limit=10", `{"groups":[{"interests":"Книги","count":3},{"interests":"Кино","count":3},{"interests":"Спорт","count":2},{"interests":"Музыка","count":1}]}`},
+		{"keys=sex&city=Москва&order=1&limit=10", `{"groups":[{"sex":"m","count":2}]}`},
+		{"keys=sex&city=Берлин&order=1&limit=10", `{"groups":[{"sex":"f","count":2}]}`},
+		{"keys=city&sex=f&status=заняты&order=1&limit=10", `{"groups":[{"city":"Берлин","count":2}]}`},
+		{"keys=city&sex=m&status=заняты&order=1&limit=10", `{"groups":[{"city":"Москва","count":1}]}`},
+	}
+	for _, test := range updated {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s after update:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, combo := range combos {
+		if err := store.DropGroupCombo(combo.filter, combo.group); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := store.DropGroupCombo(0, GroupCityMask|GroupStatusMask); err == nil {
+		t.Error("unknown combination dropped")
+	}
+	if got := len(store.GroupCombos()); got != 0 {
+		t.Errorf("got %d combinations after drop", got)
+	}
+
+	for _, test := range updated {
+		if got := groupJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s after drop:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestGroupComboBuildConcurrent(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts, func(store *Store) {
+		store.SetGroupCombos(map[GroupHash][]GroupHash{})
+	})
+	store.index.RunWorker()
+
+	// account 5 changes status while combination is built and ends
+	// with its own status, jobs of one update are done before the next
+	// one as workers may run batches in any order
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			status := "заняты"
+			if i%2 == 1 {
+				status = "свободны"
+			}
+			rawAccount := &RawAccount{}
+			err := parser.DecodeAccount([]byte(`{"status": "`+status+`"}`), rawAccount, true)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err = store.Update(5, rawAccount, true); err != nil {
+				t.Error(err)
+				return
+			}
+			store.index.worker.Wait()
+		}
+	}()
+	store.buildGroupCombo(0, GroupCityMask|GroupStatusMask)
+	<-done
+	store.index.worker.Wait()
+
+	query := "keys=city,status&order=1&limit=10&sort=key"
+	want := `{"groups":[{"status":"всё сложно","count":1},{"status":"заняты","city":"Берлин","count":1},{"status":"свободны","city":"Мадрид","count":1},{"status":"заняты","city":"Москва","count":1},{"status":"свободны","city":"Москва","count":2}]}`
+	if got := groupJSON(t, store, parser, dicts, query); got != want {
+		t.Errorf("%s:\ngot  %s\nwant %s", query, got, want)
+	}
+}
+
+func TestGroupLikes(t *testing.T) {
+	kept, parser, dicts := newTestStore(t, testAccounts+testRepeatedLikes, func(store *Store) {
+		groups, err := ParseGroupMasks("city;country;sex,status;interests")
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.SetGroupLikes(groups)
+	})
+	scanned, scanParser, scanDicts := newTestStore(t, testAccounts+testRepeatedLikes)
+	kept.index.RunWorker()
+	scanned.index.RunWorker()
+
+	// likers of 1 are 2, 3, 6 and 7, likers of 2 are 1 and 3,
+	// likers of 3 are 1 and 4 and liker of 4 is 7
+	tests := []struct {
+		query string
+		want  string
+		added string
+	}{
+		{
+			"keys=city&likes=1&order=-1&limit=10",
+			`{"groups":[{"city":"Москва","count":2},{"city":"Берлин","count":1},{"count":1}]}`,
+			`{"groups":[{"city":"Москва","count":2},{"city":"Мадрид","count":1},{"city":"Берлин","count":1},{"count":1}]}`,
+		},
+		{
+			"keys=country&likes=3&order=1&limit=10",
+			`{"groups":[{"count":1},{"country":"Росмаль","count":1}]}`,
+			`{"groups":[{"count":1},{"country":"Росмаль","count":1}]}`,
+		},
+		{
+			"keys=sex,status&likes=1&order=1&limit=10",
+			`{"groups":[{"sex":"f","status":"заняты","count":1},{"sex":"m","status":"заняты","count":1},{"sex":"f","status":"свободны","count":1},{"sex":"m","status":"свободны","count":1}]}`,
+			`{"groups":[{"sex":"f","status":"заняты","count":1},{"sex":"m","status":"заняты","count":1},{"sex":"m","status":"свободны","count":1},{"sex":"f","status":"свободны","count":2}]}`,
+		},
+		{
+			"keys=interests&likes=2&order=-1&limit=10",
+			`{"groups":[{"interests":"Кино","count":2},{"interests":"Спорт","count":1}]}`,
+			`{"groups":[{"interests":"Кино","count":2},{"interests":"Спорт","count":1}]}`,
+		},
+		{
+			"keys=interests&likes=4&order=1&limit=10",
+			`{"groups":[]}`,
+			`{"groups":[{"interests":"Музыка","count":1},{"interests":"Спорт","count":1}]}`,
+		},
+		{
+			"keys=city&likes=4&order=1&limit=10",
+			`{"groups":[{"count":1}]}`,
+			`{"groups":[{"count":1},{"city":"Москва","count":1}]}`,
+		},
+		// not kept, scanned by likes index
+		{
+			"keys=status&likes=1&order=1&limit=10",
+			`{"groups":[{"status":"заняты","count":2},{"status":"свободны","count":2}]}`,
+			`{"groups":[{"status":"заняты","count":2},{"status":"свободны","count":3}]}`,
+		},
+		{
+			"keys=city&likes=1&sex=m&order=1&limit=10",
+			`{"groups":[{"count":1},{"city":"Москва","count":1}]}`,
+			`{"groups":[{"count":1},{"city":"Москва","count":1}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, kept, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+		if got := groupJSON(t, scanned, scanParser, scanDicts, test.query); got != test.want {
+			t.Errorf("%s scanned:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	// liker is counted once however many times likes
+	for _, store := range []*Store{kept, scanned} {
+		for i := 0; i < 2; i++ {
+			likes := &Likes{likes: []Like{{Liker: 5, Likee: 1, Ts: 1540000000}, {Liker: 2, Likee: 4, Ts: 1540000000}}}
+			if err := store.AddLikes(likes, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store.index.worker.Wait()
+	}
+
+	for _, test := range tests {
+		if got := groupJSON(t, kept, parser, dicts, test.query); got != test.added {
+			t.Errorf("%s after likes:\ngot  %s\nwant %s", test.query, got, test.added)
+		}
+		if got := groupJSON(t, scanned, scanParser, scanDicts, test.query); got != test.added {
+			t.Errorf("%s scanned after likes:\ngot  %s\nwant %s", test.query, got, test.added)
+		}
+	}
+}
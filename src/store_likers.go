@@ -0,0 +1,33 @@
+package main
+
+import (
+	"sort"
+)
+
+type Liker struct {
+	Account *Account
+	Ts      uint32 // latest like
+}
+
+func (store *Store) Likers(account *Account, likers *Likers, buffer *LikersBuffer) {
+	it := NewLikersIterator(store.index.Likee.FindLikes(account.ID), likers.Since(), likers.Until())
+	for it.Cur().ID != 0 {
+		like := it.Cur()
+		if liker := store.get(like.ID); liker != nil {
+			buffer.likers = append(buffer.likers, Liker{Account: liker, Ts: like.Ts})
+		}
+		it.Next()
+	}
+
+	all := buffer.likers
+	orderAsc := likers.OrderAsc()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Ts != all[j].Ts {
+			return (all[i].Ts < all[j].Ts) == orderAsc
+		}
+		return (all[i].Account.ID < all[j].Account.ID) == orderAsc
+	})
+	if len(all) > likers.Limit() {
+		buffer.likers = all[:likers.Limit()]
+	}
+}
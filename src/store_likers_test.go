@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLikers(t *testing.T) {
+	store, _, _ := newTestStore(t, testAccounts+testRepeatedLikes)
+	store.index.RunWorker()
+
+	type likersTest struct {
+		id    ID
+		query string
+		want  IDS
+		ts    []uint32
+	}
+	tests := []likersTest{
+		// account 7 likes account 1 twice, the latest like is taken
+		{1, "limit=10", IDS{6, 3, 7, 2}, []uint32{1540000000, 1520000000, 1510000000, 1500000100}},
+		{1, "limit=10&order=1", IDS{2, 7, 3, 6}, []uint32{1500000100, 1510000000, 1520000000, 1540000000}},
+		{1, "limit=2", IDS{6, 3}, []uint32{1540000000, 1520000000}},
+		{1, "limit=10&since=1505000000", IDS{6, 3, 7}, []uint32{1540000000, 1520000000, 1510000000}},
+		// and the latest one before until
+		{1, "limit=10&until=1505000000", IDS{2, 7}, []uint32{1500000100, 1500000000}},
+		{1, "limit=10&since=1510000000&until=1520000000", IDS{3, 7}, []uint32{1520000000, 1510000000}},
+		{4, "limit=10", IDS{7}, []uint32{1500000000}},
+		{7, "limit=10", IDS{}, []uint32{}},
+	}
+
+	check := func(test likersTest) {
+		likers := NewLikers()
+		likers.Reset()
+		if err := likers.Parse(test.query); err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+		buffer := BorrowLikersBuffer()
+		defer buffer.Release()
+		store.Likers(store.Get(test.id), likers, buffer)
+
+		ids := make(IDS, len(buffer.likers))
+		ts := make([]uint32, len(buffer.likers))
+		for i, liker := range buffer.likers {
+			ids[i] = liker.Account.ID
+			ts[i] = liker.Ts
+		}
+		if !equalIDS(ids, test.want) {
+			t.Errorf("%d %s: got %v, want %v", test.id, test.query, ids, test.want)
+			return
+		}
+		for i := range ts {
+			if ts[i] != test.ts[i] {
+				t.Errorf("%d %s: got ts %v, want %v", test.id, test.query, ts, test.ts)
+				break
+			}
+		}
+	}
+	for _, test := range tests {
+		check(test)
+	}
+
+	// new like is returned with its time
+	likes := &Likes{likes: []Like{{Liker: 5, Likee: 7, Ts: 1545000000}, {Liker: 2, Likee: 7, Ts: 1541000000}}}
+	if err := store.AddLikes(likes, true); err != nil {
+		t.Fatal(err)
+	}
+	store.index.worker.Wait()
+	check(likersTest{7, "limit=10", IDS{5, 2}, []uint32{1545000000, 1541000000}})
+	check(likersTest{7, "limit=10&until=1541000000", IDS{2}, []uint32{1541000000}})
+
+	for _, query := range []string{"", "limit=x", "limit=1&order=0", "limit=1&since=x", "limit=1&since=2&until=1", "limit=1&cursor=x"} {
+		likers := NewLikers()
+		likers.Reset()
+		if err := likers.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
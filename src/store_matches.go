@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+)
+
+type Match struct {
+	Account *Account
+	Ts      uint32 // latest like in any direction
+}
+
+func (store *Store) Matches(account *Account, matches *Matches, buffer *MatchesBuffer) {
+	all := store.findMatches(account.ID, buffer.matches[:0])
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Ts != all[j].Ts {
+			return all[i].Ts > all[j].Ts
+		}
+		return all[i].Account.ID > all[j].Account.ID
+	})
+
+	start := sort.Search(len(all), func(i int) bool {
+		return matches.After(&all[i])
+	})
+	end := start + matches.Limit()
+	if end < len(all) {
+		buffer.next = true
+	} else {
+		end = len(all)
+	}
+	buffer.matches = all[:copy(all, all[start:end])]
+}
+
+// findMatches appends accounts which liked id and were liked by id.
+func (store *Store) findMatches(id ID, matches []Match) []Match {
+	likes := store.index.Liker.Find(id)
+	likers := store.index.Likee.Find(id)
+
+	// both are sorted by id descending, likes may repeat
+	i, j := 0, 0
+	for i < len(likes) && j < len(likers) {
+		if likes[i].ID > likers[j] {
+			i++
+			continue
+		}
+		if likes[i].ID < likers[j] {
+			j++
+			continue
+		}
+		likee := likes[i].ID
+		ts := uint32(0)
+		for i < len(likes) && likes[i].ID == likee {
+			if likes[i].Ts > ts {
+				ts = likes[i].Ts
+			}
+			i++
+		}
+		j++
+		if likee == id {
+			continue
+		}
+		if backTs := store.latestLike(likee, id); backTs > ts {
+			ts = backTs
+		}
+		account := store.get(likee)
+		if account == nil {
+			continue
+		}
+		matches = append(matches, Match{Account: account, Ts: ts})
+	}
+	return matches
+}
+
+// latestLike returns timestamp of the latest like of likee by liker.
+func (store *Store) latestLike(liker ID, likee ID) uint32 {
+	likes := store.index.Liker.Find(liker)
+	i := sort.Search(len(likes), func(i int) bool {
+		return likes[i].ID <= likee
+	})
+	ts := uint32(0)
+	for ; i < len(likes) && likes[i].ID == likee; i++ {
+		if likes[i].Ts > ts {
+			ts = likes[i].Ts
+		}
+	}
+	return ts
+}
+
+type MatchesStats struct {
+	Pairs    int // mutual pairs, every pair is counted once
+	Accounts int // accounts having at least one match
+}
+
+// MatchesStats counts matches over all accounts, it takes a while.
+func (store *Store) MatchesStats() MatchesStats {
+	var (
+		stats   MatchesStats
+		matches []Match
+	)
+	store.Iterate(func(account *Account) bool {
+		matches = store.findMatches(account.ID, matches[:0])
+		if len(matches) > 0 {
+			stats.Accounts++
+			stats.Pairs += len(matches)
+		}
+		return true
+	})
+	stats.Pairs /= 2
+	return stats
+}
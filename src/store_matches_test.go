@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	store, parser, _ := newTestStore(t, testAccounts+testRepeatedLikes)
+	store.index.RunWorker()
+
+	// account 4 matches at the same time as account 3, account 7 liked
+	// account 1 twice
+	likes := &Likes{likes: []Like{
+		{Liker: 1, Likee: 6, Ts: 1530000000},
+		{Liker: 1, Likee: 4, Ts: 1510000000},
+		{Liker: 4, Likee: 1, Ts: 1520000000},
+		{Liker: 1, Likee: 7, Ts: 1505000000},
+		{Liker: 5, Likee: 6, Ts: 1545000000},
+	}}
+	if err := store.AddLikes(likes, true); err != nil {
+		t.Fatal(err)
+	}
+	store.index.worker.Wait()
+
+	tests := []struct {
+		id    ID
+		query string
+		want  IDS
+		ts    []uint32
+		next  string
+	}{
+		{1, "limit=10", IDS{6, 4, 3, 7, 2}, []uint32{1540000000, 1520000000, 1520000000, 1510000000, 1500000100}, ""},
+		{1, "limit=2", IDS{6, 4}, []uint32{1540000000, 1520000000}, EncodeMatchesCursor(1520000000, 4)},
+		{1, "limit=2&cursor=" + EncodeMatchesCursor(1520000000, 4), IDS{3, 7}, []uint32{1520000000, 1510000000}, EncodeMatchesCursor(1510000000, 7)},
+		{1, "limit=2&cursor=" + EncodeMatchesCursor(1510000000, 7), IDS{2}, []uint32{1500000100}, ""},
+		// cursor of match changed meanwhile still points into the list
+		{1, "limit=10&cursor=" + EncodeMatchesCursor(1515000000, 100), IDS{7, 2}, []uint32{1510000000, 1500000100}, ""},
+		{4, "limit=10", IDS{1}, []uint32{1520000000}, ""},
+		// account 6 likes account 5 which likes it back
+		{6, "limit=10", IDS{5, 1}, []uint32{1545000000, 1540000000}, ""},
+		{5, "limit=10", IDS{6}, []uint32{1545000000}, ""},
+		{3, "limit=1", IDS{1}, []uint32{1520000000}, ""},
+	}
+
+	for _, test := range tests {
+		matches := NewMatches()
+		if err := matches.Parse(test.query); err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+		buffer := BorrowMatchesBuffer()
+		store.Matches(store.Get(test.id), matches, buffer)
+
+		ids := make(IDS, len(buffer.matches))
+		ts := make([]uint32, len(buffer.matches))
+		for i, match := range buffer.matches {
+			ids[i] = match.Account.ID
+			ts[i] = match.Ts
+		}
+		if !equalIDS(ids, test.want) {
+			t.Errorf("%d %s: got %v, want %v", test.id, test.query, ids, test.want)
+		}
+		for i := range ts {
+			if i < len(test.ts) && ts[i] != test.ts[i] {
+				t.Errorf("%d %s: got ts %v, want %v", test.id, test.query, ts, test.ts)
+				break
+			}
+		}
+
+		var body bytes.Buffer
+		parser.EncodeMatches(buffer, &body, matches)
+		next := ""
+		if buffer.next {
+			last := &buffer.matches[len(buffer.matches)-1]
+			next = EncodeMatchesCursor(last.Ts, last.Account.ID)
+			if !bytes.Contains(body.Bytes(), []byte(`"next":"`+next+`"`)) {
+				t.Errorf("%d %s: no next cursor in %s", test.id, test.query, body.String())
+			}
+		}
+		if next != test.next {
+			t.Errorf("%d %s: next %q, want %q", test.id, test.query, next, test.next)
+		}
+		buffer.Release()
+	}
+
+	stats := store.MatchesStats()
+	if want := (MatchesStats{Pairs: 6, Accounts: 7}); stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+)
+
+func (store *Store) Pivot(pivot *Pivot, buffer *PivotBuffer) {
+	group := pivot.Group()
+	buffer.rowKey = pivot.RowKey()
+	buffer.colKey = pivot.ColKey()
+	if group.ExpectEmpty() {
+		return
+	}
+
+	groups := BorrowGroupsBuffer()
+	defer groups.Release()
+
+	// scan clears filter fields it is driven by, totals need them all
+	filter := group.Filter
+	store.Group(group, groups)
+
+	// totals by headers over all groups, truncated ones too
+	rowIndex := make(map[GroupHash]int)
+	colIndex := make(map[GroupHash]int)
+	for _, entry := range groups.groups {
+		rowHash := entry.Hash & pivot.rowMask
+		colHash := entry.Hash & pivot.colMask
+		if i, ok := rowIndex[rowHash]; ok {
+			buffer.rows[i].Count += entry.Count
+		} else {
+			rowIndex[rowHash] = len(buffer.rows)
+			buffer.rows = append(buffer.rows, GroupEntry{Hash: rowHash, Count: entry.Count})
+		}
+		if i, ok := colIndex[colHash]; ok {
+			buffer.cols[i].Count += entry.Count
+		} else {
+			colIndex[colHash] = len(buffer.cols)
+			buffer.cols = append(buffer.cols, GroupEntry{Hash: colHash, Count: entry.Count})
+		}
+		buffer.total += entry.Count
+	}
+	// account is counted once per its interest, so totals of the other key
+	// and the grand total are taken from group by that key only
+	if pivot.colMask == GroupInterestsMask {
+		buffer.total = store.pivotTotals(group, filter, pivot.RowKey(), pivot.rowMask, buffer.rows)
+	} else if pivot.rowMask == GroupInterestsMask {
+		buffer.total = store.pivotTotals(group, filter, pivot.ColKey(), pivot.colMask, buffer.cols)
+	}
+
+	buffer.rows = store.pivotHeaders(group, pivot.RowKey(), buffer.rows, pivot.RowsLimit())
+	buffer.cols = store.pivotHeaders(group, pivot.ColKey(), buffer.cols, pivot.ColsLimit())
+
+	rowIndex = make(map[GroupHash]int, len(buffer.rows))
+	for i := range buffer.rows {
+		rowIndex[buffer.rows[i].Hash] = i
+	}
+	colIndex = make(map[GroupHash]int, len(buffer.cols))
+	for i := range buffer.cols {
+		colIndex[buffer.cols[i].Hash] = i
+	}
+
+	n := len(buffer.rows) * len(buffer.cols)
+	for i := 0; i < n; i++ {
+		buffer.cells = append(buffer.cells, 0)
+	}
+	for _, entry := range groups.groups {
+		row, okRow := rowIndex[entry.Hash&pivot.rowMask]
+		col, okCol := colIndex[entry.Hash&pivot.colMask]
+		if okRow && okCol {
+			buffer.cells[row*len(buffer.cols)+col] += entry.Count
+		}
+	}
+}
+
+// pivotTotals sets totals of headers by key counting every account matching
+// group filter once and returns count of such accounts.
+func (store *Store) pivotTotals(group *Group, filter GroupFilter, key GroupKey, mask GroupHash, headers []GroupEntry) uint32 {
+	single := *group
+	single.Filter = filter
+	single.Keys = []GroupKey{key}
+	single.KeysMask = mask
+
+	groups := BorrowGroupsBuffer()
+	defer groups.Release()
+
+	store.Group(&single, groups)
+
+	totals := make(map[GroupHash]uint32, len(groups.groups))
+	total := uint32(0)
+	for _, entry := range groups.groups {
+		totals[entry.Hash&mask] = entry.Count
+		total += entry.Count
+	}
+	for i := range headers {
+		headers[i].Count = totals[headers[i].Hash]
+	}
+	return total
+}
+
+// pivotHeaders orders headers by total descending, then by key,
+// and keeps top limit of them.
+func (store *Store) pivotHeaders(group *Group, key GroupKey, headers []GroupEntry, limit int) []GroupEntry {
+	sort.Slice(headers, func(i, j int) bool {
+		if headers[i].Count != headers[j].Count {
+			return headers[i].Count > headers[j].Count
+		}
+		return group.compareKey(key, &headers[i], &headers[j]) < 0
+	})
+	if limit > 0 && len(headers) > limit {
+		headers = headers[:limit]
+	}
+	return headers
+}
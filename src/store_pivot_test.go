@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// pivotJSON runs pivot by query and returns response body.
+func pivotJSON(t *testing.T, store *Store, parser *Parser, dicts *Dicts, query string) string {
+	pivot := BorrowPivot(parser, dicts)
+	defer pivot.Release()
+	err := pivot.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	pivotBuffer := BorrowPivotBuffer()
+	defer pivotBuffer.Release()
+	store.Pivot(pivot, pivotBuffer)
+
+	var buffer bytes.Buffer
+	parser.EncodePivot(pivotBuffer, &buffer)
+	return buffer.String()
+}
+
+func TestPivot(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"rows=sex&cols=status", `{"rows":["f","m"],"cols":["свободны","заняты","всё сложно"],"cells":[[2,1,0],[1,1,1]],"row_totals":[3,3],"col_totals":[3,2,1],"total":6}`},
+		{"rows=country&cols=sex&cols_limit=1", `{"rows":["Росмаль",null,"Германия","Испания"],"cols":["f"],"cells":[[1],[0],[1],[1]],"row_totals":[3,1,1,1],"col_totals":[3],"total":6}`},
+		{"rows=city&cols=sex&rows_limit=2&status=свободны", `{"rows":["Москва","Мадрид"],"cols":["f","m"],"cells":[[1,1],[1,0]],"row_totals":[2,1],"col_totals":[2,1],"total":3}`},
+		// accounts are counted once in totals of the other key, account 5 has
+		// no interests
+		{"rows=sex&cols=interests", `{"rows":["f","m"],"cols":["Кино","Спорт","Книги","Музыка"],"cells":[[1,1,0,1],[2,2,2,1]],"row_totals":[3,3],"col_totals":[3,3,2,2],"total":6}`},
+		{"rows=interests&cols=joined&cols_limit=2", `{"rows":["Кино","Спорт","Книги","Музыка"],"cols":[2015,2012],"cells":[[1,0],[1,1],[0,1],[0,1]],"row_totals":[3,3,2,2],"col_totals":[2,1],"total":6}`},
+		// likers of account 1 are 2, 3 and 6, totals are sums of cells
+		// unless key is interests
+		{"rows=sex&cols=status&likes=1", `{"rows":["f","m"],"cols":["заняты","свободны"],"cells":[[1,1],[1,0]],"row_totals":[2,1],"col_totals":[2,1],"total":3}`},
+		{"rows=sex&cols=interests&likes=1", `{"rows":["f","m"],"cols":["Кино","Книги","Музыка","Спорт"],"cells":[[1,0,1,1],[1,1,0,0]],"row_totals":[2,1],"col_totals":[2,1,1,1],"total":3}`},
+		{"rows=sex&cols=status&country=Unknown", `{"rows":[],"cols":[],"cells":[],"row_totals":[],"col_totals":[],"total":0}`},
+	}
+
+	for _, test := range tests {
+		if got := pivotJSON(t, store, parser, dicts, test.query); got != test.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"rows=sex", "rows=sex&cols=sex", "rows=sex&cols=status&keys=city", "rows=sex&cols=status&limit=1", "rows=sex&cols=status&rows_limit=0", "rows=sex&cols=unknown"} {
+		pivot := BorrowPivot(parser, dicts)
+		if err := pivot.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		pivot.Release()
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Candidate index is intersected with the cheapest one while its
+// estimated size is not bigger than planIntersectFactor times of it.
+const planIntersectFactor = 2
+
+type FilterPlanStep struct {
+	Index    string
+	Estimate int
+}
+
+type FilterPlan struct {
+	Steps    []FilterPlanStep
+	Estimate int
+	Scanned  int
+}
+
+func (plan *FilterPlan) Reset() {
+	plan.Steps = plan.Steps[:0]
+	plan.Estimate = 0
+	plan.Scanned = 0
+}
+
+type filterCandidate struct {
+	index    string
+	estimate int
+	iter     func() IndexIterator // consumes filter param
+}
+
+func (store *Store) findIds(filter *Filter) IndexIterator {
+	it := store.findDriverIds(filter)
+	plan := &filter.plan
+
+	// Excluded buckets are subtracted from the driver while they are not
+	// bigger than it, otherwise they are rechecked in filterAccount.
+	excludes := make([]IndexIterator, 0, 4)
+	for _, exclusion := range store.filterExclusions(filter) {
+		if exclusion.estimate > plan.Estimate {
+			continue
+		}
+		plan.Steps = append(plan.Steps, FilterPlanStep{Index: exclusion.index, Estimate: exclusion.estimate})
+		excludes = append(excludes, exclusion.iter())
+	}
+
+	if len(excludes) == 0 {
+		return it
+	}
+	return NewDifferenceIndexIterator(it, excludes...)
+}
+
+func (store *Store) findDriverIds(filter *Filter) IndexIterator {
+	plan := &filter.plan
+	candidates := store.filterCandidates(filter)
+
+	if len(candidates) == 0 {
+		plan.Estimate = store.index.ID.Len()
+		plan.Steps = append(plan.Steps, FilterPlanStep{Index: "id", Estimate: plan.Estimate})
+		return store.index.ID.Iter()
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].estimate < candidates[j].estimate
+	})
+
+	driver := candidates[0]
+	plan.Estimate = driver.estimate
+
+	iters := make([]IndexIterator, 0, len(candidates))
+	for i, candidate := range candidates {
+		if i > 0 && candidate.estimate > driver.estimate*planIntersectFactor {
+			break
+		}
+		plan.Steps = append(plan.Steps, FilterPlanStep{Index: candidate.index, Estimate: candidate.estimate})
+		iters = append(iters, candidate.iter())
+	}
+
+	if len(iters) == 1 {
+		return iters[0]
+	}
+	return NewIntersectIndexIterator(iters...)
+}
+
+func (store *Store) filterCandidates(filter *Filter) []filterCandidate {
+	candidates := make([]filterCandidate, 0, 8)
+
+	if filter.PhoneEq != "" {
+		if store.uniquePhone {
+			// phones map is exact only while phones are unique
+			id, ok := store.FindPhone(filter.PhoneEq)
+			estimate := 0
+			if ok {
+				estimate = 1
+			}
+			candidates = append(candidates, filterCandidate{"phone", estimate, func() IndexIterator {
+				if !ok {
+					return EmptyIndexIterator
+				}
+				return NewIndexIDIterator(IDS{id})
+			}})
+		} else {
+			candidates = append(candidates, filterCandidate{"phone_eq", store.index.Phone.Count(filter.PhoneEq), func() IndexIterator {
+				phone := filter.PhoneEq
+				filter.PhoneEq = ""
+				return store.index.Phone.Iter(phone)
+			}})
+		}
+	}
+	if filter.PhoneStarts != "" {
+		candidates = append(candidates, filterCandidate{"phone_starts", store.index.Phone.CountPrefix(filter.PhoneStarts), func() IndexIterator {
+			prefix := filter.PhoneStarts
+			filter.PhoneStarts = ""
+			return store.index.Phone.IterPrefix(prefix)
+		}})
+	}
+	if len(filter.LikesContains) > 0 {
+		estimate := -1
+		for _, likee := range filter.LikesContains {
+			count := store.index.Likee.Count(ID(likee))
+			if estimate == -1 || count < estimate {
+				estimate = count
+			}
+		}
+		candidates = append(candidates, filterCandidate{"likes_contains", estimate, func() IndexIterator {
+			likersAll := make([]IndexIterator, len(filter.LikesContains))
+			for i, likee := range filter.LikesContains {
+				likersAll[i] = store.index.Likee.Iter(ID(likee))
+			}
+			filter.LikesContains = filter.LikesContains[:0]
+			if len(likersAll) == 1 {
+				return likersAll[0]
+			}
+			return NewIntersectIndexIterator(likersAll...)
+		}})
+	}
+	if len(filter.LikesAny) > 0 {
+		estimate := 0
+		for _, likee := range filter.LikesAny {
+			estimate += store.index.Likee.Count(ID(likee))
+		}
+		candidates = append(candidates, filterCandidate{"likes_any", estimate, func() IndexIterator {
+			likersAny := make([]IndexIterator, len(filter.LikesAny))
+			for i, likee := range filter.LikesAny {
+				likersAny[i] = store.index.Likee.Iter(ID(likee))
+			}
+			filter.LikesAny = filter.LikesAny[:0]
+			return NewUnionIndexIterator(likersAny...)
+		}})
+	}
+	if filter.CityEq != 0 {
+		candidates = append(candidates, filterCandidate{"city_eq", store.index.City.Count(filter.CityEq), func() IndexIterator {
+			city := filter.CityEq
+			filter.CityEq = 0
+			return store.index.City.Iter(city)
+		}})
+	}
+	if filter.BirthYear != 0 {
+		candidates = append(candidates, filterCandidate{"birth_year", store.index.BirthYear.Count(filter.BirthYear), func() IndexIterator {
+			birthYear := filter.BirthYear
+			filter.BirthYear = 0
+			return store.index.BirthYear.Iter(birthYear)
+		}})
+	}
+	if filter.Age() {
+		gte, lte := Year(0), Year(math.MaxUint16)
+		if filter.ageBirthGte != math.MinInt64 {
+			gte = timestampToYear(filter.ageBirthGte)
+		}
+		if filter.ageBirthLte != math.MaxInt64 {
+			lte = timestampToYear(filter.ageBirthLte)
+		}
+		// year buckets are wider than the range, birth is rechecked in filterAccount
+		candidates = append(candidates, filterCandidate{"age", store.index.BirthYear.CountRange(gte, lte), func() IndexIterator {
+			return store.index.BirthYear.IterRange(gte, lte)
+		}})
+	}
+	if filter.PhoneCode != 0 {
+		candidates = append(candidates, filterCandidate{"phone_code", store.index.PhoneCode.Count(filter.PhoneCode), func() IndexIterator {
+			phoneCode := filter.PhoneCode
+			filter.PhoneCode = 0
+			return store.index.PhoneCode.Iter(phoneCode)
+		}})
+	}
+	if len(filter.InterestsContains) > 0 {
+		estimate := -1
+		for _, interest := range filter.InterestsContains {
+			count := store.index.Interest.Count(interest)
+			if estimate == -1 || count < estimate {
+				estimate = count
+			}
+		}
+		candidates = append(candidates, filterCandidate{"interests_contains", estimate, func() IndexIterator {
+			interestsAll := make([]IndexIterator, len(filter.InterestsContains))
+			for i, interest := range filter.InterestsContains {
+				interestsAll[i] = store.index.Interest.Iter(interest)
+			}
+			filter.InterestsContains = filter.InterestsContains[:0]
+			if len(interestsAll) == 1 {
+				return interestsAll[0]
+			}
+			return NewIntersectIndexIterator(interestsAll...)
+		}})
+	}
+	if len(filter.InterestsAny) > 0 {
+		estimate := 0
+		for _, interest := range filter.InterestsAny {
+			estimate += store.index.Interest.Count(interest)
+		}
+		candidates = append(candidates, filterCandidate{"interests_any", estimate, func() IndexIterator {
+			interestsAny := make([]IndexIterator, len(filter.InterestsAny))
+			for i, interest := range filter.InterestsAny {
+				interestsAny[i] = store.index.Interest.Iter(interest)
+			}
+			filter.InterestsAny = filter.InterestsAny[:0]
+			return NewUnionIndexIterator(interestsAny...)
+		}})
+	}
+	if len(filter.CityAny) > 0 {
+		estimate := 0
+		for _, city := range filter.CityAny {
+			estimate += store.index.City.Count(city)
+		}
+		candidates = append(candidates, filterCandidate{"city_any", estimate, func() IndexIterator {
+			citiesAny := make([]IndexIterator, len(filter.CityAny))
+			for i, city := range filter.CityAny {
+				citiesAny[i] = store.index.City.Iter(city)
+			}
+			filter.CityAny = filter.CityAny[:0]
+			return NewUnionIndexIterator(citiesAny...)
+		}})
+	}
+	if filter.FnameEq != 0 {
+		candidates = append(candidates, filterCandidate{"fname_eq", store.index.Fname.Count(filter.FnameEq), func() IndexIterator {
+			fname := filter.FnameEq
+			filter.FnameEq = 0
+			return store.index.Fname.Iter(fname)
+		}})
+	}
+	if len(filter.FnameAny) > 0 {
+		estimate := 0
+		for _, fname := range filter.FnameAny {
+			estimate += store.index.Fname.Count(fname)
+		}
+		candidates = append(candidates, filterCandidate{"fname_any", estimate, func() IndexIterator {
+			fnamesAny := make([]IndexIterator, len(filter.FnameAny))
+			for i, fname := range filter.FnameAny {
+				fnamesAny[i] = store.index.Fname.Iter(fname)
+			}
+			filter.FnameAny = filter.FnameAny[:0]
+			return NewUnionIndexIterator(fnamesAny...)
+		}})
+	}
+	if len(filter.CityLikeAny) > 0 {
+		estimate := 0
+		for _, city := range filter.CityLikeAny {
+			estimate += store.index.City.Count(city)
+		}
+		candidates = append(candidates, filterCandidate{"city_like", estimate, func() IndexIterator {
+			citiesLike := make([]IndexIterator, len(filter.CityLikeAny))
+			for i, city := range filter.CityLikeAny {
+				citiesLike[i] = store.index.City.Iter(city)
+			}
+			filter.CityLikeAny = filter.CityLikeAny[:0]
+			return NewUnionIndexIterator(citiesLike...)
+		}})
+	}
+	if len(filter.FnameLikeAny) > 0 {
+		estimate := 0
+		for _, fname := range filter.FnameLikeAny {
+			estimate += store.index.Fname.Count(fname)
+		}
+		candidates = append(candidates, filterCandidate{"fname_like", estimate, func() IndexIterator {
+			fnamesLike := make([]IndexIterator, len(filter.FnameLikeAny))
+			for i, fname := range filter.FnameLikeAny {
+				fnamesLike[i] = store.index.Fname.Iter(fname)
+			}
+			filter.FnameLikeAny = filter.FnameLikeAny[:0]
+			return NewUnionIndexIterator(fnamesLike...)
+		}})
+	}
+	if filter.CityNullSet && filter.CityNull {
+		candidates = append(candidates, filterCandidate{"city_null", store.index.City.Count(0), func() IndexIterator {
+			filter.CityNullSet = false
+			return store.index.City.Iter(0)
+		}})
+	}
+	if filter.CountryEq != 0 {
+		candidates = append(candidates, filterCandidate{"country_eq", store.index.Country.Count(filter.CountryEq), func() IndexIterator {
+			country := filter.CountryEq
+			filter.CountryEq = 0
+			return store.index.Country.Iter(country)
+		}})
+	}
+	if len(filter.CountryAny) > 0 {
+		estimate := 0
+		for _, country := range filter.CountryAny {
+			estimate += store.index.Country.Count(country)
+		}
+		candidates = append(candidates, filterCandidate{"country_any", estimate, func() IndexIterator {
+			countriesAny := make([]IndexIterator, len(filter.CountryAny))
+			for i, country := range filter.CountryAny {
+				countriesAny[i] = store.index.Country.Iter(country)
+			}
+			filter.CountryAny = filter.CountryAny[:0]
+			return NewUnionIndexIterator(countriesAny...)
+		}})
+	}
+	if filter.CountryNullSet && filter.CountryNull {
+		candidates = append(candidates, filterCandidate{"country_null", store.index.Country.Count(0), func() IndexIterator {
+			filter.CountryNullSet = false
+			return store.index.Country.Iter(0)
+		}})
+	}
+	if filter.SexEq != 0 {
+		candidates = append(candidates, filterCandidate{"sex_eq", store.index.Sex.Count(filter.SexEq), func() IndexIterator {
+			sex := filter.SexEq
+			filter.SexEq = 0
+			return store.index.Sex.Iter(sex)
+		}})
+	}
+	if filter.StatusEq != 0 {
+		candidates = append(candidates, filterCandidate{"status_eq", store.index.Status.Count(filter.StatusEq), func() IndexIterator {
+			status := filter.StatusEq
+			filter.StatusEq = 0
+			return store.index.Status.Iter(status)
+		}})
+	}
+	if len(filter.StatusAny) > 0 {
+		estimate := 0
+		for _, status := range filter.StatusAny {
+			estimate += store.index.Status.Count(status)
+		}
+		candidates = append(candidates, filterCandidate{"status_any", estimate, func() IndexIterator {
+			statusesAny := make([]IndexIterator, len(filter.StatusAny))
+			for i, status := range filter.StatusAny {
+				statusesAny[i] = store.index.Status.Iter(status)
+			}
+			filter.StatusAny = filter.StatusAny[:0]
+			return NewUnionIndexIterator(statusesAny...)
+		}})
+	}
+	if filter.Query != nil {
+		if estimate, ok := store.queryEstimate(filter.Query); ok {
+			candidates = append(candidates, filterCandidate{"q", estimate, func() IndexIterator {
+				it, exact := store.queryIter(filter.Query)
+				if exact {
+					filter.Query = nil
+				}
+				return it
+			}})
+		}
+	}
+
+	return candidates
+}
+
+// filterExclusions returns buckets of ids which cannot match the filter,
+// estimate is the size of excluded bucket.
+func (store *Store) filterExclusions(filter *Filter) []filterCandidate {
+	exclusions := make([]filterCandidate, 0, 4)
+
+	if filter.SexNeq != 0 {
+		exclusions = append(exclusions, filterCandidate{"sex_neq", store.index.Sex.Count(filter.SexNeq), func() IndexIterator {
+			sex := filter.SexNeq
+			filter.SexNeq = 0
+			return store.index.Sex.Iter(sex)
+		}})
+	}
+	if filter.StatusNeq != 0 {
+		exclusions = append(exclusions, filterCandidate{"status_neq", store.index.Status.Count(filter.StatusNeq), func() IndexIterator {
+			status := filter.StatusNeq
+			filter.StatusNeq = 0
+			return store.index.Status.Iter(status)
+		}})
+	}
+	if len(filter.FnameNany) > 0 {
+		estimate := 0
+		for _, fname := range filter.FnameNany {
+			estimate += store.index.Fname.Count(fname)
+		}
+		exclusions = append(exclusions, filterCandidate{"fname_nany", estimate, func() IndexIterator {
+			fnamesNany := make([]IndexIterator, len(filter.FnameNany))
+			for i, fname := range filter.FnameNany {
+				fnamesNany[i] = store.index.Fname.Iter(fname)
+			}
+			filter.FnameNany = filter.FnameNany[:0]
+			return NewUnionIndexIterator(fnamesNany...)
+		}})
+	}
+	if len(filter.PhoneCodeNany) > 0 {
+		estimate := 0
+		for _, phoneCode := range filter.PhoneCodeNany {
+			// accounts without phone are never excluded,
+			// so phone_code=0 bucket is not usable
+			if phoneCode == 0 {
+				estimate = -1
+				break
+			}
+			estimate += store.index.PhoneCode.Count(phoneCode)
+		}
+		if estimate != -1 {
+			exclusions = append(exclusions, filterCandidate{"phone_code_nany", estimate, func() IndexIterator {
+				phoneCodesNany := make([]IndexIterator, len(filter.PhoneCodeNany))
+				for i, phoneCode := range filter.PhoneCodeNany {
+					phoneCodesNany[i] = store.index.PhoneCode.Iter(phoneCode)
+				}
+				filter.PhoneCodeNany = filter.PhoneCodeNany[:0]
+				return NewUnionIndexIterator(phoneCodesNany...)
+			}})
+		}
+	}
+	if len(filter.CountryNany) > 0 {
+		estimate := 0
+		for _, country := range filter.CountryNany {
+			estimate += store.index.Country.Count(country)
+		}
+		exclusions = append(exclusions, filterCandidate{"country_nany", estimate, func() IndexIterator {
+			countriesNany := make([]IndexIterator, len(filter.CountryNany))
+			for i, country := range filter.CountryNany {
+				countriesNany[i] = store.index.Country.Iter(country)
+			}
+			filter.CountryNany = filter.CountryNany[:0]
+			return NewUnionIndexIterator(countriesNany...)
+		}})
+	}
+	if len(filter.CityNany) > 0 {
+		estimate := 0
+		for _, city := range filter.CityNany {
+			estimate += store.index.City.Count(city)
+		}
+		exclusions = append(exclusions, filterCandidate{"city_nany", estimate, func() IndexIterator {
+			citiesNany := make([]IndexIterator, len(filter.CityNany))
+			for i, city := range filter.CityNany {
+				citiesNany[i] = store.index.City.Iter(city)
+			}
+			filter.CityNany = filter.CityNany[:0]
+			return NewUnionIndexIterator(citiesNany...)
+		}})
+	}
+	if len(filter.InterestsNone) > 0 {
+		estimate := 0
+		for _, interest := range filter.InterestsNone {
+			estimate += store.index.Interest.Count(interest)
+		}
+		exclusions = append(exclusions, filterCandidate{"interests_none", estimate, func() IndexIterator {
+			interestsNone := make([]IndexIterator, len(filter.InterestsNone))
+			for i, interest := range filter.InterestsNone {
+				interestsNone[i] = store.index.Interest.Iter(interest)
+			}
+			filter.InterestsNone = filter.InterestsNone[:0]
+			return NewUnionIndexIterator(interestsNone...)
+		}})
+	}
+
+	return exclusions
+}
+
+// queryEstimate returns upper bound of ids count returned by queryIter,
+// false when node cannot be served by indexes.
+func (store *Store) queryEstimate(node *QueryNode) (int, bool) {
+	switch node.Op {
+	case QueryAnd:
+		estimate := -1
+		for _, child := range node.Children {
+			count, ok := store.queryEstimate(child)
+			if ok && (estimate == -1 || count < estimate) {
+				estimate = count
+			}
+		}
+		return estimate, estimate != -1
+	case QueryOr:
+		estimate := 0
+		for _, child := range node.Children {
+			count, ok := store.queryEstimate(child)
+			if !ok {
+				return 0, false
+			}
+			estimate += count
+		}
+		return estimate, true
+	case QueryNot:
+		if !store.queryExact(node.Children[0]) {
+			return 0, false
+		}
+		return store.index.ID.Len(), true
+	}
+
+	if node.Empty {
+		return 0, true
+	}
+
+	switch node.Field {
+	case QuerySex:
+		return store.index.Sex.Count(byte(node.Value)), true
+	case QueryStatus:
+		return store.index.Status.Count(byte(node.Value)), true
+	case QueryFname:
+		return store.index.Fname.Count(Fname(node.Value)), true
+	case QueryPhoneCode:
+		if node.Null {
+			return 0, false
+		}
+		return store.index.PhoneCode.Count(uint16(node.Value)), true
+	case QueryCountry:
+		return store.index.Country.Count(Country(node.Value)), true
+	case QueryCity:
+		return store.index.City.Count(City(node.Value)), true
+	case QueryBirthYear:
+		return store.index.BirthYear.Count(Year(node.Value)), true
+	case QueryInterests:
+		return store.index.Interest.Count(Interest(node.Value)), true
+	case QueryLikes:
+		return store.index.Likee.Count(ID(node.Value)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFilterPlan(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		params   url.Values
+		steps    string
+		estimate int
+		want     IDS
+	}{
+		// no indexed param, all ids are scanned
+		{url.Values{"email_domain": {"gmail.com"}}, "id", 6, IDS{5, 2}},
+		{url.Values{"status_eq": {"заняты"}}, "status_eq", 2, IDS{6, 3}},
+		// equal estimates are both intersected
+		{url.Values{"city_eq": {"Москва"}, "sex_eq": {"f"}}, "city_eq,sex_eq", 3, IDS{2}},
+		// sex is more than twice bigger than country
+		{url.Values{"country_eq": {"Германия"}, "sex_eq": {"f"}}, "country_eq", 1, IDS{3}},
+		{url.Values{"interests_contains": {"Спорт,Музыка"}, "sex_eq": {"f"}}, "interests_contains,sex_eq", 2, IDS{2}},
+		{url.Values{"likes_contains": {"1"}, "sex_eq": {"m"}}, "likes_contains,sex_eq", 3, IDS{6}},
+		// excluded bucket is not bigger than driver
+		{url.Values{"sex_eq": {"m"}, "status_neq": {"заняты"}}, "sex_eq,status_neq", 3, IDS{4, 1}},
+		// excluded bucket is bigger than driver, so it is rechecked
+		{url.Values{"country_eq": {"Германия"}, "status_neq": {"свободны"}}, "country_eq", 1, IDS{3}},
+		// and is estimated by its smallest child
+		{url.Values{"q": {"city=Москва AND sex=m"}}, "q", 3, IDS{6, 1}},
+	}
+
+	for _, test := range tests {
+		filter := NewFilter(parser, dicts)
+		filter.Reset()
+		params := url.Values{"limit": {"10"}}
+		for param, values := range test.params {
+			params[param] = values
+		}
+		err := filter.Parse(params.Encode())
+		if err != nil {
+			t.Fatalf("%s: %v", params.Encode(), err)
+		}
+		accounts := make(AccountsBuffer, 0)
+		store.Filter(filter, &accounts)
+
+		ids := make(IDS, len(accounts))
+		for i, account := range accounts {
+			ids[i] = account.ID
+		}
+		if !equalIDS(ids, test.want) {
+			t.Errorf("%s: got %v, want %v", params.Encode(), ids, test.want)
+		}
+
+		plan := filter.Plan()
+		steps := make([]string, len(plan.Steps))
+		for i, step := range plan.Steps {
+			steps[i] = step.Index
+		}
+		if got := strings.Join(steps, ","); got != test.steps {
+			t.Errorf("%s: steps %s, want %s", params.Encode(), got, test.steps)
+		}
+		if plan.Estimate != test.estimate {
+			t.Errorf("%s: estimate %d, want %d", params.Encode(), plan.Estimate, test.estimate)
+		}
+	}
+}
+
+func TestFilterCountPlan(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		query   string
+		count   int
+		steps   string
+		scanned int
+	}{
+		// answered by index size
+		{"count=1&sex_eq=m", 3, "count", 0},
+		{"count=1&sex_eq=f&city_eq=Москва", 1, "city_eq,sex_eq", 1},
+		{"count=1&sex_eq=m&email_domain=mail.ru", 2, "sex_eq", 3},
+	}
+
+	for _, test := range tests {
+		filter := NewFilter(parser, dicts)
+		filter.Reset()
+		err := filter.Parse(test.query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+		if got := store.FilterCount(filter); got != test.count {
+			t.Errorf("%s: count %d, want %d", test.query, got, test.count)
+		}
+
+		plan := filter.Plan()
+		steps := make([]string, len(plan.Steps))
+		for i, step := range plan.Steps {
+			steps[i] = step.Index
+		}
+		if got := strings.Join(steps, ","); got != test.steps {
+			t.Errorf("%s: steps %s, want %s", test.query, got, test.steps)
+		}
+		if plan.Scanned != test.scanned {
+			t.Errorf("%s: scanned %d, want %d", test.query, plan.Scanned, test.scanned)
+		}
+	}
+}
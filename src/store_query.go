@@ -0,0 +1,191 @@
+package main
+
+// queryIter returns iterator over ids matched by node, nil iterator
+// means node cannot be served by indexes and needs a full scan.
+// exact is true when all returned ids match node without rechecking.
+func (store *Store) queryIter(node *QueryNode) (iter IndexIterator, exact bool) {
+	switch node.Op {
+	case QueryAnd:
+		iters := make([]IndexIterator, 0, len(node.Children))
+		excludes := make([]IndexIterator, 0)
+		exact = true
+		for _, child := range node.Children {
+			// negated children are subtracted from the others
+			// instead of the whole ids set
+			if child.Op == QueryNot && store.queryExact(child.Children[0]) {
+				childIter, _ := store.queryIter(child.Children[0])
+				excludes = append(excludes, childIter)
+				continue
+			}
+			childIter, childExact := store.queryIter(child)
+			if childIter == nil {
+				exact = false
+				continue
+			}
+			iters = append(iters, childIter)
+			exact = exact && childExact
+		}
+		switch {
+		case len(iters) == 0 && len(excludes) == 0:
+			return nil, false
+		case len(iters) == 0:
+			iter = store.index.ID.Iter()
+		case len(iters) == 1:
+			iter = iters[0]
+		default:
+			iter = NewIntersectIndexIterator(iters...)
+		}
+		if len(excludes) > 0 {
+			iter = NewDifferenceIndexIterator(iter, excludes...)
+		}
+		return iter, exact
+	case QueryOr:
+		iters := make([]IndexIterator, len(node.Children))
+		exact = true
+		for i, child := range node.Children {
+			childIter, childExact := store.queryIter(child)
+			if childIter == nil {
+				return nil, false
+			}
+			iters[i] = childIter
+			exact = exact && childExact
+		}
+		return NewUnionIndexIterator(iters...), exact
+	case QueryNot:
+		if !store.queryExact(node.Children[0]) {
+			return nil, false
+		}
+		childIter, _ := store.queryIter(node.Children[0])
+		return NewDifferenceIndexIterator(store.index.ID.Iter(), childIter), true
+	}
+
+	if node.Empty {
+		return EmptyIndexIterator, true
+	}
+
+	switch node.Field {
+	case QuerySex:
+		return store.index.Sex.Iter(byte(node.Value)), true
+	case QueryStatus:
+		return store.index.Status.Iter(byte(node.Value)), true
+	case QueryFname:
+		return store.index.Fname.Iter(Fname(node.Value)), true
+	case QueryPhoneCode:
+		if node.Null {
+			return nil, false
+		}
+		// zero bucket also holds accounts without phone
+		return store.index.PhoneCode.Iter(uint16(node.Value)), node.Value != 0
+	case QueryCountry:
+		return store.index.Country.Iter(Country(node.Value)), true
+	case QueryCity:
+		return store.index.City.Iter(City(node.Value)), true
+	case QueryBirthYear:
+		return store.index.BirthYear.Iter(Year(node.Value)), true
+	case QueryInterests:
+		return store.index.Interest.Iter(Interest(node.Value)), true
+	case QueryLikes:
+		return store.index.Likee.Iter(ID(node.Value)), true
+	}
+	return nil, false
+}
+
+// queryExact reports whether queryIter returns exact iterator for node.
+func (store *Store) queryExact(node *QueryNode) bool {
+	switch node.Op {
+	case QueryAnd, QueryOr, QueryNot:
+		for _, child := range node.Children {
+			if !store.queryExact(child) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if node.Empty {
+		return true
+	}
+
+	switch node.Field {
+	case QuerySex, QueryStatus, QueryFname, QueryCountry, QueryCity,
+		QueryBirthYear, QueryInterests, QueryLikes:
+		return true
+	case QueryPhoneCode:
+		return !node.Null && node.Value != 0
+	}
+	return false
+}
+
+func (store *Store) queryMatch(node *QueryNode, account *Account) bool {
+	switch node.Op {
+	case QueryAnd:
+		for _, child := range node.Children {
+			if !store.queryMatch(child, account) {
+				return false
+			}
+		}
+		return true
+	case QueryOr:
+		for _, child := range node.Children {
+			if store.queryMatch(child, account) {
+				return true
+			}
+		}
+		return false
+	case QueryNot:
+		return !store.queryMatch(node.Children[0], account)
+	}
+
+	if node.Empty {
+		return false
+	}
+
+	switch node.Field {
+	case QuerySex:
+		return account.Sex == byte(node.Value)
+	case QueryStatus:
+		return account.Status == byte(node.Value)
+	case QueryFname:
+		return account.Fname == Fname(node.Value)
+	case QuerySname:
+		return account.Sname == Sname(node.Value)
+	case QueryPhoneCode:
+		if node.Null {
+			return account.Phone == nil
+		}
+		return account.Phone != nil && account.PhoneCode == uint16(node.Value)
+	case QueryCountry:
+		return account.Country == Country(node.Value)
+	case QueryCity:
+		return account.City == City(node.Value)
+	case QueryBirth:
+		if node.Cmp == QueryLt {
+			return account.Birth < node.Value
+		}
+		return account.Birth > node.Value
+	case QueryBirthYear:
+		return account.Birth >= node.Gte && account.Birth <= node.Lte
+	case QueryInterests:
+		for _, interest := range account.Interests {
+			if interest == Interest(node.Value) {
+				return true
+			}
+		}
+		return false
+	case QueryLikes:
+		for _, like := range store.index.Liker.Find(account.ID) {
+			if like.ID == ID(node.Value) {
+				return true
+			}
+		}
+		return false
+	case QueryPremium:
+		if node.Null {
+			return account.Premium == nil
+		}
+		return store.PremiumNow(account)
+	case QueryEmailDomain:
+		return account.Email[account.EmailDomain:] == node.Str
+	}
+	return false
+}
@@ -1,22 +1,92 @@
 package main
 
 import (
+	"math"
 	"sort"
+	"time"
 )
 
 func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *AccountsBuffer) {
-	sex := byte(0)
-	if account.Sex == SexFemale {
-		sex = SexMale
-	} else {
-		sex = SexFemale
-	}
-	filter := &recommend.Filter
-
 	if len(account.Interests) == 0 || recommend.ExpectEmpty() {
 		return
 	}
 
+	excludes := &RecommendExcludes{
+		blocked:  store.index.Block.Find(account.ID),
+		birthGte: math.MinInt64,
+		birthLte: math.MaxInt64,
+	}
+	if recommend.ExcludeLiked() {
+		excludes.liked = store.index.Liker.Find(account.ID)
+	}
+	store.resolveRecommendAge(recommend, excludes)
+
+	scorer := recommend.Scorer()
+	// scored localities take pairs from the same union of interests
+	var ids IDS
+	if !scorer.Tiered() {
+		ids = store.interestsUnion(account)
+	}
+	for _, filter := range recommend.LocalityFilters(account) {
+		// accounts taken by previous locality are not taken again
+		excludes.taken = *accounts
+		if scorer.Tiered() {
+			store.recommendTiered(account, recommend, &filter, scorer, excludes, accounts)
+		} else {
+			store.recommendScored(account, ids, recommend, &filter, scorer, excludes, accounts)
+		}
+		if len(*accounts) >= recommend.Limit() {
+			break
+		}
+	}
+
+	if recommend.Explain() {
+		for _, pair := range *accounts {
+			recommend.explains = append(recommend.explains, store.explainRecommend(account, pair, scorer))
+		}
+	}
+}
+
+func (store *Store) explainRecommend(account *Account, pair *Account, scorer RecommendScorer) RecommendExplain {
+	explain := RecommendExplain{
+		Premium:    store.PremiumNow(pair),
+		StatusRank: StatusRank(pair.Status),
+		Score:      scorer.Score(store, account, pair),
+	}
+	for _, interest := range account.Interests {
+		for _, pairInterest := range pair.Interests {
+			if interest == pairInterest {
+				explain.Interests = append(explain.Interests, interest)
+				break
+			}
+		}
+	}
+	diff := float64(account.Birth - pair.Birth)
+	if diff < 0 {
+		diff = -diff
+	}
+	explain.AgeGap = diff / secondsInYear
+	return explain
+}
+
+// resolveRecommendAge converts age params to birth bounds relative to
+// store.now, see resolveAge.
+func (store *Store) resolveRecommendAge(recommend *Recommend, excludes *RecommendExcludes) {
+	filter := &recommend.Filter
+	now := time.Unix(int64(store.now), 0).UTC()
+	if filter.AgeMinSet {
+		excludes.birthLte = now.AddDate(-int(filter.AgeMin), 0, 0).Unix()
+	}
+	if filter.AgeMaxSet {
+		excludes.birthGte = now.AddDate(-int(filter.AgeMax)-1, 0, 0).Unix() + 1
+	}
+}
+
+// recommendTiered takes premium accounts first and then others by status,
+// every tier is ordered by scorer.
+func (store *Store) recommendTiered(account *Account, recommend *Recommend, filter *RecommendFilter, scorer RecommendScorer, excludes *RecommendExcludes, accounts *AccountsBuffer) {
+	sexes := SeekingSexes(account)
+
 	if filter.City != 0 {
 		interestIndexes := make([]IDS, len(account.Interests))
 		for i, interest := range account.Interests {
@@ -25,13 +95,13 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 		ids := UnionIndexes(interestIndexes...)
 
-		recommendPairs := NewRecommendPairs(store, account, len(ids))
+		recommendPairs := NewRecommendPairs(store, account, scorer, excludes, len(ids))
 		for _, id := range ids {
 			if account.ID == id {
 				continue
 			}
 			pair := store.get(id)
-			if account.Sex == pair.Sex {
+			if !SeekEachOther(account, pair) {
 				continue
 			}
 			recommendPairs.AddPair(pair)
@@ -39,8 +109,8 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 		recommendPairs.Sort()
 
-		*accounts = (*accounts)[:len(recommendPairs.Get(recommend.Limit()))]
-		copy(*accounts, recommendPairs.Get(recommend.Limit()))
+		pairs := recommendPairs.Get(recommend.Limit() - len(*accounts))
+		*accounts = append(*accounts, pairs...)
 		if len(*accounts) == recommend.Limit() {
 			return
 		}
@@ -52,13 +122,13 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 		ids := UnionIndexes(interestIndexes...)
 
-		recommendPairs := NewRecommendPairs(store, account, len(ids))
+		recommendPairs := NewRecommendPairs(store, account, scorer, excludes, len(ids))
 		for _, id := range ids {
 			if account.ID == id {
 				continue
 			}
 			pair := store.get(id)
-			if account.Sex == pair.Sex {
+			if !SeekEachOther(account, pair) {
 				continue
 			}
 			recommendPairs.AddPair(pair)
@@ -66,63 +136,67 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 		recommendPairs.Sort()
 
-		*accounts = (*accounts)[:len(recommendPairs.Get(recommend.Limit()))]
-		copy(*accounts, recommendPairs.Get(recommend.Limit()))
+		pairs := recommendPairs.Get(recommend.Limit() - len(*accounts))
+		*accounts = append(*accounts, pairs...)
 		if len(*accounts) == recommend.Limit() {
 			return
 		}
 	} else {
 		// Single
-		interestIndexes := make([]IDS, len(account.Interests))
-		for i, interest := range account.Interests {
-			interestIndexes[i] = store.index.InterestPremium.FindByStatusSex(interest, StatusSingle, sex)
+		interestIndexes := make([]IDS, 0, len(account.Interests)*len(sexes))
+		for _, interest := range account.Interests {
+			for _, sex := range sexes {
+				interestIndexes = append(interestIndexes, store.index.InterestPremium.FindByStatusSex(interest, StatusSingle, sex))
+			}
 		}
 
 		ids := UnionIndexes(interestIndexes...)
 
-		recommendPairs := NewRecommendPairs(store, account, len(ids))
+		recommendPairs := NewRecommendPairs(store, account, scorer, excludes, len(ids))
 		for _, id := range ids {
 			if account.ID == id {
 				continue
 			}
-			// pair := store.accounts[id]
-			// if account.Sex == pair.Sex {
-			// 	continue
-			// }
-			recommendPairs.AddPair(store.get(id))
+			pair := store.get(id)
+			if !SeekEachOther(account, pair) {
+				continue
+			}
+			recommendPairs.AddPair(pair)
 		}
 
 		recommendPairs.Sort()
 
-		*accounts = (*accounts)[:len(recommendPairs.Get(recommend.Limit()))]
-		copy(*accounts, recommendPairs.Get(recommend.Limit()))
+		pairs := recommendPairs.Get(recommend.Limit() - len(*accounts))
+		*accounts = append(*accounts, pairs...)
 		if len(*accounts) == recommend.Limit() {
 			return
 		}
 
 		// Complicated
-		interestIndexes = make([]IDS, len(account.Interests))
-		for i, interest := range account.Interests {
-			interestIndexes[i] = store.index.InterestPremium.FindByStatusSex(interest, StatusComplicated, sex)
+		interestIndexes = make([]IDS, 0, len(account.Interests)*len(sexes))
+		for _, interest := range account.Interests {
+			for _, sex := range sexes {
+				interestIndexes = append(interestIndexes, store.index.InterestPremium.FindByStatusSex(interest, StatusComplicated, sex))
+			}
 		}
 
 		ids = UnionIndexes(interestIndexes...)
 
-		recommendPairs = NewRecommendPairs(store, account, len(ids))
+		recommendPairs = NewRecommendPairs(store, account, scorer, excludes, len(ids))
 		for _, id := range ids {
 			if account.ID == id {
 				continue
 			}
-			// pair := store.accounts[id]
-			// if account.Sex == pair.Sex {
-			// 	continue
-			// }
-			recommendPairs.AddPair(store.get(id))
+			pair := store.get(id)
+			if !SeekEachOther(account, pair) {
+				continue
+			}
+			recommendPairs.AddPair(pair)
 		}
 
 		recommendPairs.Sort()
 
-		pairs := recommendPairs.Get(recommend.Limit() - len(*accounts))
+		pairs = recommendPairs.Get(recommend.Limit() - len(*accounts))
 		*accounts = append(*accounts, pairs...)
 
 		if len(*accounts) == recommend.Limit() {
@@ -130,23 +204,25 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 		}
 
 		// Relationship
-		interestIndexes = make([]IDS, len(account.Interests))
-		for i, interest := range account.Interests {
-			interestIndexes[i] = store.index.InterestPremium.FindByStatusSex(interest, StatusRelationship, sex)
+		interestIndexes = make([]IDS, 0, len(account.Interests)*len(sexes))
+		for _, interest := range account.Interests {
+			for _, sex := range sexes {
+				interestIndexes = append(interestIndexes, store.index.InterestPremium.FindByStatusSex(interest, StatusRelationship, sex))
+			}
 		}
 
 		ids = UnionIndexes(interestIndexes...)
 
-		recommendPairs = NewRecommendPairs(store, account, len(ids))
+		recommendPairs = NewRecommendPairs(store, account, scorer, excludes, len(ids))
 		for _, id := range ids {
 			if account.ID == id {
 				continue
 			}
-			// pair := store.accounts[id]
-			// if account.Sex == pair.Sex {
-			// 	continue
-			// }
-			recommendPairs.AddPair(store.get(id))
+			pair := store.get(id)
+			if !SeekEachOther(account, pair) {
+				continue
+			}
+			recommendPairs.AddPair(pair)
 		}
 
 		recommendPairs.Sort()
@@ -174,13 +250,13 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 	ids := UnionIndexes(interestIndexes...)
 
-	recommendPairs := NewRecommendPairs(store, account, len(ids))
+	recommendPairs := NewRecommendPairs(store, account, scorer, excludes, len(ids))
 	for _, id := range ids {
 		if account.ID == id {
 			continue
 		}
 		pair := store.get(id)
-		if account.Sex == pair.Sex {
+		if !SeekEachOther(account, pair) {
 			continue
 		}
 		recommendPairs.AddPair(pair)
@@ -210,13 +286,13 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 	ids = UnionIndexes(interestIndexes...)
 
-	recommendPairs = NewRecommendPairs(store, account, len(ids))
+	recommendPairs = NewRecommendPairs(store, account, scorer, excludes, len(ids))
 	for _, id := range ids {
 		if account.ID == id {
 			continue
 		}
 		pair := store.get(id)
-		if account.Sex == pair.Sex {
+		if !SeekEachOther(account, pair) {
 			continue
 		}
 		recommendPairs.AddPair(pair)
@@ -246,13 +322,13 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 
 	ids = UnionIndexes(interestIndexes...)
 
-	recommendPairs = NewRecommendPairs(store, account, len(ids))
+	recommendPairs = NewRecommendPairs(store, account, scorer, excludes, len(ids))
 	for _, id := range ids {
 		if account.ID == id {
 			continue
 		}
 		pair := store.get(id)
-		if account.Sex == pair.Sex {
+		if !SeekEachOther(account, pair) {
 			continue
 		}
 		recommendPairs.AddPair(pair)
@@ -264,30 +340,93 @@ func (store *Store) Recommend(account *Account, recommend *Recommend, accounts *
 	*accounts = append(*accounts, pairs...)
 }
 
+// recommendScored takes accounts seeking each other with account from ids
+// having common interests with it, and orders them by score only.
+func (store *Store) recommendScored(account *Account, ids IDS, recommend *Recommend, filter *RecommendFilter, scorer RecommendScorer, excludes *RecommendExcludes, accounts *AccountsBuffer) {
+	recommendPairs := NewRecommendPairs(store, account, scorer, excludes, len(ids))
+	for _, id := range ids {
+		if account.ID == id {
+			continue
+		}
+		pair := store.get(id)
+		if !SeekEachOther(account, pair) {
+			continue
+		}
+		if filter.City != 0 && filter.City != pair.City {
+			continue
+		}
+		if filter.Country != 0 && filter.Country != pair.Country {
+			continue
+		}
+		recommendPairs.AddPair(pair)
+	}
+
+	recommendPairs.Sort()
+
+	*accounts = append(*accounts, recommendPairs.Get(recommend.Limit()-len(*accounts))...)
+}
+
+// interestsUnion returns accounts having any interest of account.
+func (store *Store) interestsUnion(account *Account) IDS {
+	interestIndexes := make([]IDS, len(account.Interests))
+	for i, interest := range account.Interests {
+		interestIndexes[i] = store.index.Interest.Find(interest)
+	}
+	return UnionIndexes(interestIndexes...)
+}
+
 // type RecommendPair struct {
 // 	account     *Account
 // 	compability uint64
 // }
 
+// RecommendExcludes are accounts never recommended to account.
+type RecommendExcludes struct {
+	liked    AccountLikes
+	blocked  IDS
+	taken    AccountsBuffer
+	birthGte int64
+	birthLte int64
+}
+
+func (excludes *RecommendExcludes) Has(pair *Account) bool {
+	if pair.Birth < excludes.birthGte || pair.Birth > excludes.birthLte {
+		return true
+	}
+	for _, taken := range excludes.taken {
+		if taken.ID == pair.ID {
+			return true
+		}
+	}
+	return excludes.liked.Contains(pair.ID) || excludes.blocked.Contains(pair.ID)
+}
+
 type RecommendPairs struct {
 	store     *Store
 	account   *Account
+	scorer    RecommendScorer
+	excludes  *RecommendExcludes
 	pairs     []*Account
-	pairComps []uint64
+	pairComps []float64
 }
 
-func NewRecommendPairs(store *Store, account *Account, capacity int) *RecommendPairs {
+func NewRecommendPairs(store *Store, account *Account, scorer RecommendScorer, excludes *RecommendExcludes, capacity int) *RecommendPairs {
 	return &RecommendPairs{
 		store:     store,
 		account:   account,
+		scorer:    scorer,
+		excludes:  excludes,
 		pairs:     make([]*Account, 0, capacity),
-		pairComps: make([]uint64, 0, capacity),
+		pairComps: make([]float64, 0, capacity),
 	}
 }
 
 func (ra *RecommendPairs) AddPair(pair *Account) {
+	if ra.excludes.Has(pair) {
+		return
+	}
 	ra.pairs = append(ra.pairs, pair)
-	ra.pairComps = append(ra.pairComps, Compability(ra.account, pair))
+	ra.pairComps = append(ra.pairComps, ra.scorer.Score(ra.store, ra.account, pair))
 }
 
 func (ra *RecommendPairs) Sort() {
@@ -311,5 +450,8 @@ func (ra *RecommendPairs) Swap(i, j int) {
 }
 
 func (ra *RecommendPairs) Less(i, j int) bool {
+	if ra.pairComps[i] == ra.pairComps[j] {
+		return ra.pairs[i].ID < ra.pairs[j].ID
+	}
 	return ra.pairComps[i] > ra.pairComps[j]
 }
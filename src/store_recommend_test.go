@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// recommendIDs runs recommend for account by query and returns ids of
+// recommended accounts.
+func recommendIDs(t *testing.T, store *Store, dicts *Dicts, id ID, query string) IDS {
+	recommend := BorrowRecommend(store, dicts)
+	defer recommend.Release()
+	err := recommend.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	accounts := BorrowAccountsBuffer()
+	defer accounts.Release()
+	store.Recommend(store.Get(id), recommend, accounts)
+	ids := make(IDS, len(*accounts))
+	for i, account := range *accounts {
+		ids[i] = account.ID
+	}
+	return ids
+}
+
+func TestRecommendScorer(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		id    ID
+		query string
+		want  IDS
+	}{
+		{1, "limit=10", IDS{2, 3}},
+		{1, "limit=1", IDS{2}},
+		{1, "limit=10&scorer=weighted", IDS{2, 3}},
+		// age gap of account 3 is 10 years
+		{1, "limit=10&weights=age=5", IDS{3, 2}},
+		// equal scores go by id
+		{1, "limit=10&weights=premium=0,status=0,interests=0,age=0,city=0,likes=0", IDS{2, 3}},
+		{2, "limit=10&weights=premium=0,status=0,interests=0,age=0,city=0,likes=0", IDS{1, 4}},
+		// account 4 has two common interests
+		{2, "limit=10&weights=premium=0,status=0,interests=1,age=0,city=0,likes=0", IDS{4, 1}},
+		{2, "limit=10&scorer=weighted&weights=premium=0,status=0,age=0,city=0", IDS{4, 1}},
+		{2, "limit=10&scorer=weighted", IDS{1, 4}},
+		{2, "limit=10", IDS{1, 4}},
+		{5, "limit=10&scorer=weighted", IDS{}},
+	}
+
+	for _, test := range tests {
+		if got := recommendIDs(t, store, dicts, test.id, test.query); !equalIDS(got, test.want) {
+			t.Errorf("%d %s: got %v, want %v", test.id, test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"limit=10&scorer=random", "limit=10&scorer=default&weights=age=1", "limit=10&weights=age", "limit=10&weights=beauty=1"} {
+		recommend := BorrowRecommend(store, dicts)
+		if err := recommend.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		recommend.Release()
+	}
+}
+
+func TestRecommendExclude(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts)
+
+	tests := []struct {
+		id    ID
+		query string
+		want  IDS
+	}{
+		// account 1 likes accounts 2 and 3, account 2 likes account 1
+		{1, "limit=10", IDS{2, 3}},
+		{1, "limit=10&exclude_liked=1", IDS{}},
+		{2, "limit=10&exclude_liked=1", IDS{4}},
+		{2, "limit=10&exclude_liked=1&scorer=weighted", IDS{4}},
+		{2, "limit=10&exclude_liked=0", IDS{1, 4}},
+		// new clients skip liked accounts by default
+		{1, "limit=10&v=2", IDS{}},
+		{2, "limit=10&v=2", IDS{4}},
+		{2, "limit=10&v=2&exclude_liked=0", IDS{1, 4}},
+		{2, "limit=10&v=1", IDS{1, 4}},
+	}
+	for _, test := range tests {
+		if got := recommendIDs(t, store, dicts, test.id, test.query); !equalIDS(got, test.want) {
+			t.Errorf("%d %s: got %v, want %v", test.id, test.query, got, test.want)
+		}
+	}
+
+	// store default is overridden by request
+	store.SetRecommendExcludeLiked(true)
+	if got := recommendIDs(t, store, dicts, 2, "limit=10"); !equalIDS(got, IDS{4}) {
+		t.Errorf("excluded by default: got %v, want %v", got, IDS{4})
+	}
+	if got := recommendIDs(t, store, dicts, 2, "limit=10&exclude_liked=0"); !equalIDS(got, IDS{1, 4}) {
+		t.Errorf("exclude_liked=0: got %v, want %v", got, IDS{1, 4})
+	}
+	store.SetRecommendExcludeLiked(false)
+
+	// blocks hide accounts in both directions
+	if err := store.Block(4, IDS{2}); err != nil {
+		t.Fatal(err)
+	}
+	blocked := []struct {
+		id    ID
+		query string
+		want  IDS
+	}{
+		{2, "limit=10", IDS{1}},
+		{2, "limit=10&scorer=weighted", IDS{1}},
+		{4, "limit=10", IDS{}},
+		{1, "limit=10", IDS{2, 3}},
+	}
+	for _, test := range blocked {
+		if got := recommendIDs(t, store, dicts, test.id, test.query); !equalIDS(got, test.want) {
+			t.Errorf("%d %s after block: got %v, want %v", test.id, test.query, got, test.want)
+		}
+	}
+
+	for _, blocked := range []IDS{{4}, {3, 100}} {
+		if err := store.Block(4, blocked); err == nil {
+			t.Errorf("block %v: expected error", blocked)
+		}
+	}
+	// failed block blocks none of accounts
+	if got := store.index.Block.Find(3); len(got) != 0 {
+		t.Errorf("account 3 is blocked by %v", got)
+	}
+
+	for _, query := range []string{"limit=10&exclude_liked=yes", "limit=10&exclude_liked=", "limit=10&v=x", "limit=10&v=256"} {
+		recommend := BorrowRecommend(store, dicts)
+		if err := recommend.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		recommend.Release()
+	}
+}
+
+// testSeeking are accounts looking for the same or any sex.
+const testSeeking = `,
+{"id": 11, "email": "lena@mail.ru", "sex": "f", "seeking": "f", "birth": 694224000, "country": "Росмаль", "city": "Москва", "joined": 1420070400, "status": "свободны", "interests": ["Спорт"]},
+{"id": 12, "email": "ilya@mail.ru", "sex": "m", "seeking": "any", "birth": 788918400, "joined": 1420070400, "status": "свободны", "interests": ["Кино"]},
+{"id": 13, "email": "vera@mail.ru", "sex": "f", "seeking": "any", "birth": 725846400, "joined": 1420070400, "status": "свободны", "interests": ["Спорт"]}
+`
+
+func TestRecommendSeeking(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testSeeking)
+
+	tests := []struct {
+		id    ID
+		query string
+		want  IDS
+	}{
+		// account 11 is not looked for by account 2
+		{2, "limit=10", IDS{1, 4}},
+		{11, "limit=10", IDS{13}},
+		{12, "limit=10", IDS{3}},
+		// premium account 1 goes first
+		{3, "limit=10", IDS{1, 12, 6}},
+		{13, "limit=10", IDS{1, 11, 4}},
+		{13, "limit=10&scorer=weighted", IDS{1, 11, 4}},
+	}
+
+	for _, test := range tests {
+		if got := recommendIDs(t, store, dicts, test.id, test.query); !equalIDS(got, test.want) {
+			t.Errorf("%d %s: got %v, want %v", test.id, test.query, got, test.want)
+		}
+	}
+
+	// account 2 looks for any sex since update
+	store.index.RunWorker()
+	rawAccount := &RawAccount{}
+	err := parser.DecodeAccount([]byte(`{"seeking": "any"}`), rawAccount, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Update(2, rawAccount, true); err != nil {
+		t.Fatal(err)
+	}
+	store.index.worker.Wait()
+	if got := recommendIDs(t, store, dicts, 11, "limit=10"); !equalIDS(got, IDS{2, 13}) {
+		t.Errorf("11 after update: got %v, want %v", got, IDS{2, 13})
+	}
+}
+
+// testAgeEdges are born on 2000-12-16 and 2000-12-17, so they are 18 and
+// 17 at testNow time.
+const testAgeEdges = `,
+{"id": 14, "email": "edge18@mail.ru", "sex": "m", "birth": 976924800, "joined": 1420070400, "status": "свободны", "interests": ["Кино"]},
+{"id": 15, "email": "edge17@mail.ru", "sex": "m", "birth": 977011200, "joined": 1420070400, "status": "свободны", "interests": ["Кино"]}
+`
+
+func TestRecommendAge(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts+testAgeEdges)
+
+	tests := []struct {
+		query string
+		want  IDS
+	}{
+		{"limit=10", IDS{1, 14, 15, 6}},
+		{"limit=10&age_min=18", IDS{1, 14, 6}},
+		{"limit=10&age_max=18", IDS{14, 15, 6}},
+		{"limit=10&age_min=18&age_max=18", IDS{14, 6}},
+		{"limit=10&age_min=19&age_max=28", IDS{1}},
+		{"limit=10&age_min=29", IDS{}},
+		{"limit=10&age_max=17&scorer=weighted", IDS{15}},
+	}
+
+	for _, test := range tests {
+		got := recommendIDs(t, store, dicts, 3, test.query)
+		if !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"limit=10&age_min=20&age_max=19", "limit=10&age_min=x", "limit=10&age_max=300"} {
+		recommend := BorrowRecommend(store, dicts)
+		if err := recommend.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		recommend.Release()
+	}
+}
+
+func TestRecommendLocality(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts)
+
+	// account 4 without city goes first by common interests
+	const weights = "&weights=premium=0,status=0,age=0,city=0"
+	tests := []struct {
+		query string
+		want  IDS
+	}{
+		{"limit=10" + weights, IDS{4, 1}},
+		{"limit=10&locality=any" + weights, IDS{4, 1}},
+		{"limit=10&locality=city" + weights, IDS{1, 4}},
+		{"limit=1&locality=city" + weights, IDS{1}},
+		{"limit=10&locality=country" + weights, IDS{1, 4}},
+		{"limit=10&city=Москва" + weights, IDS{1}},
+		{"limit=10&country=Росмаль" + weights, IDS{1}},
+		{"limit=10&country=Германия" + weights, IDS{}},
+		{"limit=10&locality=city", IDS{1, 4}},
+		{"limit=10&city=Unknown", IDS{}},
+	}
+
+	for _, test := range tests {
+		if got := recommendIDs(t, store, dicts, 2, test.query); !equalIDS(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"limit=10&locality=street", "limit=10&locality=city&city=Москва", "limit=10&locality=any&country=Росмаль"} {
+		recommend := BorrowRecommend(store, dicts)
+		if err := recommend.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		recommend.Release()
+	}
+}
+
+func TestRecommendExplain(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+
+	recommend := BorrowRecommend(store, dicts)
+	defer recommend.Release()
+	query := "limit=10&explain=1&weights=premium=0,status=0,age=0,city=0"
+	if err := recommend.Parse(query); err != nil {
+		t.Fatal(err)
+	}
+	accounts := make(AccountsBuffer, 0)
+	store.Recommend(store.Get(2), recommend, &accounts)
+
+	sport, _ := dicts.GetInterest("Спорт")
+	music, _ := dicts.GetInterest("Музыка")
+	tests := []struct {
+		id      ID
+		explain RecommendExplain
+	}{
+		{4, RecommendExplain{false, 2, []Interest{sport, music}, (662688000 - 315532800) / secondsInYear, 10}},
+		{1, RecommendExplain{true, 3, []Interest{sport}, (662688000 - 631152000) / secondsInYear, 5 + 0.1*3}},
+	}
+	explains := recommend.Explains()
+	if len(accounts) != len(tests) || len(explains) != len(tests) {
+		t.Fatalf("got %d accounts and %d explains, want %d", len(accounts), len(explains), len(tests))
+	}
+	for i, test := range tests {
+		explain := explains[i]
+		if accounts[i].ID != test.id {
+			t.Errorf("account %d: got %d, want %d", i, accounts[i].ID, test.id)
+		}
+		if explain.Premium != test.explain.Premium || explain.StatusRank != test.explain.StatusRank ||
+			explain.AgeGap != test.explain.AgeGap || explain.Score != test.explain.Score ||
+			len(explain.Interests) != len(test.explain.Interests) {
+			t.Errorf("account %d: explain %+v, want %+v", test.id, explain, test.explain)
+			continue
+		}
+		for j := range explain.Interests {
+			if explain.Interests[j] != test.explain.Interests[j] {
+				t.Errorf("account %d: interests %v, want %v", test.id, explain.Interests, test.explain.Interests)
+				break
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	parser.EncodeRecommendExplained(accounts, &buffer, recommend)
+	want := `{"accounts":[` +
+		`{"id":4,"email":"petr@yandex.ru","status":"всё сложно","fname":"Пётр","sname":"Сидоров","birth":315532800,"premium":{"start":1400000000,"finish":1410000000},"_explain":{"premium":false,"status_rank":2,"interests":["Спорт","Музыка"],"age_gap":11,"score":10}},` +
+		`{"id":1,"email":"ivan@mail.ru","status":"свободны","fname":"Иван","sname":"Иванов","birth":631152000,"premium":{"start":1540000000,"finish":1550000000},"_explain":{"premium":true,"status_rank":3,"interests":["Спорт"],"age_gap":1,"score":5.3}}]}`
+	if got := buffer.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// default scorer explains packed compability
+	recommend.Reset()
+	if err := recommend.Parse("limit=1&explain=1"); err != nil {
+		t.Fatal(err)
+	}
+	accounts = accounts[:0]
+	store.Recommend(store.Get(2), recommend, &accounts)
+	if len(recommend.Explains()) != 1 || recommend.Explains()[0].Score != float64(Compability(store.Get(2), accounts[0])) {
+		t.Errorf("explains %+v of %v, want compability", recommend.Explains(), accounts)
+	}
+}
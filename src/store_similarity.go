@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+)
+
+// SimilarityBy computes similarity of likers by metric, likes are weighted
+// by their age when halfLife is not zero.
+func (store *Store) SimilarityBy(me *Account, account *Account, metric SuggestMetric, halfLife uint32) float64 {
+	if metric == SuggestMetricTs && halfLife == 0 {
+		return store.Similarity(me, account)
+	}
+
+	meLikes := averageLikes(store.index.Liker.Find(me.ID))
+	accountLikes := averageLikes(store.index.Liker.Find(account.ID))
+	if len(meLikes) == 0 || len(accountLikes) == 0 {
+		return 0
+	}
+
+	var (
+		common      float64 // depends on metric
+		minSum      float64
+		maxSum      float64
+		meNorm      float64
+		accountNorm float64
+	)
+	// both are sorted by likee descending
+	i, j := 0, 0
+	for i < len(meLikes) || j < len(accountLikes) {
+		mine := j >= len(accountLikes) || i < len(meLikes) && meLikes[i].ID >= accountLikes[j].ID
+		another := i >= len(meLikes) || j < len(accountLikes) && accountLikes[j].ID >= meLikes[i].ID
+
+		myWeight, anotherWeight := float64(0), float64(0)
+		if mine {
+			myWeight = store.likeWeight(meLikes[i].Ts, halfLife)
+		}
+		if another {
+			anotherWeight = store.likeWeight(accountLikes[j].Ts, halfLife)
+		}
+
+		if mine && another {
+			switch metric {
+			case SuggestMetricTs:
+				dTs := math.Abs(float64(meLikes[i].Ts) - float64(accountLikes[j].Ts))
+				if dTs == 0 {
+					dTs = 1
+				}
+				common += myWeight * anotherWeight / dTs
+			case SuggestMetricAdamicAdar:
+				// likee index is updated by worker apart from liker index,
+				// so it may not count both likers yet and log would be zero
+				if likers := store.index.Likee.Count(meLikes[i].ID); likers >= 2 {
+					common += myWeight * anotherWeight / math.Log(float64(likers))
+				}
+			default:
+				common += myWeight * anotherWeight
+			}
+		}
+		minSum += math.Min(myWeight, anotherWeight)
+		maxSum += math.Max(myWeight, anotherWeight)
+		meNorm += myWeight * myWeight
+		accountNorm += anotherWeight * anotherWeight
+
+		if mine {
+			i++
+		}
+		if another {
+			j++
+		}
+	}
+
+	switch metric {
+	case SuggestMetricJaccard:
+		if maxSum == 0 {
+			return 0
+		}
+		return minSum / maxSum
+	case SuggestMetricCosine:
+		if meNorm == 0 || accountNorm == 0 {
+			return 0
+		}
+		return common / math.Sqrt(meNorm*accountNorm)
+	}
+	return common
+}
+
+// likeWeight decays like exponentially by its age relative to store time.
+func (store *Store) likeWeight(ts uint32, halfLife uint32) float64 {
+	if halfLife == 0 || ts >= store.now {
+		return 1
+	}
+	return math.Exp2(-float64(store.now-ts) / float64(halfLife))
+}
+
+// averageLikes takes every likee once with average timestamp of its likes,
+// likes should be sorted by likee.
+func averageLikes(likes AccountLikes) AccountLikes {
+	averaged := make(AccountLikes, 0, len(likes))
+	for i := 0; i < len(likes); {
+		likee := likes[i].ID
+		tsTotal, tsCount := uint64(0), uint64(0)
+		for ; i < len(likes) && likes[i].ID == likee; i++ {
+			tsTotal += uint64(likes[i].Ts)
+			tsCount++
+		}
+		averaged = append(averaged, AccountLike{ID: likee, Ts: uint32(tsTotal / tsCount)})
+	}
+	return averaged
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// testSimilarLikers are likers 20, 21 and 22 of accounts 30-33, account 20
+// likes account 30 twice.
+const testSimilarLikers = `,
+{"id": 20, "email": "liker20@mail.ru", "sex": "m", "birth": 631152000, "joined": 1420070400, "status": "свободны", "likes": [{"id": 30, "ts": 1500000000}, {"id": 31, "ts": 1510000000}, {"id": 32, "ts": 1520000000}, {"id": 30, "ts": 1500002000}]},
+{"id": 21, "email": "liker21@mail.ru", "sex": "m", "birth": 631152000, "joined": 1420070400, "status": "свободны", "likes": [{"id": 30, "ts": 1500001000}, {"id": 31, "ts": 1510000500}, {"id": 33, "ts": 1530000000}]},
+{"id": 22, "email": "liker22@mail.ru", "sex": "m", "birth": 631152000, "joined": 1420070400, "status": "свободны", "likes": [{"id": 32, "ts": 1520000000}]},
+{"id": 30, "email": "likee30@mail.ru", "sex": "f", "birth": 631152000, "joined": 1420070400, "status": "свободны"},
+{"id": 31, "email": "likee31@mail.ru", "sex": "f", "birth": 631152000, "joined": 1420070400, "status": "свободны"},
+{"id": 32, "email": "likee32@mail.ru", "sex": "f", "birth": 631152000, "joined": 1420070400, "status": "свободны"},
+{"id": 33, "email": "likee33@mail.ru", "sex": "f", "birth": 631152000, "joined": 1420070400, "status": "свободны"}
+`
+
+func TestAverageLikes(t *testing.T) {
+	tests := []struct {
+		likes AccountLikes
+		want  AccountLikes
+	}{
+		{AccountLikes{}, AccountLikes{}},
+		{AccountLikes{{5, 100}}, AccountLikes{{5, 100}}},
+		{AccountLikes{{5, 100}, {5, 300}, {3, 50}}, AccountLikes{{5, 200}, {3, 50}}},
+		{AccountLikes{{5, 100}, {5, 101}, {3, 7}, {3, 8}, {3, 9}, {1, 1}}, AccountLikes{{5, 100}, {3, 8}, {1, 1}}},
+	}
+
+	for _, test := range tests {
+		got := averageLikes(test.likes)
+		if len(got) != len(test.want) {
+			t.Errorf("averageLikes(%v) = %v, want %v", test.likes, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("averageLikes(%v) = %v, want %v", test.likes, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLikeWeight(t *testing.T) {
+	store, _, _ := newTestStore(t, testAccounts)
+
+	const day = 24 * 60 * 60
+	tests := []struct {
+		ts       uint32
+		halfLife uint32
+		want     float64
+	}{
+		{testNow - 100*day, 0, 1},
+		{testNow, day, 1},
+		{testNow + day, day, 1},
+		{testNow - day, day, 0.5},
+		{testNow - 2*day, day, 0.25},
+		{testNow - 30*day, 90 * day, math.Exp2(-1.0 / 3)},
+	}
+
+	for _, test := range tests {
+		if got := store.likeWeight(test.ts, test.halfLife); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("likeWeight(%d, %d) = %v, want %v", test.ts, test.halfLife, got, test.want)
+		}
+	}
+}
+
+func TestSimilarityBy(t *testing.T) {
+	store, _, _ := newTestStore(t, testAccounts+testSimilarLikers)
+
+	// average time of repeated likes of account 30 is the same for both
+	const halfLife = 365 * 24 * 60 * 60
+	w := func(ts uint32) float64 {
+		return math.Exp2(-float64(testNow-ts) / halfLife)
+	}
+	tests := []struct {
+		me       ID
+		account  ID
+		metric   SuggestMetric
+		halfLife uint32
+		want     float64
+	}{
+		{20, 21, SuggestMetricTs, 0, 1 + 1.0/500},
+		{21, 20, SuggestMetricTs, 0, 1 + 1.0/500},
+		{20, 21, SuggestMetricJaccard, 0, 2.0 / 4},
+		{20, 21, SuggestMetricCosine, 0, 2.0 / 3},
+		{20, 22, SuggestMetricCosine, 0, 1 / math.Sqrt(3)},
+		{20, 21, SuggestMetricAdamicAdar, 0, 2 / math.Log(2)},
+		{20, 22, SuggestMetricAdamicAdar, 0, 1 / math.Log(2)},
+		// no common likees
+		{21, 22, SuggestMetricTs, 0, 0},
+		{21, 22, SuggestMetricJaccard, 0, 0},
+		{21, 22, SuggestMetricCosine, 0, 0},
+		{21, 22, SuggestMetricAdamicAdar, 0, 0},
+		// account 30 is not liked by anybody
+		{30, 20, SuggestMetricJaccard, 0, 0},
+		{20, 30, SuggestMetricCosine, 0, 0},
+		// decayed likes
+		{20, 21, SuggestMetricTs, halfLife, w(1500001000)*w(1500001000) + w(1510000000)*w(1510000500)/500},
+		{20, 21, SuggestMetricJaccard, halfLife,
+			(w(1500001000) + w(1510000000)) / (w(1500001000) + w(1510000500) + w(1520000000) + w(1530000000))},
+		{20, 22, SuggestMetricAdamicAdar, halfLife, w(1520000000) * w(1520000000) / math.Log(2)},
+	}
+
+	for _, test := range tests {
+		got := store.SimilarityBy(store.Get(test.me), store.Get(test.account), test.metric, test.halfLife)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("SimilarityBy(%d, %d, %d, %d) = %v, want %v", test.me, test.account, test.metric, test.halfLife, got, test.want)
+		}
+	}
+
+	// likee index may lag behind liker index
+	store.index.Likee.Remove(32, 22)
+	if got := store.SimilarityBy(store.Get(20), store.Get(22), SuggestMetricAdamicAdar, 0); got != 0 {
+		t.Errorf("SimilarityBy with one liker counted = %v, want 0", got)
+	}
+}
+
+func TestParseSuggestMetric(t *testing.T) {
+	tests := []struct {
+		value  string
+		metric SuggestMetric
+		err    bool
+	}{
+		{"ts", SuggestMetricTs, false},
+		{"jaccard", SuggestMetricJaccard, false},
+		{"cosine", SuggestMetricCosine, false},
+		{"adamic_adar", SuggestMetricAdamicAdar, false},
+		{"", 0, true},
+		{"Jaccard", 0, true},
+		{"pearson", 0, true},
+	}
+
+	for _, test := range tests {
+		metric, err := ParseSuggestMetric(test.value)
+		if test.err != (err != nil) {
+			t.Errorf("ParseSuggestMetric(%q) error %v", test.value, err)
+			continue
+		}
+		if metric != test.metric {
+			t.Errorf("ParseSuggestMetric(%q) = %d, want %d", test.value, metric, test.metric)
+		}
+	}
+}
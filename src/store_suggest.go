@@ -19,7 +19,7 @@ func (store *Store) Suggest(account *Account, suggest *Suggest, accounts *Accoun
 
 	ids := UnionIndexes(similarLikerIndexes...)
 
-	similarLikers := BorrowSimilarLikers(store, account)
+	similarLikers := BorrowSimilarLikers(store, account, suggest.Metric(), suggest.HalfLife())
 	defer similarLikers.Release()
 
 	// similarLikers := NewSimilarLikers(store, account, len(ids))
@@ -46,9 +46,16 @@ func (store *Store) Suggest(account *Account, suggest *Suggest, accounts *Accoun
 	suggestIDs := BorrowIDS()
 	defer suggestIDs.Release()
 
+	blocked := store.index.Block.Find(account.ID)
+
+	var likers map[ID][]SuggestLiker
+	if suggest.Explain() {
+		likers = make(map[ID][]SuggestLiker)
+	}
+
 	taked := make(map[ID]bool)
 	prevSug := 0
-	for _, similarLiker := range similarLikers.Get() {
+	for i, similarLiker := range similarLikers.Get() {
 		for _, like := range store.index.Liker.Find(similarLiker.ID) {
 			existsMyLike := false
 			for _, myLike := range store.index.Liker.Find(account.ID) {
@@ -57,7 +64,17 @@ func (store *Store) Suggest(account *Account, suggest *Suggest, accounts *Accoun
 					break
 				}
 			}
-			if !existsMyLike {
+			if !existsMyLike && !blocked.Contains(like.ID) {
+				if likers != nil {
+					likeLikers := likers[like.ID]
+					// liker may like the same account several times
+					if len(likeLikers) == 0 || likeLikers[len(likeLikers)-1].ID != similarLiker.ID {
+						likers[like.ID] = append(likeLikers, SuggestLiker{
+							ID:         similarLiker.ID,
+							Similarity: similarLikers.Similarity(i),
+						})
+					}
+				}
 				if _, ok := taked[like.ID]; !ok {
 					*suggestIDs = append(*suggestIDs, like.ID)
 					taked[like.ID] = true
@@ -73,6 +90,9 @@ func (store *Store) Suggest(account *Account, suggest *Suggest, accounts *Accoun
 
 	for _, suggestID := range *suggestIDs {
 		*accounts = append(*accounts, store.get(suggestID))
+		if likers != nil {
+			suggest.explains = append(suggest.explains, SuggestExplain{Likers: likers[suggestID]})
+		}
 		if len(*accounts) >= suggest.Limit() {
 			break
 		}
@@ -82,6 +102,8 @@ func (store *Store) Suggest(account *Account, suggest *Suggest, accounts *Accoun
 type SimilarLikers struct {
 	store     *Store
 	account   *Account
+	metric    SuggestMetric
+	halfLife  uint32
 	likers    []*Account
 	likerSims []float64
 }
@@ -95,11 +117,13 @@ var similarLikersPool = sync.Pool{
 	},
 }
 
-func BorrowSimilarLikers(store *Store, account *Account) *SimilarLikers {
+func BorrowSimilarLikers(store *Store, account *Account, metric SuggestMetric, halfLife uint32) *SimilarLikers {
 	sl := similarLikersPool.Get().(*SimilarLikers)
 	sl.Reset()
 	sl.store = store
 	sl.account = account
+	sl.metric = metric
+	sl.halfLife = halfLife
 	return sl
 }
 
@@ -123,7 +147,7 @@ func (sm *SimilarLikers) Release() {
 
 func (sm *SimilarLikers) Add(liker *Account) {
 	sm.likers = append(sm.likers, liker)
-	sm.likerSims = append(sm.likerSims, sm.store.Similarity(sm.account, liker))
+	sm.likerSims = append(sm.likerSims, sm.store.SimilarityBy(sm.account, liker, sm.metric, sm.halfLife))
 	// fmt.Printf("id = %d, sim = %f\n", liker.ID, Similarity(sm.account, liker))
 }
 
@@ -131,6 +155,10 @@ func (sm *SimilarLikers) Get() []*Account {
 	return sm.likers
 }
 
+func (sm *SimilarLikers) Similarity(i int) float64 {
+	return sm.likerSims[i]
+}
+
 func (sm *SimilarLikers) Len() int {
 	return len(sm.likers)
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// suggestIDs runs suggest for account by query and returns ids of
+// suggested accounts.
+func suggestIDs(t *testing.T, store *Store, dicts *Dicts, id ID, query string) IDS {
+	suggest := BorrowSuggest(store, dicts)
+	defer suggest.Release()
+	err := suggest.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	accounts := make(AccountsBuffer, 0)
+	store.Suggest(store.Get(id), suggest, &accounts)
+	ids := make(IDS, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	return ids
+}
+
+func TestSuggestBlocked(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts)
+
+	// account 1 likes account 3 as account 4 does and also likes account 2
+	if got := suggestIDs(t, store, dicts, 4, "limit=10"); !equalIDS(got, IDS{2}) {
+		t.Errorf("got %v, want %v", got, IDS{2})
+	}
+	// blocked by account 2, so it is hidden in both directions
+	if err := store.Block(2, IDS{4}); err != nil {
+		t.Fatal(err)
+	}
+	if got := suggestIDs(t, store, dicts, 4, "limit=10"); !equalIDS(got, IDS{}) {
+		t.Errorf("got %v after block, want none", got)
+	}
+}
+
+// testSuggestLiker likes account 4 as account 7 does, which likes account 1
+// twice.
+const testSuggestLiker = `,
+{"id": 16, "email": "ivan16@mail.ru", "sex": "m", "birth": 631152000, "joined": 1420070400, "status": "свободны", "likes": [{"id": 4, "ts": 1500000000}]}
+`
+
+func TestSuggestExplain(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts+testRepeatedLikes+testSuggestLiker)
+
+	suggest := BorrowSuggest(store, dicts)
+	defer suggest.Release()
+	if err := suggest.Parse("limit=10&explain=1"); err != nil {
+		t.Fatal(err)
+	}
+	accounts := make(AccountsBuffer, 0)
+	store.Suggest(store.Get(16), suggest, &accounts)
+
+	// liker is listed once however many times likes
+	explains := suggest.Explains()
+	if len(accounts) != 1 || accounts[0].ID != 1 || len(explains) != 1 {
+		t.Fatalf("got %v and explains %+v, want account 1", accounts, explains)
+	}
+	similarity := store.Similarity(store.Get(16), store.Get(7))
+	if likers := explains[0].Likers; len(likers) != 1 || likers[0].ID != 7 || likers[0].Similarity != similarity {
+		t.Errorf("got likers %+v, want account 7 with similarity %v", likers, similarity)
+	}
+
+	var buffer bytes.Buffer
+	parser.EncodeSuggestExplained(accounts, &buffer, suggest)
+	// both like account 4 at the same time
+	want := `{"accounts":[{"id":1,"email":"ivan@mail.ru","status":"свободны","fname":"Иван","sname":"Иванов","_explain":{"likers":[{"id":7,"similarity":1}]}}]}`
+	if got := buffer.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestSuggestMetric(t *testing.T) {
+	store, _, dicts := newTestStore(t, testAccounts+testSimilarLikers)
+
+	// account 20 is the only liker of account 32 besides account 22
+	for _, metric := range []string{"ts", "jaccard", "cosine", "adamic_adar"} {
+		for _, halfLife := range []string{"", "&half_life=30"} {
+			query := "limit=10&metric=" + metric + halfLife
+			if got := suggestIDs(t, store, dicts, 22, query); !equalIDS(got, IDS{31, 30}) {
+				t.Errorf("%s: got %v, want %v", query, got, IDS{31, 30})
+			}
+		}
+	}
+
+	for _, query := range []string{"limit=10&metric=pearson", "limit=10&half_life=0", "limit=10&half_life=x", "limit=10&half_life=70000"} {
+		suggest := BorrowSuggest(store, dicts)
+		if err := suggest.Parse(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+		suggest.Release()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testNow is 2018-12-16, premium of account 1 is active then.
+const testNow = 1545000000
+
+// testAccounts are accounts in data file format shared by tests.
+const testAccounts = `
+{"id": 1, "email": "ivan@mail.ru", "fname": "Иван", "sname": "Иванов", "phone": "8(912)1234567", "sex": "m", "birth": 631152000, "country": "Росмаль", "city": "Москва", "joined": 1420070400, "status": "свободны", "interests": ["Спорт", "Кино"], "premium": {"start": 1540000000, "finish": 1550000000}, "likes": [{"id": 2, "ts": 1500000000}, {"id": 3, "ts": 1510000000}]},
+{"id": 2, "email": "anna@gmail.com", "fname": "Анна", "sname": "Петрова", "sex": "f", "birth": 662688000, "country": "Росмаль", "city": "Москва", "joined": 1451606400, "status": "свободны", "interests": ["Спорт", "Музыка"], "likes": [{"id": 1, "ts": 1500000100}]},
+{"id": 3, "email": "maria@mail.ru", "fname": "Мария", "phone": "8(903)7654321", "sex": "f", "birth": 946684800, "country": "Германия", "city": "Берлин", "joined": 1483228800, "status": "заняты", "interests": ["Кино"], "likes": [{"id": 1, "ts": 1520000000}, {"id": 2, "ts": 1520000100}]},
+{"id": 4, "email": "petr@yandex.ru", "fname": "Пётр", "sname": "Сидоров", "sex": "m", "birth": 315532800, "joined": 1325376000, "status": "всё сложно", "interests": ["Музыка", "Книги", "Спорт"], "premium": {"start": 1400000000, "finish": 1410000000}, "likes": [{"id": 3, "ts": 1530000000}]},
+{"id": 5, "email": "olga@gmail.com", "sname": "Смирнова", "sex": "f", "birth": 820454400, "country": "Испания", "city": "Мадрид", "joined": 1420070400, "status": "свободны"},
+{"id": 6, "email": "alex@mail.ru", "fname": "Алексей", "sex": "m", "birth": 951782400, "country": "Росмаль", "city": "Москва", "joined": 1514764800, "status": "заняты", "interests": ["Кино", "Книги"], "likes": [{"id": 1, "ts": 1540000000}, {"id": 5, "ts": 1540000100}]}
+`
+
+// newTestStore loads accounts given in data file format and builds indexes
+// the same way main does, options are applied before indexes are built.
+func newTestStore(t *testing.T, accounts string, options ...func(*Store)) (*Store, *Parser, *Dicts) {
+	dicts := NewDicts()
+	parser := NewParser(dicts)
+	store := NewStore(dicts, testNow, false)
+	for _, option := range options {
+		option(store)
+	}
+
+	rawAccounts, err := parser.DecodeAccounts(strings.NewReader(`{"accounts": [` + accounts + `]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rawAccount := range rawAccounts {
+		_, err := store.Add(rawAccount, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Iterate(func(account *Account) bool {
+		store.index.Append(account)
+		store.index.AppendInterests(account, store.PremiumNow(account), account.Interests...)
+		return true
+	})
+	store.index.Update()
+	return store, parser, dicts
+}
+
+// filterIDs runs filter by params and returns ids of found accounts.
+func filterIDs(t *testing.T, store *Store, parser *Parser, dicts *Dicts, params url.Values) IDS {
+	filter := NewFilter(parser, dicts)
+	filter.Reset()
+	err := filter.Parse(params.Encode())
+	if err != nil {
+		t.Fatalf("%s: %v", params.Encode(), err)
+	}
+	accounts := make(AccountsBuffer, 0)
+	store.Filter(filter, &accounts)
+	ids := make(IDS, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	return ids
+}
+
+func equalIDS(a, b IDS) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUpdateUniquePhone(t *testing.T) {
+	store, parser, dicts := newTestStore(t, testAccounts)
+	store.SetUniquePhone(true)
+	store.index.RunWorker()
+
+	tests := []struct {
+		id    ID
+		phone string
+		err   bool
+	}{
+		// taken by account 1
+		{2, "8(912)1234567", true},
+		{1, "8(912)1234567", false},
+		{1, "8(912)0000000", false},
+		// released by account 1
+		{2, "8(912)1234567", false},
+		{3, "8(912)0000000", true},
+	}
+
+	for _, test := range tests {
+		rawAccount := &RawAccount{}
+		err := parser.DecodeAccount([]byte(`{"phone": "`+test.phone+`"}`), rawAccount, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.Update(test.id, rawAccount, true)
+		if test.err != (err != nil) {
+			t.Errorf("update %d phone %s: error %v", test.id, test.phone, err)
+		}
+	}
+	store.index.worker.Wait()
+
+	owners := map[string]ID{"8(912)1234567": 2, "8(912)0000000": 1, "8(903)7654321": 3}
+	for phone, owner := range owners {
+		if id, ok := store.FindPhone(phone); !ok || id != owner {
+			t.Errorf("phone %s owner %d, want %d", phone, id, owner)
+		}
+		got := filterIDs(t, store, parser, dicts, url.Values{"phone_eq": {phone}, "limit": {"10"}})
+		if !equalIDS(got, IDS{owner}) {
+			t.Errorf("phone_eq=%s: got %v, want %v", phone, got, IDS{owner})
+		}
+	}
+}
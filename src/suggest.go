@@ -13,6 +13,30 @@ type SuggestFilter struct {
 	City    City
 }
 
+// SuggestMetric is a similarity of likers by liked accounts.
+type SuggestMetric uint8
+
+const (
+	SuggestMetricTs         SuggestMetric = iota // sum of 1/|avg ts difference|
+	SuggestMetricJaccard                         // (weighted) jaccard index
+	SuggestMetricCosine                          // cosine of like vectors
+	SuggestMetricAdamicAdar                      // common likees weighted by 1/log(likers)
+)
+
+func ParseSuggestMetric(value string) (SuggestMetric, error) {
+	switch value {
+	case "ts":
+		return SuggestMetricTs, nil
+	case "jaccard":
+		return SuggestMetricJaccard, nil
+	case "cosine":
+		return SuggestMetricCosine, nil
+	case "adamic_adar":
+		return SuggestMetricAdamicAdar, nil
+	}
+	return 0, errors.New("Invalid metric value")
+}
+
 type Suggest struct {
 	store *Store
 	dicts *Dicts
@@ -20,9 +44,23 @@ type Suggest struct {
 	// queryID     string
 	expectEmpty bool
 	limit       int
+	explain     bool
+	explains    []SuggestExplain // by results, filled by store
+	metric      SuggestMetric
+	halfLife    uint32 // seconds, likes are not decayed when zero
 	Filter      SuggestFilter
 }
 
+type SuggestLiker struct {
+	ID         ID
+	Similarity float64
+}
+
+// SuggestExplain lists similar likers which liked suggested account.
+type SuggestExplain struct {
+	Likers []SuggestLiker
+}
+
 var suggestsPool = sync.Pool{
 	New: func() interface{} {
 		return &Suggest{}
@@ -52,6 +90,10 @@ func (suggest *Suggest) Reset() {
 	// suggest.queryID = ""
 	suggest.expectEmpty = false
 	suggest.limit = 0
+	suggest.explain = false
+	suggest.explains = suggest.explains[:0]
+	suggest.metric = SuggestMetricTs
+	suggest.halfLife = 0
 	suggest.Filter.Country = 0
 	suggest.Filter.City = 0
 }
@@ -71,6 +113,24 @@ func (suggest *Suggest) Limit() int {
 	return suggest.limit
 }
 
+// Explain reports whether reasons of results are returned.
+func (suggest *Suggest) Explain() bool {
+	return suggest.explain
+}
+
+func (suggest *Suggest) Explains() []SuggestExplain {
+	return suggest.explains
+}
+
+func (suggest *Suggest) Metric() SuggestMetric {
+	return suggest.metric
+}
+
+// HalfLife is age of like in seconds when its weight halves.
+func (suggest *Suggest) HalfLife() uint32 {
+	return suggest.halfLife
+}
+
 func (suggest *Suggest) Parse(query string) error {
 	values, err := url.ParseQuery(query)
 	if err != nil {
@@ -118,6 +178,28 @@ func (suggest *Suggest) ParseParam(param string, value string) error {
 			return errors.New("Invalid limit value")
 		}
 		suggest.limit = int(ui64)
+	case "explain":
+		switch value {
+		case "0":
+			suggest.explain = false
+		case "1":
+			suggest.explain = true
+		default:
+			return errors.New("Invalid explain value")
+		}
+	case "metric":
+		metric, err := ParseSuggestMetric(value)
+		if err != nil {
+			return err
+		}
+		suggest.metric = metric
+	case "half_life":
+		// in days
+		ui64, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || ui64 == 0 {
+			return errors.New("Invalid half_life value")
+		}
+		suggest.halfLife = uint32(ui64) * 24 * 60 * 60
 	case "query_id":
 		// suggest.queryID = value
 	default: